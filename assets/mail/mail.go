@@ -30,6 +30,23 @@ type WarningMail struct {
 	AdditionalDetails string
 }
 
+// AnomalyMail is a struct representing an email sent when a collection revealed view spikes of videos.
+type AnomalyMail struct {
+	IncidentTimestamp string
+	Anomalies         []AnomalyMailEntry
+}
+
+// AnomalyMailEntry is a view spike of a video listed in an AnomalyMail.
+type AnomalyMailEntry struct {
+	VideoID     int64
+	VideoName   string
+	Day         string
+	Severity    string
+	ViewsGained float64
+	Baseline    float64
+	Score       float64
+}
+
 //go:embed *.tmpl
 var templatesFS embed.FS
 
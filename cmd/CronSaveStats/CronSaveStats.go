@@ -4,6 +4,7 @@ import (
 	"flag"
 	"time"
 
+	"github.com/sa-kemper/peertubestats/assets/mail"
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
 	"github.com/sa-kemper/peertubestats/internal/MailLog"
 	"github.com/sa-kemper/peertubestats/internal/Response"
@@ -23,6 +24,12 @@ var apiConfig struct {
 // TestMail specifies if the program should just test the mail sending process and quit
 var TestMail bool
 
+// MailAnomalies specifies if the view spikes detected after the collection are mailed to the administrators
+var MailAnomalies bool
+
+// RawRetention specifies how old raw files are compressed after the collection, see StatsIO.RawRetention
+var RawRetention StatsIO.RawRetention
+
 func init() {
 	flag.StringVar(&apiConfig.ClientId, "api-client-id", "exampleID", "Client ID")
 	flag.StringVar(&apiConfig.ClientSecret, "api-client-secret", "exampleSecret", "Client Secret")
@@ -31,6 +38,9 @@ func init() {
 	flag.StringVar(&apiConfig.Host, "api-host", "peertube.example.com", "Host to authenticate with")
 	flag.StringVar(&apiConfig.Protocol, "api-protocol", "https://", "Protocol to authenticate with")
 	flag.BoolVar(&TestMail, "test-mail", false, "Test mail")
+	flag.BoolVar(&MailAnomalies, "mail-anomalies", false, "Mail the view spikes detected after the collection to the administrators")
+	flag.IntVar(&RawRetention.CompressAfterDays, "compress-raw-after-days", 0, "Compress raw files older than this many days, 0 keeps them uncompressed")
+	flag.BoolVar(&RawRetention.ArchiveMonths, "archive-raw-months", false, "Roll the raw files of each month older than -compress-raw-after-days into one archive")
 }
 
 func main() {
@@ -85,11 +95,63 @@ func main() {
 		println("error occurred during getting server config")
 		panic(err)
 	}
-	StatsIO.Database.Init(PeertubeApiClient)
+	// a backup or a restore must not see a partially written collection
+	unlock, err := StatsIO.Database.LockCollector(StatsIO.DefaultCollectorLockWait)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Fatal, "cannot lock the data folder", map[string]interface{}{"error": err.Error()}).Log()
+		panic(err)
+	}
+	defer func() {
+		LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": StatsIO.Database.DataFolder}, unlock())
+	}()
+
+	err = StatsIO.Database.Init(PeertubeApiClient)
+	if err != nil {
+		// nothing is written to a data folder that cannot be opened, SendMailOnFatalLog mails the fatal log and exits.
+		LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": StatsIO.Database.DataFolder}, unlock())
+		LogHelp.NewLog(LogHelp.Fatal, "cannot open the data folder", map[string]interface{}{"dataFolder": StatsIO.Database.DataFolder, "error": err.Error()}).Log()
+		select {}
+	}
 	err = StatsIO.Database.ImportFromRaw(RawResponses, serverConfig.ServerVersion, collectionTime)
 
 	if err != nil {
 		LogHelp.NewLog(LogHelp.Fatal, "error occurred during stats import", map[string]interface{}{"error": err.Error()}).Log()
 		panic(err)
 	}
+
+	if MailAnomalies {
+		mailAnomalies(collectionTime)
+	}
+
+	compressed, archived, err := StatsIO.Database.RetainRawFiles(RawRetention, collectionTime)
+	LogHelp.LogOnError("cannot compress old raw files, the affected files are kept", map[string]interface{}{"retention": RawRetention}, err)
+	if compressed > 0 || archived > 0 {
+		LogHelp.NewLog(LogHelp.Info, "compressed old raw files", map[string]interface{}{"files": compressed, "months": archived}).Log()
+	}
+}
+
+// mailAnomalies sends the view spikes revealed by the collection to the administrators, nothing is sent without one.
+func mailAnomalies(collectionTime time.Time) {
+	anomalies := StatsIO.CollectionAnomalies(collectionTime)
+	if len(anomalies) == 0 {
+		return
+	}
+	anomalyMail := mail.AnomalyMail{IncidentTimestamp: collectionTime.In(StatsIO.Database.ReportingLocation()).Format("2006-01-02 15:04")}
+	for _, anomaly := range anomalies {
+		entry := mail.AnomalyMailEntry{
+			VideoID:     anomaly.VideoID,
+			Day:         anomaly.Time.Format("2006-01-02"),
+			Severity:    anomaly.Severity,
+			ViewsGained: anomaly.ViewsGained,
+			Baseline:    anomaly.Baseline,
+			Score:       anomaly.Score,
+		}
+		video, err := StatsIO.GetVideo(anomaly.VideoID)
+		LogHelp.LogOnError("cannot obtain video of anomaly", map[string]interface{}{"videoID": anomaly.VideoID}, err)
+		entry.VideoName = video.Name
+		anomalyMail.Anomalies = append(anomalyMail.Anomalies, entry)
+	}
+	LogHelp.NewLog(LogHelp.Info, "view spikes detected", map[string]interface{}{"anomalies": anomalies}).Log()
+	err := MailLog.SendAnomalies(anomalyMail)
+	LogHelp.LogOnError("cannot mail view spikes", map[string]interface{}{"anomalies": len(anomalies)}, err)
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/internal/Response"
+	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+var apiConfig struct {
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Username     string `json:"username"`
+	Password     string `json:"-"`
+	Host         string `json:"host"`
+	Protocol     string `json:"protocol"`
+}
+
+var Config struct {
+	From            string
+	DryRun          bool
+	LockWaitSeconds int
+}
+
+func init() {
+	flag.StringVar(&apiConfig.ClientId, "api-client-id", "exampleID", "Client ID")
+	flag.StringVar(&apiConfig.ClientSecret, "api-client-secret", "exampleSecret", "Client Secret")
+	flag.StringVar(&apiConfig.Username, "api-username", "exampleUser", "Username to authenticate with")
+	flag.StringVar(&apiConfig.Password, "api-password", "examplePassword", "Password to authenticate with")
+	flag.StringVar(&apiConfig.Host, "api-host", "peertube.example.com", "Host to authenticate with")
+	flag.StringVar(&apiConfig.Protocol, "api-protocol", "https", "Protocol to authenticate with")
+	flag.StringVar(&Config.From, "from", "", "First day to backfill as YYYY-MM-DD, the day the oldest video was published on by default")
+	flag.BoolVar(&Config.DryRun, "dry-run", false, "Request the statistics and report the days that would be backfilled without writing them")
+	flag.IntVar(&Config.LockWaitSeconds, "lock-wait-seconds", int(StatsIO.DefaultCollectorLockWait.Seconds()), "Seconds to wait for a running collection to finish")
+}
+
+// peertubeBackfill writes a collection for each day before the first collection of the data folder, from the viewers statistics
+// PeerTube recorded for each video, and prints a JSON summary to stdout.
+// The exit code is 0 on success, 1 if the statistics of some videos could not be requested and 2 if the backfill failed.
+func main() {
+	var err error
+	err = Response.ParseConfigFromEnvFile()
+	LogHelp.LogOnError("cannot parse configuration from env file", map[string]interface{}{"config": Config, "apiConfig": apiConfig}, err)
+
+	err = Response.ParseConfigFromEnvironment()
+	LogHelp.LogOnError("cannot parse configuration from environment", map[string]interface{}{"config": Config, "apiConfig": apiConfig}, err)
+
+	flag.Parse()
+	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": Config, "apiConfig": apiConfig}).Log()
+
+	var from time.Time
+	if Config.From != "" {
+		from, err = time.ParseInLocation("2006-01-02", Config.From, StatsIO.Database.ReportingLocation())
+		if err != nil {
+			LogHelp.NewLog(LogHelp.Error, "cannot parse -from, expected YYYY-MM-DD", map[string]string{"from": Config.From}).Log()
+			os.Exit(2)
+		}
+	}
+
+	api, err := peertubeApi.NewApiClient(apiConfig.ClientId, apiConfig.ClientSecret, apiConfig.Username, apiConfig.Password, apiConfig.Host, apiConfig.Protocol, peertubeApi.DEFAULT_RATE_LIMITS, nil)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot log in to the PeerTube api", map[string]string{"error": err.Error(), "host": apiConfig.Host}).Log()
+		os.Exit(2)
+	}
+
+	lockWait := time.Duration(Config.LockWaitSeconds) * time.Second
+	applied, err := StatsIO.Database.MigrateDataFolder(lockWait)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot backfill the data folder, it is of an unknown version or cannot be migrated", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+	if len(applied) > 0 {
+		LogHelp.NewLog(LogHelp.Info, "migrated data folder", map[string]interface{}{"migrations": applied}).Log()
+	}
+
+	viewers := func(id int64, start, end time.Time) (peertubeApi.VideoStatsTimeserie, error) {
+		return api.GetVideoStatsTimeserie(id, peertubeApi.VideoStatsMetricViewers, start, end)
+	}
+	report, err := StatsIO.Database.Backfill(viewers, from, Config.DryRun, lockWait)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot backfill data folder", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	LogHelp.LogOnError("cannot write summary", nil, encoder.Encode(report))
+
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/internal/Response"
+	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+)
+
+var Config struct {
+	Output          string
+	Restore         string
+	Force           bool
+	Verify          bool
+	LockWaitSeconds int
+}
+
+func init() {
+	flag.StringVar(&Config.Output, "output", "", "Path of the backup archive to write, peertubestats-backup-<time>.tar.gz in the working directory by default")
+	flag.StringVar(&Config.Restore, "restore", "", "Path of a backup archive to restore into the data folder instead of writing a backup")
+	flag.BoolVar(&Config.Force, "force", false, "Restore into a data folder that holds files, it is kept next to the restored one")
+	flag.BoolVar(&Config.Verify, "verify", false, "Check the restored data folder for consistency, see peertubeFsck")
+	flag.IntVar(&Config.LockWaitSeconds, "lock-wait-seconds", int(StatsIO.DefaultCollectorLockWait.Seconds()), "Seconds to wait for a running collection to finish")
+}
+
+// summary is written to stdout after a backup or a restore.
+type summary struct {
+	Archive        string                    `json:"archive"`
+	FormatVersion  int                       `json:"format_version"`
+	DataVersion    int                       `json:"data_folder_version"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	Files          int                       `json:"files"`
+	Bytes          int64                     `json:"bytes"`
+	PreviousFolder string                    `json:"previous_data_folder,omitempty"`
+	Check          *StatsIO.DataFolderReport `json:"check,omitempty"`
+}
+
+// peertubeBackup writes a backup archive of the data folder, or restores one, and prints a JSON summary to stdout.
+// The exit code is 0 on success, 1 if the restored data folder is inconsistent and 2 if the backup or the restore failed.
+func main() {
+	var err error
+	err = Response.ParseConfigFromEnvFile()
+	LogHelp.LogOnError("cannot parse configuration from env file", map[string]interface{}{"config": Config}, err)
+
+	err = Response.ParseConfigFromEnvironment()
+	LogHelp.LogOnError("cannot parse configuration from environment", map[string]interface{}{"config": Config}, err)
+
+	flag.Parse()
+	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": Config}).Log()
+
+	lockWait := time.Duration(Config.LockWaitSeconds) * time.Second
+	var result summary
+	if Config.Restore != "" {
+		result, err = restore(lockWait)
+	} else {
+		result, err = backup(lockWait)
+	}
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "backup failed", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	LogHelp.LogOnError("cannot write summary", nil, encoder.Encode(result))
+
+	if result.Check != nil && result.Check.Unresolved > 0 {
+		os.Exit(1)
+	}
+}
+
+// backup writes the archive to the output, a backup written into the data folder would hold itself.
+func backup(lockWait time.Duration) (result summary, err error) {
+	output := Config.Output
+	if output == "" {
+		output = "peertubestats-backup-" + time.Now().Format("20060102T150405") + ".tar.gz"
+	}
+	absOutput, _ := filepath.Abs(output)
+	absData, _ := filepath.Abs(StatsIO.Database.DataFolder)
+	if strings.HasPrefix(absOutput, absData+string(os.PathSeparator)) {
+		return result, errors.New("the backup archive cannot be written into the data folder")
+	}
+
+	manifest, err := StatsIO.Database.BackupToFile(output, lockWait)
+	if err != nil {
+		return result, err
+	}
+	return summary{Archive: output, FormatVersion: manifest.FormatVersion, DataVersion: manifest.DataFolderVersion, CreatedAt: manifest.CreatedAt, Files: len(manifest.Files), Bytes: manifest.Size()}, nil
+}
+
+// restore restores the archive into the data folder and checks it, if requested.
+func restore(lockWait time.Duration) (result summary, err error) {
+	handle, err := os.Open(Config.Restore)
+	if err != nil {
+		return result, errors.Join(errors.New("cannot open backup archive"), err)
+	}
+	defer handle.Close()
+	manifest, previousFolder, err := StatsIO.Database.Restore(handle, Config.Force, lockWait)
+	if err != nil {
+		return result, err
+	}
+	result = summary{Archive: Config.Restore, FormatVersion: manifest.FormatVersion, DataVersion: manifest.DataFolderVersion, CreatedAt: manifest.CreatedAt, Files: len(manifest.Files), Bytes: manifest.Size(), PreviousFolder: previousFolder}
+	if Config.Verify {
+		report, checkErr := StatsIO.Database.CheckDataFolder(false, 0)
+		if checkErr != nil {
+			return result, errors.Join(errors.New("cannot check restored data folder"), checkErr)
+		}
+		result.Check = &report
+	}
+	return result, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"maps"
 	"os"
@@ -25,6 +26,12 @@ var Config struct {
 	StartDateParam  string
 	EndDateParam    string
 	SampleFrequency string
+	Mode            string
+	ForecastPeriods int
+	Compare         string
+	RankMetric      string
+	LeaderboardSize int
+	Metrics         bool
 	ApiHost         string
 }
 
@@ -33,7 +40,13 @@ func init() {
 	flag.StringVar(&Config.OutputLanguage, "output-language", "de", "Output language, must have a available locales file")
 	flag.StringVar(&Config.StartDateParam, "start-date", "", "Start date")
 	flag.StringVar(&Config.EndDateParam, "end-date", "", "End date")
-	flag.StringVar(&Config.SampleFrequency, "sample-frequency", "Daily", "Sample frequency can either be (Daily, Monthly, Yearly).")
+	flag.StringVar(&Config.SampleFrequency, "sample-frequency", "Daily", "Sample frequency can either be (Hourly, Daily, Weekly, Monthly, Quarterly, Yearly) or an interval of N days such as 14d.")
+	flag.StringVar(&Config.Mode, "mode", templates.ModeCumulative, "Mode of the views.csv can either be (Cumulative, Delta), Delta exports the views gained per period.")
+	flag.IntVar(&Config.ForecastPeriods, "forecast-periods", 0, "Number of projected periods following the range, exported as extra columns of the views.csv and shown dashed in the charts.")
+	flag.StringVar(&Config.Compare, "compare", templates.CompareNone, "Range the report is compared to can either be (None, PreviousPeriod, PreviousYear), the change of the gains is shown in the reports and exported as extra columns of the views.csv.")
+	flag.StringVar(&Config.RankMetric, "rank", templates.RankByViews, "Metric of the leaderboards can either be (Views, ViewsGained, LikesGained, GrowthRate, LikeRatio).")
+	flag.IntVar(&Config.LeaderboardSize, "leaderboard-size", 10, "Number of entries of each leaderboard, 0 omits the leaderboards.")
+	flag.BoolVar(&Config.Metrics, "metrics", false, "Export the engagement metrics, as extra columns of the views.csv and per period into metrics.json.")
 	flag.StringVar(&Config.ApiHost, "api-host", "peertube.example.com", "peertube API host")
 }
 
@@ -52,7 +65,12 @@ func main() {
 	LogHelp.AlwaysQueue = true
 	go MailLog.SendMailOnFatalLog()
 
-	StatsIO.Database.Init(nil)
+	err = StatsIO.Database.Init(nil)
+	if err != nil {
+		// SendMailOnFatalLog mails the fatal log and exits.
+		LogHelp.NewLog(LogHelp.Fatal, "cannot open the data folder", map[string]interface{}{"dataFolder": StatsIO.Database.DataFolder, "error": err.Error()}).Log()
+		select {}
+	}
 	videos, err := StatsIO.GetAllVideos()
 	if err != nil {
 		LogHelp.NewLog(LogHelp.Fatal, "cannot get all videos", map[string]interface{}{"errors": err, "videos": videos}).Log()
@@ -63,18 +81,33 @@ func main() {
 		LogHelp.LogOnError("cannot parse start date", map[string]interface{}{"startDate": Config.StartDateParam}, err)
 	}
 	EndDate, err := time.Parse("2006.01.02", Config.EndDateParam)
-	if Config.EndDateParam != "" {
+	if Config.EndDateParam != "" && err != nil {
 		LogHelp.NewLog(LogHelp.Fatal, "cannot parse end date", map[string]string{"error": err.Error()}).Log()
 	}
 
 	var DisplaySettings = templates.FrontPageRequest{
-		Timeframe: Config.SampleFrequency,
+		Timeframe:       Config.SampleFrequency,
+		Mode:            Config.Mode,
+		ForecastPeriods: Config.ForecastPeriods,
+		Compare:         Config.Compare,
+		Rank:            Config.RankMetric,
 		Dates: templates.TwoDateForm{
 			StartDate: StartDate,
 			EndDate:   EndDate,
 		},
 	}
-	DisplaySettings.HandleZeroDate()
+	DisplaySettings.HandleZeroDate(StatsIO.Database.ReportingLocation())
+
+	if Config.EndDateParam != "" {
+		// reports of the past use the metadata (name, thumbnail, ...) that was valid at the end of the report.
+		for i, vid := range videos {
+			videos[i], err = StatsIO.GetVideoAt(vid.ID, DisplaySettings.Dates.EndDate)
+			LogHelp.LogOnError("cannot get historic video metadata", map[string]interface{}{"videoID": vid.ID, "endDate": DisplaySettings.Dates.EndDate}, err)
+			if err != nil {
+				videos[i] = vid
+			}
+		}
+	}
 
 	err = os.MkdirAll(Config.OutputFolder, 0700)
 	LogHelp.LogOnError("cannot create output directory", map[string]interface{}{"outputFolder": Config.OutputFolder}, err)
@@ -117,17 +150,28 @@ func main() {
 		Videos:          videos,
 		DisplaySettings: DisplaySettings,
 		Scope: struct {
-			Views bool
-			Likes bool
+			Views   bool
+			Likes   bool
+			Metrics bool
 		}{
-			Views: true,
-			Likes: false,
+			Views:   true,
+			Likes:   false,
+			Metrics: Config.Metrics,
 		},
 	}))
 	if localErr != nil {
 		LogHelp.NewLog(LogHelp.Fatal, "cannot write to views.csv", map[string]string{"error": localErr.Error()}).Log()
 	}
 
+	if Config.Metrics {
+		metrics, err := StatsIO.ExportMetrics(videos, DisplaySettings)
+		LogHelp.LogOnError("cannot derive the metrics of the videos", nil, err)
+		metricsBytes, err := json.MarshalIndent(metrics, "", "  ")
+		LogHelp.LogOnError("cannot encode metrics.json", nil, err)
+		err = os.WriteFile(filepath.Join(Config.OutputFolder, "metrics.json"), metricsBytes, 0600)
+		LogHelp.LogOnError("cannot write metrics.json", map[string]interface{}{"outputFolder": Config.OutputFolder}, err)
+	}
+
 	// while the reports are being generated, output an index page.
 	fileHandler, LocalErr := os.OpenFile(filepath.Join(Config.OutputFolder, "index.html"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if LocalErr != nil {
@@ -147,7 +191,34 @@ func main() {
 		return lang.Get("%s", text)
 	}
 
-	LocalErr = TranslatedTemplate.Funcs(translatedFunctions).ExecuteTemplate(fileHandler, "reportIndex", map[string]interface{}{"Videos": videos})
+	// the leaderboards of the report rank the videos, their channels and their categories within the range of the report.
+	type leaderboard struct {
+		Group   string
+		Entries []StatsIO.RankingEntry
+	}
+	var leaderboards []leaderboard
+	for _, group := range templates.RankGroups {
+		if Config.LeaderboardSize <= 0 {
+			break
+		}
+		ranking, err := StatsIO.Rank(videos, DisplaySettings.Dates, group, DisplaySettings.Rank)
+		LogHelp.LogOnError("cannot rank videos", map[string]interface{}{"group": group, "metric": DisplaySettings.Rank}, err)
+		ranking = StatsIO.TopRanked(ranking, Config.LeaderboardSize)
+		StatsIO.ForecastRanking(ranking, videos, DisplaySettings)
+		leaderboards = append(leaderboards, leaderboard{Group: group, Entries: ranking})
+	}
+
+	// the comparison of each video is shown on its card and its report, the summary adds them up
+	var comparison StatsIO.PeriodComparison
+	comparisons := make(map[int64]StatsIO.PeriodComparison, len(videos))
+	for _, vid := range videos {
+		videoComparison, err := StatsIO.ComparePeriods(vid.ID, DisplaySettings)
+		LogHelp.LogOnError("cannot compare periods", map[string]interface{}{"videoID": vid.ID}, err)
+		comparisons[vid.ID] = videoComparison
+		comparison.Add(videoComparison)
+	}
+
+	LocalErr = TranslatedTemplate.Funcs(translatedFunctions).ExecuteTemplate(fileHandler, "reportIndex", map[string]interface{}{"Videos": videos, "Leaderboards": leaderboards, "Comparison": comparison, "Comparisons": comparisons, "Request": DisplaySettings})
 	LogHelp.LogOnError("cannot write index report page", nil, LocalErr)
 
 	for _, vid := range videos {
@@ -162,11 +233,13 @@ func main() {
 		}
 
 		err = TranslatedTemplate.ExecuteTemplate(fHandler, "singleVideoExport", struct {
-			Video   peertubeApi.VideoData
-			Request templates.FrontPageRequest
+			Video      peertubeApi.VideoData
+			Request    templates.FrontPageRequest
+			Comparison StatsIO.PeriodComparison
 		}{
-			Request: DisplaySettings,
-			Video:   vid,
+			Request:    DisplaySettings,
+			Video:      vid,
+			Comparison: comparisons[vid.ID],
 		})
 		if err != nil {
 			LogHelp.NewLog(LogHelp.Fatal, "cannot output report file", map[string]interface{}{
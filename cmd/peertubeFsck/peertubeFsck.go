@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/internal/Response"
+	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+var Config struct {
+	Repair          bool
+	LockWaitSeconds int
+}
+
+var apiConfig struct {
+	ClientId     string
+	ClientSecret string
+	Username     string
+	Password     string
+	Host         string
+	Protocol     string
+}
+
+func init() {
+	flag.BoolVar(&Config.Repair, "repair", false, "Rewrite inconsistent files from the raw data and download missing thumbnails. The raw data itself is never modified.")
+	flag.IntVar(&Config.LockWaitSeconds, "lock-wait-seconds", int(StatsIO.DefaultCollectorLockWait.Seconds()), "Seconds -repair waits for a running collection to finish")
+
+	flag.StringVar(&apiConfig.ClientId, "api-client-id", "exampleID", "Client ID")
+	flag.StringVar(&apiConfig.ClientSecret, "api-client-secret", "exampleSecret", "Client Secret")
+	flag.StringVar(&apiConfig.Username, "api-username", "exampleUser", "Username to authenticate with")
+	flag.StringVar(&apiConfig.Password, "api-password", "examplePassword", "Password to authenticate with")
+	flag.StringVar(&apiConfig.Host, "api-host", "peertube.example.com", "Host to authenticate with")
+	flag.StringVar(&apiConfig.Protocol, "api-protocol", "https", "Protocol to authenticate with")
+}
+
+// peertubeFsck checks the data folder for consistency and prints a JSON summary to stdout.
+// The exit code is 0 if the data folder is consistent (or has been repaired), 1 if issues remain and 2 if the check could not run.
+func main() {
+	var err error
+	err = Response.ParseConfigFromEnvFile()
+	LogHelp.LogOnError("cannot parse configuration from env file", map[string]interface{}{"config": Config}, err)
+
+	err = Response.ParseConfigFromEnvironment()
+	LogHelp.LogOnError("cannot parse configuration from environment", map[string]interface{}{"config": Config}, err)
+
+	flag.Parse()
+	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": Config}).Log()
+
+	if Config.Repair {
+		// the api is only required to download missing thumbnails, everything else is rebuilt from the raw data.
+		StatsIO.Database.Api, err = peertubeApi.NewApiClient(apiConfig.ClientId, apiConfig.ClientSecret, apiConfig.Username, apiConfig.Password, apiConfig.Host, apiConfig.Protocol, peertubeApi.DEFAULT_RATE_LIMITS, nil)
+		LogHelp.LogOnWarn("cannot initialize api client, missing thumbnails cannot be repaired", map[string]string{"host": apiConfig.Host}, err)
+	}
+
+	report, err := StatsIO.Database.CheckDataFolder(Config.Repair, time.Duration(Config.LockWaitSeconds)*time.Second)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot check data folder", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	LogHelp.LogOnError("cannot write report", nil, encoder.Encode(report))
+
+	if report.Unresolved > 0 {
+		os.Exit(1)
+	}
+}
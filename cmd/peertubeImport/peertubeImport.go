@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/internal/Response"
+	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+)
+
+var Config struct {
+	Input           string
+	DryRun          bool
+	LockWaitSeconds int
+}
+
+func init() {
+	flag.StringVar(&Config.Input, "input", "", "CSV file to import, - to read it from stdin")
+	flag.BoolVar(&Config.DryRun, "dry-run", false, "Read the file and report the views that would be imported without writing them")
+	flag.IntVar(&Config.LockWaitSeconds, "lock-wait-seconds", int(StatsIO.DefaultCollectorLockWait.Seconds()), "Seconds to wait for a running collection to finish")
+}
+
+// peertubeImport imports the views of the videos recorded in a CSV file, a spreadsheet or an export of another tool, into the data folder
+// and prints a JSON summary to stdout.
+// The exit code is 0 on success, 1 if some rows name a video that is unknown to the data folder and 2 if the import failed.
+func main() {
+	var err error
+	err = Response.ParseConfigFromEnvFile()
+	LogHelp.LogOnError("cannot parse configuration from env file", map[string]interface{}{"config": Config}, err)
+
+	err = Response.ParseConfigFromEnvironment()
+	LogHelp.LogOnError("cannot parse configuration from environment", map[string]interface{}{"config": Config}, err)
+
+	flag.Parse()
+	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": Config}).Log()
+
+	if Config.Input == "" {
+		LogHelp.NewLog(LogHelp.Error, "no CSV file given, set -input", nil).Log()
+		os.Exit(2)
+	}
+	var input io.Reader = os.Stdin
+	source := "stdin"
+	if Config.Input != "-" {
+		file, err := os.Open(Config.Input)
+		if err != nil {
+			LogHelp.NewLog(LogHelp.Error, "cannot open CSV file", map[string]string{"error": err.Error(), "input": Config.Input}).Log()
+			os.Exit(2)
+		}
+		defer file.Close()
+		input, source = file, Config.Input
+	}
+
+	lockWait := time.Duration(Config.LockWaitSeconds) * time.Second
+	applied, err := StatsIO.Database.MigrateDataFolder(lockWait)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot import into the data folder, it is of an unknown version or cannot be migrated", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+	if len(applied) > 0 {
+		LogHelp.NewLog(LogHelp.Info, "migrated data folder", map[string]interface{}{"migrations": applied}).Log()
+	}
+
+	report, err := StatsIO.Database.ImportCsv(input, source, Config.DryRun, lockWait)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot import CSV file", map[string]string{"error": err.Error(), "input": source, "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	LogHelp.LogOnError("cannot write summary", nil, encoder.Encode(report))
+
+	if len(report.Unmatched) > 0 {
+		os.Exit(1)
+	}
+}
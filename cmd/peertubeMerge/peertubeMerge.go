@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/internal/Response"
+	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+)
+
+var Config struct {
+	Primary         string
+	Secondary       string
+	Rule            string
+	DryRun          bool
+	Verify          bool
+	LockWaitSeconds int
+}
+
+func init() {
+	flag.StringVar(&Config.Primary, "primary", "", "Data folder whose collections are preferred")
+	flag.StringVar(&Config.Secondary, "secondary", "", "Data folder merged into the collections of the primary one")
+	flag.StringVar(&Config.Rule, "rule", StatsIO.MergeKeepAll, "Rule resolving a day collected into both folders: "+strings.Join(StatsIO.MergeRules, ", "))
+	flag.BoolVar(&Config.DryRun, "dry-run", false, "Report the conflicts without writing the merged data folder")
+	flag.BoolVar(&Config.Verify, "verify", false, "Check the merged data folder for consistency, see peertubeFsck")
+	flag.IntVar(&Config.LockWaitSeconds, "lock-wait-seconds", int(StatsIO.DefaultCollectorLockWait.Seconds()), "Seconds to wait for a running collection to finish")
+}
+
+// summary is written to stdout after the merge.
+type summary struct {
+	StatsIO.MergeReport
+	Check *StatsIO.DataFolderReport `json:"check,omitempty"`
+}
+
+// peertubeMerge merges the data folders -primary and -secondary into the empty data folder -data-folder and prints a JSON summary to stdout.
+// The exit code is 0 on success, 1 if the merged data folder is inconsistent and 2 if the merge failed.
+func main() {
+	var err error
+	err = Response.ParseConfigFromEnvFile()
+	LogHelp.LogOnError("cannot parse configuration from env file", map[string]interface{}{"config": Config}, err)
+
+	err = Response.ParseConfigFromEnvironment()
+	LogHelp.LogOnError("cannot parse configuration from environment", map[string]interface{}{"config": Config}, err)
+
+	flag.Parse()
+	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": Config}).Log()
+
+	if Config.Primary == "" || Config.Secondary == "" {
+		LogHelp.NewLog(LogHelp.Error, "both -primary and -secondary are required", map[string]interface{}{"config": Config}).Log()
+		os.Exit(2)
+	}
+
+	var result summary
+	result.MergeReport, err = StatsIO.Database.MergeDataFolders(Config.Primary, Config.Secondary, Config.Rule, Config.DryRun, time.Duration(Config.LockWaitSeconds)*time.Second)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Error, "cannot merge data folders", map[string]string{"error": err.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+		os.Exit(2)
+	}
+	if Config.Verify && !Config.DryRun {
+		report, checkErr := StatsIO.Database.CheckDataFolder(false, 0)
+		if checkErr != nil {
+			LogHelp.NewLog(LogHelp.Error, "cannot check merged data folder", map[string]string{"error": checkErr.Error(), "dataFolder": StatsIO.Database.DataFolder}).Log()
+			os.Exit(2)
+		}
+		result.Check = &report
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	LogHelp.LogOnError("cannot write summary", nil, encoder.Encode(result))
+
+	if result.Check != nil && result.Check.Unresolved > 0 {
+		os.Exit(1)
+	}
+}
@@ -22,6 +22,7 @@ type configType struct {
 	MaxRequestSize                  int
 	RequestTimeoutSeconds           int
 	MaxConcurrentRequestConnections int
+	ReloadPollSeconds               int
 }
 
 // config is the struct containing the necessary options used to run this program
@@ -45,6 +46,7 @@ func init() {
 	flag.IntVar(&config.MaxRequestSize, "max-request-size", 1048576, "Max request size")
 	flag.IntVar(&config.RequestTimeoutSeconds, "request-timeout", -1, "Request timeout in seconds")
 	flag.IntVar(&config.MaxConcurrentRequestConnections, "max-concurrent-request-connections", 10, "Max concurrent request connections")
+	flag.IntVar(&config.ReloadPollSeconds, "reload-poll-seconds", 60, "Seconds between checks of the data folder for new collections, 0 disables reloading the data")
 
 	flag.StringVar(&apiConfig.ClientId, "api-client-id", "exampleID", "Client ID")
 	flag.StringVar(&apiConfig.ClientSecret, "api-client-secret", "exampleSecret", "Client Secret")
@@ -68,13 +70,22 @@ func main() {
 	flag.Parse()
 	LogHelp.NewLog(LogHelp.Debug, "after parsing the program arguments the config has been changed to", map[string]interface{}{"config": config})
 
-	StatsIO.Database.Init(nil)
+	err = StatsIO.Database.Init(nil)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Fatal, "cannot open the data folder", map[string]interface{}{"dataFolder": StatsIO.Database.DataFolder, "error": err.Error()}).Log()
+		println("error occurred during loading of the data folder")
+		panic(err)
+	}
 	StatsIO.Database.Api, err = peertubeApi.NewApiClient(apiConfig.ClientId, apiConfig.ClientSecret, apiConfig.Username, apiConfig.Password, apiConfig.Host, apiConfig.Protocol, peertubeApi.DEFAULT_RATE_LIMITS, nil)
 	if err != nil {
 		println("error occurred during initialization of API client")
 		panic(err)
 	}
 
+	if config.ReloadPollSeconds > 0 {
+		go StatsIO.Database.WatchDataFolder(context.Background(), time.Duration(config.ReloadPollSeconds)*time.Second)
+	}
+
 	http1Server := SetupHttpServer()
 
 	if LogHelp.PrintableLogLevel >= 3 {
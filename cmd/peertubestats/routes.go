@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
@@ -26,6 +27,8 @@ var routingTable = map[string]func(http.ResponseWriter, *http.Request){
 	"/static/":                 web.ServeStaticHTTPHandler,
 	"/Video/{id}":              singleVideoPage,
 	"/Video/csv":               csvDownload,
+	"/Video/metrics.json":      metricsDownload,
+	"/Cohort":                  cohortPage,
 	"/lazy-static/thumbnails/": http.FileServer(http.Dir(path.Join(StatsIO.Database.DataFolder, ""))).ServeHTTP,
 }
 
@@ -61,18 +64,21 @@ func csvDownload(writer http.ResponseWriter, request *http.Request) {
 	}
 	var requestParameters templates.FrontPageRequest
 	_ = Response.BindToStruct(request, &requestParameters)
+	// the engagement metrics are appended as extra columns if requested by the metrics parameter
+	metrics, _ := strconv.ParseBool(request.URL.Query().Get("metrics"))
 	data := StatsIO.CsvGenerate(StatsIO.CsvGenerateParameters{
 		Videos:          videos,
 		DisplaySettings: requestParameters,
 		TargetLang:      AcceptLanguage,
 		Scope: struct {
-			Views bool
-			Likes bool
-		}{Views: true},
+			Views   bool
+			Likes   bool
+			Metrics bool
+		}{Views: true, Metrics: metrics},
 	})
 
 	writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
-	writer.Header().Set("Content-Disposition", "attachment; filename=\"stats-from"+time.Now().Format("2006-01-02")+".csv\"")
+	writer.Header().Set("Content-Disposition", "attachment; filename=\"stats-from"+time.Now().In(StatsIO.Database.ReportingLocation()).Format("2006-01-02")+".csv\"")
 	writer.WriteHeader(http.StatusOK)
 
 	for _, row := range data {
@@ -82,6 +88,34 @@ func csvDownload(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// metricsDownload returns the engagement metrics of all videos, or of the video given by the id parameter, within the range of the request as JSON.
+func metricsDownload(writer http.ResponseWriter, request *http.Request) {
+	videos, err := StatsIO.GetAllVideos()
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		LogHelp.NewLog(LogHelp.Error, "cannot obtain videos", map[string]string{"error": err.Error()}).Log()
+		return
+	}
+	var requestParameters templates.FrontPageRequest
+	_ = Response.BindToStruct(request, &requestParameters)
+	requestParameters.HandleZeroDate(StatsIO.Database.ReportingLocation())
+	if id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64); err == nil {
+		video, err := StatsIO.GetVideo(id)
+		if err != nil {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		videos = []peertubeApi.VideoData{video}
+	}
+
+	metrics, err := StatsIO.ExportMetrics(videos, requestParameters)
+	LogHelp.LogOnError("cannot derive the metrics of the videos", nil, err)
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(writer).Encode(metrics)
+	LogHelp.LogOnError("cannot write metrics json", nil, err)
+}
+
 func singleVideoPage(writer http.ResponseWriter, request *http.Request) {
 	util := request.Context().Value(Response.UtilityIndex)
 	utility := util.(*Response.Utility)
@@ -99,52 +133,102 @@ func singleVideoPage(writer http.ResponseWriter, request *http.Request) {
 	var FrontPageForm templates.FrontPageRequest
 	err = Response.BindToStruct(request, &FrontPageForm)
 	LogHelp.LogOnError("cannot bind front page", map[string]interface{}{"videoID": videoId, "request": request}, err)
-	FrontPageForm.HandleZeroDate()
+	FrontPageForm.HandleZeroDate(StatsIO.Database.ReportingLocation())
+
+	comparison, err := StatsIO.ComparePeriods(video.ID, FrontPageForm)
+	LogHelp.LogOnError("cannot compare periods", map[string]interface{}{"videoID": video.ID}, err)
 
 	utility.ReplyTemplateWithData(writer, request, "singleVideo", struct {
-		Video   peertubeApi.VideoData
-		Request templates.FrontPageRequest
+		Video      peertubeApi.VideoData
+		Request    templates.FrontPageRequest
+		Comparison StatsIO.PeriodComparison
 	}{
-		Request: FrontPageForm,
-		Video:   video,
+		Request:    FrontPageForm,
+		Video:      video,
+		Comparison: comparison,
 	})
 	request.Close = true
 }
 
+// leaderboardSize is the number of entries shown in the leaderboard of the index page.
+const leaderboardSize = 10
+
 func VideoIndex(writer http.ResponseWriter, request *http.Request) {
 	util := request.Context().Value(Response.UtilityIndex)
 	utility := util.(*Response.Utility)
 
 	var AllVideos, err = StatsIO.GetAllVideos()
-	var Videos []peertubeApi.VideoData
 	if err != nil {
 		LogHelp.NewLog(LogHelp.Fatal, "cannot load video database", map[string]interface{}{"error": err.Error()}).Log()
 		os.Exit(2)
 	}
 	var FrontPageForm templates.FrontPageRequest
 	err = Response.BindToStruct(request, &FrontPageForm)
-	FrontPageForm.HandleZeroDate()
+	FrontPageForm.HandleZeroDate(StatsIO.Database.ReportingLocation())
 	LogHelp.LogOnError("cannot bind reuest to struct", map[string]interface{}{"request": request, "struct": FrontPageForm}, err)
 
+	// the videos found by a query are listed by their relevance, the others in the order of their ranking within the selected range
+	Videos, err := StatsIO.SearchVideos(FrontPageForm.Query, FrontPageForm.Filter)
+	LogHelp.LogOnError("cannot search videos", map[string]interface{}{"query": FrontPageForm.Query, "filter": FrontPageForm.Filter}, err)
+	videoRanking, err := StatsIO.Rank(Videos, FrontPageForm.Dates, templates.RankVideos, FrontPageForm.Rank)
+	LogHelp.LogOnError("cannot rank videos", nil, err)
 	if FrontPageForm.Query == "" {
-		Videos = AllVideos
-	} else {
-		FrontPageForm.Query = strings.ToLower(FrontPageForm.Query)
-		for _, video := range AllVideos {
-			if strings.Contains(strings.ToLower(video.Name), FrontPageForm.Query) || strings.Contains(strings.ToLower(video.Channel.Name), FrontPageForm.Query) || strings.Contains(strings.ToLower(video.Account.Name), FrontPageForm.Query) || strings.Contains(strings.ToLower(video.Channel.Name), FrontPageForm.Query) || strings.Contains(strings.ToLower(video.Category.Label), FrontPageForm.Query) || strings.Contains(strings.ToLower(video.TruncatedDescription), FrontPageForm.Query) {
-				Videos = append(Videos, video)
+		position := make(map[int64]int, len(videoRanking))
+		for i, entry := range videoRanking {
+			position[entry.VideoID] = i
+		}
+		// videos without a ranking, e.g. whose stats cannot be resolved, follow the ranked ones
+		rankOf := func(id int64) int {
+			if p, ok := position[id]; ok {
+				return p
 			}
+			return len(videoRanking)
 		}
+		sort.SliceStable(Videos, func(i, j int) bool { return rankOf(Videos[i].ID) < rankOf(Videos[j].ID) })
+	}
+
+	leaderboard := videoRanking
+	if FrontPageForm.RankGroup != templates.RankVideos {
+		leaderboard, err = StatsIO.Rank(Videos, FrontPageForm.Dates, FrontPageForm.RankGroup, FrontPageForm.Rank)
+		LogHelp.LogOnError("cannot rank videos by group", map[string]interface{}{"group": FrontPageForm.RankGroup}, err)
 	}
-	sort.Slice(Videos, func(i, j int) bool { return Videos[i].Views > Videos[j].Views })
+	leaderboard = StatsIO.TopRanked(leaderboard, leaderboardSize)
+	StatsIO.ForecastRanking(leaderboard, Videos, FrontPageForm)
 
 	var summaryBucket []StatsIO.VideoStat
+	var TotalViews, TotalLikes, ViewsGained, LikesGained int64
+	var Comparison StatsIO.PeriodComparison
+	// the comparison of each video is shown on its card, the summary adds them up
+	comparisons := make(map[int64]StatsIO.PeriodComparison, len(Videos))
 	for _, video := range Videos {
-		currentBucket, err := StatsIO.ExportStats(video.ID, FrontPageForm.Dates, FrontPageForm.Timeframe)
+		comparison, err := StatsIO.ComparePeriods(video.ID, FrontPageForm)
+		LogHelp.LogOnError("cannot compare periods", map[string]interface{}{"VideoID": video.ID}, err)
+		comparisons[video.ID] = comparison
+		Comparison.Add(comparison)
+
+		cumulativeBucket, err := StatsIO.ExportStats(video.ID, FrontPageForm.Dates, FrontPageForm.Interval())
 		if err != nil {
 			LogHelp.LogOnError("cannot export stats", map[string]interface{}{"VideoID": video.ID}, err)
 			return
 		}
+		deltaBucket, err := StatsIO.ExportDeltaStats(video.ID, FrontPageForm.Dates, FrontPageForm.Interval())
+		if err != nil {
+			LogHelp.LogOnError("cannot export delta stats", map[string]interface{}{"VideoID": video.ID}, err)
+			return
+		}
+		if len(cumulativeBucket) > 0 {
+			TotalViews += cumulativeBucket[len(cumulativeBucket)-1].Views.Data
+			TotalLikes += cumulativeBucket[len(cumulativeBucket)-1].Likes.Data
+		}
+		for _, delta := range deltaBucket {
+			ViewsGained += delta.Views.Data
+			LikesGained += delta.Likes.Data
+		}
+
+		currentBucket := cumulativeBucket
+		if FrontPageForm.Mode == templates.ModeDelta {
+			currentBucket = deltaBucket
+		}
 		if len(summaryBucket) == 0 {
 			summaryBucket = make([]StatsIO.VideoStat, len(currentBucket))
 		}
@@ -156,16 +240,74 @@ func VideoIndex(writer http.ResponseWriter, request *http.Request) {
 			}
 			summaryBucket[index].Views.Data += val.Views.Data
 			summaryBucket[index].Likes.Data += val.Likes.Data
+			summaryBucket[index].Estimated = summaryBucket[index].Estimated || val.Estimated
+			summaryBucket[index].Unknown = summaryBucket[index].Unknown || val.Unknown
+			summaryBucket[index].Backfilled = summaryBucket[index].Backfilled || val.Backfilled
+			summaryBucket[index].Imported = summaryBucket[index].Imported || val.Imported
 		}
 	}
 
 	summaryBucket = StatsIO.PrepareStatsBucketWithAverages(summaryBucket)
-	TotalViews := summaryBucket[max(0, len(summaryBucket)-1)].Views.Data
-	TotalLikes := summaryBucket[max(0, len(summaryBucket)-1)].Likes.Data
-	utility.ReplyTemplateWithData(writer, request, "index", map[string]interface{}{"Request": FrontPageForm, "Videos": Videos, "Summary": struct {
-		Chart         []StatsIO.VideoStat
-		TotalViews    int64
-		TotalLikes    int64
-		LikeViewRatio float64
-	}{Chart: summaryBucket, TotalViews: TotalViews, TotalLikes: TotalLikes, LikeViewRatio: float64(TotalLikes) / float64(max(1, TotalViews))}})
+	metrics, err := StatsIO.RangeMetrics(Videos, FrontPageForm.Dates)
+	LogHelp.LogOnError("cannot derive the metrics of the videos", nil, err)
+	utility.ReplyTemplateWithData(writer, request, "index", map[string]interface{}{"Request": FrontPageForm, "Videos": Videos, "FilterOptions": StatsIO.VideoFilterOptions(AllVideos), "Leaderboard": leaderboard, "Comparisons": comparisons, "Summary": struct {
+		Chart       []StatsIO.VideoStat
+		TotalViews  int64
+		TotalLikes  int64
+		ViewsGained int64
+		LikesGained int64
+		Metrics     StatsIO.EngagementMetrics
+		Comparison  StatsIO.PeriodComparison
+	}{Chart: summaryBucket, TotalViews: TotalViews, TotalLikes: TotalLikes, ViewsGained: ViewsGained, LikesGained: LikesGained, Metrics: metrics, Comparison: Comparison}})
+}
+
+// cohortPage compares the first days after the publication of the selected videos, or of all videos of a channel.
+func cohortPage(writer http.ResponseWriter, request *http.Request) {
+	util := request.Context().Value(Response.UtilityIndex)
+	utility := util.(*Response.Utility)
+
+	AllVideos, err := StatsIO.GetAllVideos()
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		LogHelp.NewLog(LogHelp.Error, "cannot obtain videos", map[string]string{"error": err.Error()}).Log()
+		return
+	}
+	var CohortForm templates.CohortRequest
+	err = Response.BindToStruct(request, &CohortForm)
+	LogHelp.LogOnError("cannot bind cohort request", map[string]interface{}{"request": request}, err)
+	CohortForm.Normalize()
+
+	sort.SliceStable(AllVideos, func(i, j int) bool { return strings.ToLower(AllVideos[i].Name) < strings.ToLower(AllVideos[j].Name) })
+	var Channels []peertubeApi.Channel
+	knownChannels := make(map[int64]bool)
+	var Videos []peertubeApi.VideoData
+	for _, video := range AllVideos {
+		if !knownChannels[video.Channel.ID] {
+			knownChannels[video.Channel.ID] = true
+			Channels = append(Channels, video.Channel)
+		}
+		if len(CohortForm.Videos) > 0 && !CohortForm.Selected(video.ID) {
+			continue
+		}
+		if CohortForm.Channel != 0 && video.Channel.ID != CohortForm.Channel {
+			continue
+		}
+		Videos = append(Videos, video)
+	}
+	sort.SliceStable(Channels, func(i, j int) bool {
+		return strings.ToLower(Channels[i].DisplayName) < strings.ToLower(Channels[j].DisplayName)
+	})
+
+	curves, err := StatsIO.CohortCurves(Videos, CohortForm.Days)
+	LogHelp.LogOnError("cannot build the curves of the cohort", map[string]interface{}{"request": CohortForm}, err)
+	bands := StatsIO.CohortBands(curves, CohortForm.Metric, CohortForm.Days)
+
+	utility.ReplyTemplateWithData(writer, request, "cohort", map[string]interface{}{
+		"Request":    CohortForm,
+		"CohortDays": templates.CohortDays,
+		"Videos":     AllVideos,
+		"Channels":   Channels,
+		"Bands":      bands,
+		"Comparison": StatsIO.CompareCohort(curves, bands, CohortForm.Metric),
+	})
 }
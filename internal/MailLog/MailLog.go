@@ -40,6 +40,21 @@ func init() {
 // NOTE: maybe implement a warning in the frontend when this occurs and or fails
 func SendPanic(panicMail mail.PanicMail) (err error) {
 	println("[PANIC] panicMail being sent")
+	err = os.WriteFile("peertube-stats-log-from-"+time.Now().Format("2006-01-02-Time-15-04-05"+".txt"), LogBuffer.Bytes(), 0600)
+	if err != nil {
+		println(err.Error())
+	}
+
+	return sendMail("fatal", panicMail)
+}
+
+// SendAnomalies notifies the administrators of the view spikes detected after a collection.
+func SendAnomalies(anomalyMail mail.AnomalyMail) error {
+	return sendMail("anomalyTemplate", anomalyMail)
+}
+
+// sendMail executes the mail template with the data and sends it to the administrators.
+func sendMail(templateName string, data interface{}) (err error) {
 	// Send to
 	var mailAddresses []*goMail.Address
 	mailAddresses, err = goMail.ParseAddressList(SmtpConf.ToAddress)
@@ -61,18 +76,12 @@ func SendPanic(panicMail mail.PanicMail) (err error) {
 
 	message.WriteString("From: " + SmtpConf.FromAddress + "\r\n")
 	message.WriteString("To: " + strings.Join(mailAddressStrings, ",") + "\r\n")
-	err = mail.Templates.ExecuteTemplate(message, "fatal", panicMail)
+	err = mail.Templates.ExecuteTemplate(message, templateName, data)
 	if err != nil {
 		return
 	}
 
-	err = os.WriteFile("peertube-stats-log-from-"+time.Now().Format("2006-01-02-Time-15-04-05"+".txt"), LogBuffer.Bytes(), 0600)
-	if err != nil {
-		println(err.Error())
-	}
-
-	err = smtp.SendMail(SmtpConf.Host+":"+strconv.Itoa(SmtpConf.Port), auth, SmtpConf.FromAddress, mailAddressStrings, message.Bytes())
-	return err
+	return smtp.SendMail(SmtpConf.Host+":"+strconv.Itoa(SmtpConf.Port), auth, SmtpConf.FromAddress, mailAddressStrings, message.Bytes())
 }
 
 // SendMailOnFatalLog reads the log type of each log message and sends a panic mail when a fatal log message was recorded.
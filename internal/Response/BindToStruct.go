@@ -38,6 +38,10 @@ func BindToStruct(r *http.Request, dest interface{}) error {
 
 		paramValue := query.Get(paramName)
 		fieldValue := v.Field(i)
+		if field.Type.Kind() == reflect.Slice {
+			// a parameter can be repeated, e.g. by a multiple select, the values are joined like a comma-separated value
+			paramValue = strings.Join(query[paramName], ",")
+		}
 
 		if paramValue == "" {
 			if field.Type.Kind() == reflect.Struct {
@@ -0,0 +1,221 @@
+package StatsIO
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// The severities of an anomaly, ordered from the weakest to the strongest.
+const (
+	// AnomalyNotable is a gain scoring at least StatsIO.AnomalyThreshold.
+	AnomalyNotable = "notable"
+	// AnomalyHigh is a gain scoring at least twice the threshold.
+	AnomalyHigh = "high"
+	// AnomalyExtreme is a gain scoring at least three times the threshold.
+	AnomalyExtreme = "extreme"
+)
+
+// anomalySeverities lists the severities by strength, see AnomalyEvent.Severity.
+var anomalySeverities = []string{AnomalyNotable, AnomalyHigh, AnomalyExtreme}
+
+const (
+	// anomalyBaselineDays is the number of days before a day whose gains form its baseline.
+	anomalyBaselineDays = 28
+	// anomalyMinimumBaseline is the number of collected days a baseline needs, younger series are not checked.
+	anomalyMinimumBaseline = 7
+)
+
+// AnomalyEvent is a day on which a video gained unusually many views compared to its baseline.
+type AnomalyEvent struct {
+	VideoID int64 `json:"video_id"`
+	// Time is the reporting day of the anomaly.
+	Time time.Time `json:"time"`
+	// ViewsGained is the number of views gained per day since the previous collected day.
+	ViewsGained float64 `json:"views_gained"`
+	// Baseline is the median of the views gained per day within the anomalyBaselineDays before Time.
+	Baseline float64 `json:"baseline"`
+	// Score is the robust z-score of ViewsGained, the distance to the baseline in scaled median absolute deviations.
+	Score    float64 `json:"score"`
+	Severity string  `json:"severity"`
+}
+
+// dailyGain is the number of views a video gained per day between the previous collected day and Day.
+type dailyGain struct {
+	Day   time.Time
+	Views float64
+}
+
+// DetectAnomalies returns the view spikes of a video on the days within Dates, oldest first.
+// The views gained on a day are scored against the median of the views gained on the days before it, see AnomalyEvent.
+// Days without a collection, or on which the video was not visible, are neither scored nor part of a baseline.
+func DetectAnomalies(videoID int64, Dates Timeframe) []AnomalyEvent {
+	end := lastReportingDay(Dates)
+	start := Database.ReportingDay(Dates.GetStartDate())
+	if Dates.GetStartDate().IsZero() || end.Before(start) {
+		start = end
+	}
+	return detectAnomalies(videoID, start, end, unitEnd(end, templates.TimeframeDaily))
+}
+
+// detectAnomalies scores the days from start to end, only the collections made until the given time are considered.
+func detectAnomalies(videoID int64, start, end, until time.Time) (events []AnomalyEvent) {
+	gains := dailyGains(videoID, start.AddDate(0, 0, -anomalyBaselineDays-1), until)
+	for i, gain := range gains {
+		if gain.Day.Before(start) || gain.Day.After(end) {
+			continue
+		}
+		windowStart := gain.Day.AddDate(0, 0, -anomalyBaselineDays)
+		var baseline []float64
+		for _, previous := range gains[:i] {
+			if !previous.Day.Before(windowStart) {
+				baseline = append(baseline, previous.Views)
+			}
+		}
+		if len(baseline) < anomalyMinimumBaseline {
+			continue
+		}
+		score, median := robustScore(gain.Views, baseline)
+		if score < Database.AnomalyThreshold || gain.Views-median < float64(Database.AnomalyMinimumViews) {
+			continue
+		}
+		events = append(events, AnomalyEvent{
+			VideoID:     videoID,
+			Time:        gain.Day,
+			ViewsGained: gain.Views,
+			Baseline:    median,
+			Score:       score,
+			Severity:    anomalySeverity(score),
+		})
+	}
+	return events
+}
+
+// dailyGains returns the views gained per day by a video, for each reporting day with a collection between from and until.
+// The gain is spread evenly over the days since the previous collected day.
+func dailyGains(videoID int64, from, until time.Time) (gains []dailyGain) {
+	days, counters := collectedDays(videoID, from, until)
+	for i := 1; i < len(days); i++ {
+		elapsed := calendarDay(days[i]) - calendarDay(days[i-1])
+		gains = append(gains, dailyGain{Day: days[i], Views: float64(counterIncrease(counters[i-1].Views, counters[i].Views)) / float64(elapsed)})
+	}
+	return gains
+}
+
+// collectedDays returns the reporting days with a collection of a video between from and until, and the likes and views of the last collection of each day.
+// Collections in which the video was not visible are left out.
+func collectedDays(videoID int64, from, until time.Time) (days []time.Time, counters []LikeView) {
+	series, timeSeries := getVideoTimeSeries(videoID), Database.current().timeSeries
+	if series == nil || timeSeries == nil {
+		return nil, nil
+	}
+	collections := timeSeries.Collections
+	first := sort.Search(len(collections), func(i int) bool { return !collections[i].Before(from) })
+
+	for _, collection := range collections[first:] {
+		if collection.After(until) {
+			break
+		}
+		if collection.Before(series.Earliest) || collection.After(series.Latest) || GetVideoLifecycle(videoID).MissingAt(collection) {
+			continue
+		}
+		day := Database.ReportingDay(collection)
+		if len(days) > 0 && days[len(days)-1].Equal(day) {
+			counters[len(counters)-1] = series.At(collection)
+			continue
+		}
+		days = append(days, day)
+		counters = append(counters, series.At(collection))
+	}
+	return days, counters
+}
+
+// robustScore returns the robust z-score of value within baseline, and the median of the baseline.
+// The median absolute deviation is scaled to a standard deviation, it is at least the square root of the median,
+// the noise expected of a count, and at least one view.
+func robustScore(value float64, baseline []float64) (score float64, median float64) {
+	median = medianOf(baseline)
+	deviations := make([]float64, len(baseline))
+	for i, sample := range baseline {
+		deviations[i] = math.Abs(sample - median)
+	}
+	scale := max(1.4826*medianOf(deviations), math.Sqrt(median), 1)
+	return (value - median) / scale, median
+}
+
+// medianOf returns the median of the values, the values are not modified.
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// anomalySeverity returns the severity of an anomaly with the given score.
+func anomalySeverity(score float64) string {
+	switch {
+	case score >= 3*Database.AnomalyThreshold:
+		return AnomalyExtreme
+	case score >= 2*Database.AnomalyThreshold:
+		return AnomalyHigh
+	}
+	return AnomalyNotable
+}
+
+// markAnomalies sets the severity of the strongest anomaly within each bucket, see VideoStat.Anomaly.
+// A bucket holds the units after the last unit of the previous bucket up to its own last unit, see bucketTimestamps.
+func markAnomalies(bucket []VideoStat, events []AnomalyEvent, Timeframe string) {
+	timeframe, _ := templates.ParseTimeframe(Timeframe)
+	for _, event := range events {
+		// the gain of a day is known at its end, in the Hourly timeframe it is marked at the last hour of the day.
+		dayEnd := unitEnd(event.Time, templates.TimeframeDaily)
+		position := sort.Search(len(bucket), func(i int) bool { return !unitEnd(bucket[i].Time, timeframe).Before(dayEnd) })
+		if position == len(bucket) && position > 0 && !bucket[position-1].Time.Before(event.Time) {
+			// the last bucket ends within the day of the anomaly
+			position--
+		}
+		if position == len(bucket) {
+			continue
+		}
+		if slices.Index(anomalySeverities, event.Severity) > slices.Index(anomalySeverities, bucket[position].Anomaly) {
+			bucket[position].Anomaly = event.Severity
+		}
+	}
+}
+
+// CollectionAnomalies returns the anomalies of the reporting day of a collection, that were not already detected by an earlier collection of that day.
+// It is used to notify the administrators once after each collection.
+func CollectionAnomalies(collectionTime time.Time) (events []AnomalyEvent) {
+	timeSeries := Database.current().timeSeries
+	if timeSeries == nil || timeSeries.Video == nil {
+		return nil
+	}
+	collectionTime = Database.CollectionTimestamp(collectionTime)
+	day := Database.ReportingDay(collectionTime)
+	var previous time.Time
+	collections := timeSeries.Collections
+	if position, _ := slices.BinarySearchFunc(collections, collectionTime, time.Time.Compare); position > 0 && !collections[position-1].Before(day) {
+		previous = collections[position-1]
+	}
+
+	timeSeries.Video.Range(func(key, _ interface{}) bool {
+		id := key.(int64)
+		detected := detectAnomalies(id, day, day, collectionTime)
+		if len(detected) == 0 || (!previous.IsZero() && len(detectAnomalies(id, day, day, previous)) > 0) {
+			return true
+		}
+		events = append(events, detected...)
+		return true
+	})
+	slices.SortFunc(events, func(a, b AnomalyEvent) int { return cmp.Compare(b.Score, a.Score) })
+	return events
+}
@@ -0,0 +1,126 @@
+package StatsIO
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// anomalyDatabase returns a database of one video, collected at the given times with the given views.
+func anomalyDatabase(collections []time.Time, views []int64) StatsIO {
+	var series VideoTimeSeries
+	for i, collection := range collections {
+		_ = series.insert(collection, LikeView{Views: views[i]})
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &series)
+	return StatsIO{
+		Location:            time.UTC,
+		MissingDataPolicy:   MissingDataCarryForward,
+		AnomalyThreshold:    3.5,
+		AnomalyMinimumViews: 20,
+		loaded:              publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections}}),
+	}
+}
+
+// steadyViews returns the collections of days 0 to days-1 at noon, the video gains about 100 views each day.
+// The days in skip are not collected.
+func steadyViews(days int, skip ...int) (collections []time.Time, views []int64) {
+	var total int64
+	for day := range days {
+		total += 95 + int64(day%3)*5
+		skipped := false
+		for _, s := range skip {
+			skipped = skipped || s == day
+		}
+		if skipped {
+			continue
+		}
+		collections = append(collections, sampleDay(day).Add(12*time.Hour))
+		views = append(views, total)
+	}
+	return collections, views
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	tests := []struct {
+		name         string
+		spike        int64
+		skip         []int
+		wantSeverity string
+	}{
+		{"steady gains", 0, nil, ""},
+		{"gap in the collections", 0, []int{10, 11, 12}, ""},
+		{"small spike", 20, nil, ""},
+		{"notable spike", 50, nil, AnomalyNotable},
+		{"extreme spike", 1000, nil, AnomalyExtreme},
+		{"spike after a gap", 1000, []int{18, 19}, AnomalyExtreme},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collections, views := steadyViews(25, tt.skip...)
+			for i, collection := range collections {
+				if !collection.Before(sampleDay(20)) {
+					views[i] += tt.spike
+				}
+			}
+			Database = anomalyDatabase(collections, views)
+
+			got := DetectAnomalies(1, templates.TwoDateForm{StartDate: sampleDay(0), EndDate: sampleDay(24)})
+			if tt.wantSeverity == "" {
+				if len(got) != 0 {
+					t.Fatalf("DetectAnomalies() = %+v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || !got[0].Time.Equal(sampleDay(20)) || got[0].Severity != tt.wantSeverity {
+				t.Fatalf("DetectAnomalies() = %+v, want one %s anomaly on %v", got, tt.wantSeverity, sampleDay(20))
+			}
+		})
+	}
+}
+
+func TestCollectionAnomalies(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	collections, views := steadyViews(20)
+	morning, evening := sampleDay(20).Add(6*time.Hour), sampleDay(20).Add(18*time.Hour)
+	collections = append(collections, morning, evening)
+	views = append(views, views[len(views)-1]+1000, views[len(views)-1]+1100)
+	Database = anomalyDatabase(collections, views)
+
+	if got := CollectionAnomalies(morning); len(got) != 1 || got[0].VideoID != 1 {
+		t.Errorf("CollectionAnomalies() of the first collection = %+v, want the spike", got)
+	}
+	if got := CollectionAnomalies(evening); len(got) != 0 {
+		t.Errorf("CollectionAnomalies() of the second collection = %+v, want none, the spike was already detected", got)
+	}
+}
+
+func Test_markAnomalies(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{Location: time.UTC, WeekStart: time.Monday}
+
+	// the weekly buckets of 2025-01-06 to 2025-01-26 are labeled with their last day.
+	bucket := []VideoStat{{Time: sampleDay(11)}, {Time: sampleDay(18)}, {Time: sampleDay(25)}}
+	markAnomalies(bucket, []AnomalyEvent{
+		{Time: sampleDay(12), Severity: AnomalyExtreme},
+		{Time: sampleDay(14), Severity: AnomalyNotable},
+		{Time: sampleDay(15), Severity: AnomalyHigh},
+		{Time: sampleDay(30), Severity: AnomalyHigh},
+	}, templates.TimeframeWeekly)
+
+	want := []string{"", AnomalyExtreme, ""}
+	for i := range bucket {
+		if bucket[i].Anomaly != want[i] {
+			t.Errorf("markAnomalies() bucket %d = %q, want %q", i, bucket[i].Anomaly, want[i])
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package StatsIO
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+// BackfillFileName is the file within the data folder that records the collections backfilled from the statistics of PeerTube.
+const BackfillFileName = "backfill.json"
+
+// backfillHeaderSuffix follows the API version in the header of a backfilled raw file.
+const backfillHeaderSuffix = " (backfilled from the viewers statistics)"
+
+// BackfillRecord is the content of backfill.json.
+type BackfillRecord struct {
+	// Collections are the backfilled collections, oldest first. Their raw files hold synthetic stats, one collection at the end of each day.
+	Collections []time.Time `json:"collections"`
+	// Until is the first real collection, the backfilled views are counted back from it.
+	Until        time.Time `json:"until"`
+	BackfilledAt time.Time `json:"backfilled_at"`
+}
+
+// BackfillReport describes a backfill, see Backfill.
+type BackfillReport struct {
+	DataFolder string    `json:"data_folder"`
+	From       time.Time `json:"from"`
+	Until      time.Time `json:"until"`
+	DryRun     bool      `json:"dry_run"`
+	// Collections is the number of days written, days that already hold a backfilled collection are kept.
+	Collections int `json:"collections"`
+	Videos      int `json:"videos"`
+	// Failed maps the id of a video whose statistics could not be requested to the error, the video is not backfilled.
+	Failed map[int64]string `json:"failed"`
+}
+
+// ViewersTimeserie requests the viewers of a video between start and end, see peertubeApi.ApiClient.GetVideoStatsTimeserie.
+type ViewersTimeserie func(id int64, start, end time.Time) (peertubeApi.VideoStatsTimeserie, error)
+
+// ReadBackfillRecord returns the backfilled collections of the data folder, a data folder without backfill.json has none.
+func ReadBackfillRecord(dataFolder string) (record BackfillRecord, err error) {
+	recordBytes, err := os.ReadFile(path.Join(dataFolder, BackfillFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return BackfillRecord{Collections: []time.Time{}}, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(recordBytes, &record)
+	}
+	if err != nil {
+		return record, errors.Join(errors.New("cannot read the backfilled collections"), err)
+	}
+	return record, nil
+}
+
+// writeBackfillRecord writes backfill.json to the data folder.
+func writeBackfillRecord(dataFolder string, record BackfillRecord) error {
+	recordBytes, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path.Join(dataFolder, BackfillFileName), recordBytes)
+}
+
+// Backfill writes a synthetic collection for each day from `from` until the day before the first real collection, from
+// the viewers PeerTube recorded for each video. The views of a day are the views of the first real collection, less the
+// viewers gained after the day. PeerTube keeps no history of the likes, they are the ones of the first real collection.
+// A video is backfilled from the day it was published on, a zero from starts with the earliest publication.
+// The backfilled collections are recorded in backfill.json and flagged in the header of their raw files, the derived files
+// are rebuilt from all raw files afterward. The collector lock is held during the backfill.
+// If dryRun is set, the statistics are requested without writing anything.
+func (statIO *StatsIO) Backfill(viewers ViewersTimeserie, from time.Time, dryRun bool, lockWait time.Duration) (report BackfillReport, err error) {
+	report = BackfillReport{DataFolder: statIO.DataFolder, DryRun: dryRun, Failed: map[int64]string{}}
+	if !dryRun {
+		unlock, lockErr := statIO.LockCollector(lockWait)
+		if lockErr != nil {
+			return report, lockErr
+		}
+		defer func() {
+			LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+		}()
+	}
+
+	record, err := ReadBackfillRecord(statIO.DataFolder)
+	if err != nil {
+		return report, err
+	}
+	collections := listRawFiles()
+	partial := partialCollections(statIO.DataFolder)
+	realCollections := slices.DeleteFunc(slices.Clone(collections), func(collection time.Time) bool { return isCollection(partial, collection) })
+	if len(realCollections) == 0 {
+		return report, errors.New("the data folder holds no collection to count the views back from")
+	}
+	report.Until = realCollections[0]
+	firstPath := getRawFilePath(report.Until)
+	videos, err := parseRawFile(firstPath)
+	if err != nil {
+		return report, errors.Join(errors.New("cannot read the first collection"), err)
+	}
+	slices.SortFunc(videos, func(a, b peertubeApi.VideoData) int { return cmp.Compare(a.ID, b.ID) })
+
+	lastDay := statIO.ReportingDay(report.Until).AddDate(0, 0, -1)
+	if from.IsZero() {
+		for _, video := range videos {
+			if published, publishedErr := video.GetPublishedAt(); publishedErr == nil && (from.IsZero() || published.Before(from)) {
+				from = published
+			}
+		}
+	}
+	report.From = statIO.ReportingDay(from)
+	if from.IsZero() || report.From.After(lastDay) {
+		return report, nil
+	}
+
+	// days maps the reporting day of each backfilled collection to the videos published until its end
+	days := map[time.Time][]peertubeApi.VideoData{}
+	for _, video := range videos {
+		start := report.From
+		if published, publishedErr := video.GetPublishedAt(); publishedErr == nil && statIO.ReportingDay(published).After(start) {
+			start = statIO.ReportingDay(published)
+		}
+		if start.After(lastDay) {
+			continue
+		}
+		timeserie, requestErr := viewers(video.ID, start, report.Until)
+		if requestErr != nil {
+			report.Failed[video.ID] = requestErr.Error()
+			continue
+		}
+		for day, views := range backfillViews(timeserie, video.Views, start, report.Until) {
+			backfilled := video
+			backfilled.Views = views
+			days[day] = append(days[day], backfilled)
+		}
+		report.Videos++
+	}
+
+	var backfilledDays []time.Time
+	for day := range days {
+		if !slices.ContainsFunc(collections, func(collection time.Time) bool { return statIO.ReportingDay(collection).Equal(day) }) {
+			backfilledDays = append(backfilledDays, day)
+		}
+	}
+	slices.SortFunc(backfilledDays, time.Time.Compare)
+	report.Collections = len(backfilledDays)
+	if dryRun || len(backfilledDays) == 0 {
+		return report, nil
+	}
+
+	header := rawHeaderPrefix + rawFileVersion(firstPath) + backfillHeaderSuffix + "\r\n"
+	for _, day := range backfilledDays {
+		// the collection holds the views at the end of its day
+		collectionTime := day.AddDate(0, 0, 1).Add(-time.Minute)
+		content, marshalErr := json.Marshal(peertubeApi.VideoResponse{Total: int64(len(days[day])), Data: days[day]})
+		if marshalErr != nil {
+			return report, marshalErr
+		}
+		rawPath := rawFilePathIn(statIO.DataFolder, collectionTime)
+		if err = os.MkdirAll(path.Dir(rawPath), 0700); err == nil {
+			err = writeFileAtomically(rawPath, append([]byte(header), content...))
+		}
+		if err != nil {
+			return report, errors.Join(errors.New("cannot write backfilled raw file"), err)
+		}
+		record.Collections = append(record.Collections, statIO.CollectionTimestamp(collectionTime))
+	}
+	slices.SortFunc(record.Collections, time.Time.Compare)
+	record.Until, record.BackfilledAt = report.Until, time.Now()
+	if err = writeBackfillRecord(statIO.DataFolder, record); err != nil {
+		return report, errors.Join(errors.New("cannot record the backfilled collections"), err)
+	}
+	if _, err = statIO.rebuildDerivedFiles(listRawFiles()); err != nil {
+		return report, errors.Join(errors.New("cannot rebuild the backfilled data folder"), err)
+	}
+	statIO.update(func(loaded *loadedData) { loaded.backfilled = record.Collections })
+	return report, nil
+}
+
+// backfillViews returns the views of a video at the end of each reporting day from start until the day before until.
+// The viewers are summed by the reporting day they were recorded on, whatever interval PeerTube grouped them by.
+func backfillViews(timeserie peertubeApi.VideoStatsTimeserie, viewsAtUntil int64, start, until time.Time) map[time.Time]int64 {
+	lastDay := Database.ReportingDay(until).AddDate(0, 0, -1)
+	gained := map[time.Time]int64{}
+	// views is the count at the end of lastDay, less the viewers gained on the day of until before it was collected
+	views := viewsAtUntil
+	for _, value := range timeserie.Data {
+		date, err := value.GetDate()
+		if err != nil || date.After(until) {
+			continue
+		}
+		if day := Database.ReportingDay(date); day.After(lastDay) {
+			views -= int64(value.Value)
+		} else {
+			gained[day] += int64(value.Value)
+		}
+	}
+	result := map[time.Time]int64{}
+	for day := lastDay; !day.Before(start); day = day.AddDate(0, 0, -1) {
+		result[day] = max(0, views)
+		views -= gained[day]
+	}
+	return result
+}
+
+// partialCollections returns the backfilled and the imported collections of the data folder, sorted.
+// They hold only some of the videos, see mergeVideoDB.
+func partialCollections(dataFolder string) []time.Time {
+	backfill, err := ReadBackfillRecord(dataFolder)
+	LogHelp.LogOnError("cannot read the backfilled collections", map[string]string{"dataFolder": dataFolder}, err)
+	imported, err := ReadImportRecord(dataFolder)
+	LogHelp.LogOnError("cannot read the imported collections", map[string]string{"dataFolder": dataFolder}, err)
+	partial := slices.Concat(backfill.Collections, imported.Collections)
+	slices.SortFunc(partial, time.Time.Compare)
+	return partial
+}
+
+// readFromCollections reports whether the stat of a video until the given time is read from one of the sorted collections,
+// e.g. a backfilled one.
+func readFromCollections(id int64, until time.Time, collections []time.Time) bool {
+	timeSeries := Database.current().timeSeries
+	if len(collections) == 0 || timeSeries == nil {
+		return false
+	}
+	position := sort.Search(len(timeSeries.Collections), func(i int) bool { return timeSeries.Collections[i].After(until) })
+	if position == 0 {
+		return false
+	}
+	collection := timeSeries.Collections[position-1]
+	series := getVideoTimeSeries(id)
+	if series == nil || collection.Before(series.Earliest) {
+		return false
+	}
+	return isCollection(collections, collection)
+}
@@ -0,0 +1,120 @@
+package StatsIO
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+func TestBackfill(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// the first collection was made at the noon of day 4, video 1 was published on day 0, video 2 on day 3.
+	// the statistics of video 3 are not available.
+	firstCollection := `# Peertube API Version: 7.0.0` + "\r\n" + `{"total":3,"data":[` +
+		`{"id":1,"views":100,"likes":7,"publishedAt":"2025-01-01T10:00:00Z"},` +
+		`{"id":2,"views":10,"likes":1,"publishedAt":"2025-01-04T08:00:00Z"},` +
+		`{"id":3,"views":5,"likes":0,"publishedAt":"2025-01-02T08:00:00Z"}]}`
+	viewers := map[int64][]float64{1: {10, 20, 30, 15, 5}, 2: {0, 0, 0, 4, 2}}
+	timeserie := func(id int64, start, end time.Time) (peertubeApi.VideoStatsTimeserie, error) {
+		values, found := viewers[id]
+		if !found {
+			return peertubeApi.VideoStatsTimeserie{}, errors.New("http status: 403 Forbidden")
+		}
+		var result peertubeApi.VideoStatsTimeserie
+		for day, value := range values {
+			if date := sampleDay(day); !date.Before(start) {
+				result.Data = append(result.Data, peertubeApi.VideoStatsTimeserieValue{Date: date.Format(time.RFC3339Nano), Value: value})
+			}
+		}
+		return result, nil
+	}
+	setup := func(t *testing.T) {
+		Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataCarryForward}
+		if err := os.MkdirAll(filepath.Join(Database.DataFolder, "2025", "01"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(Database.DataFolder, "2025", "01", "05T1200.json"), []byte(firstCollection), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("backfill", func(t *testing.T) {
+		setup(t)
+		report, err := Database.Backfill(timeserie, time.Time{}, false, 0)
+		if err != nil || report.Collections != 4 || report.Videos != 2 || len(report.Failed) != 1 || !report.From.Equal(sampleDay(0)) {
+			t.Fatalf("Backfill() = %+v, %v, want 4 collections of 2 videos from day 0, video 3 failed", report, err)
+		}
+		wantCollections := []time.Time{sampleDay(0).Add(1439 * time.Minute), sampleDay(1).Add(1439 * time.Minute), sampleDay(2).Add(1439 * time.Minute), sampleDay(3).Add(1439 * time.Minute), sampleDay(4).Add(12 * time.Hour)}
+		if collections := listRawFiles(); !slices.EqualFunc(collections, wantCollections, time.Time.Equal) {
+			t.Errorf("collections = %v, want %v", collections, wantCollections)
+		}
+		if record, _ := ReadBackfillRecord(Database.DataFolder); len(record.Collections) != 4 || !record.Until.Equal(wantCollections[4]) {
+			t.Errorf("backfill record = %+v, want the 4 backfilled collections until the first collection", record)
+		}
+		if version := rawFileVersion(getRawFilePath(wantCollections[0])); version != "7.0.0" {
+			t.Errorf("version of the backfilled raw file = %q, want 7.0.0", version)
+		}
+
+		if err = Database.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			id             int64
+			day            int
+			wantViews      int64
+			wantLikes      int64
+			wantBackfilled bool
+		}{
+			{1, 0, 30, 7, true},
+			{1, 1, 50, 7, true},
+			{1, 3, 95, 7, true},
+			{1, 4, 100, 7, false},
+			{2, 2, 0, 0, false},
+			{2, 3, 8, 1, true},
+			{3, 3, 0, 0, false},
+			{3, 4, 5, 0, false},
+		}
+		for _, tt := range tests {
+			stat, err := requestTimestamp(sampleDay(tt.day), tt.id)
+			if err != nil || stat.Views.Data != tt.wantViews || stat.Likes.Data != tt.wantLikes || stat.Backfilled != tt.wantBackfilled {
+				t.Errorf("requestTimestamp(day %d, video %d) = %+v, %v, want %d views, %d likes, backfilled %v", tt.day, tt.id, stat, err, tt.wantViews, tt.wantLikes, tt.wantBackfilled)
+			}
+		}
+
+		check, err := Database.CheckDataFolder(false, 0)
+		if err != nil || check.Unresolved > 0 {
+			t.Errorf("CheckDataFolder() of the backfilled folder = %+v, %v, want it to be consistent", check.Issues, err)
+		}
+
+		// a second backfill keeps the backfilled days
+		report, err = Database.Backfill(timeserie, sampleDay(-3), false, 0)
+		if err != nil || report.Collections != 0 {
+			t.Errorf("second Backfill() = %+v, %v, want no new collection", report, err)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		setup(t)
+		report, err := Database.Backfill(timeserie, sampleDay(2), true, 0)
+		if err != nil || report.Collections != 2 || report.Videos != 2 {
+			t.Errorf("Backfill() = %+v, %v, want 2 collections of 2 videos", report, err)
+		}
+		if collections := listRawFiles(); len(collections) != 1 {
+			t.Errorf("a dry run wrote the collections %v", collections)
+		}
+	})
+
+	t.Run("nothing collected", func(t *testing.T) {
+		Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+		if _, err := Database.Backfill(timeserie, time.Time{}, false, 0); err == nil {
+			t.Error("Backfill() of an empty data folder succeeded")
+		}
+	})
+}
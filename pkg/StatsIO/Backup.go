@@ -0,0 +1,288 @@
+package StatsIO
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+)
+
+// BackupFormatVersion is the version of the layout of the backup archives written by Backup, Restore rejects other versions.
+// A backup archive is a gzip compressed tar file, holding the files of the data folder below data/ and the manifest as manifest.json.
+const BackupFormatVersion = 1
+
+const (
+	backupDataPrefix   = "data/"
+	backupManifestName = "manifest.json"
+)
+
+// BackupManifest describes the content of a backup archive.
+type BackupManifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	DataFolder    string    `json:"data_folder"`
+	// DataFolderVersion is the version of the layout of the backed up data folder, see DataFolderVersion.
+	DataFolderVersion int          `json:"data_folder_version"`
+	Files             []BackupFile `json:"files"`
+}
+
+// BackupFile is a file of the data folder within a backup archive, its path is relative to the data folder.
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Size returns the number of bytes of the files within the backup.
+func (manifest BackupManifest) Size() (size int64) {
+	for _, file := range manifest.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// Backup writes a backup archive of the data folder to w, the raw files, the databases, the time series and the thumbnails.
+// The collector lock is held while the data folder is read, waiting for up to lockWait for a running collection to finish.
+func (statIO *StatsIO) Backup(w io.Writer, lockWait time.Duration) (manifest BackupManifest, err error) {
+	unlock, err := statIO.LockCollector(lockWait)
+	if err != nil {
+		return manifest, err
+	}
+	defer func() {
+		LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+	}()
+
+	version, err := ReadDataFolderVersion(statIO.DataFolder)
+	if err != nil {
+		return manifest, err
+	}
+	manifest = BackupManifest{FormatVersion: BackupFormatVersion, CreatedAt: time.Now(), DataFolder: statIO.DataFolder, DataFolderVersion: version.Version, Files: []BackupFile{}}
+	compressor := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressor)
+	err = filepath.WalkDir(statIO.DataFolder, func(p string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relative, relErr := filepath.Rel(statIO.DataFolder, p)
+		if relErr != nil {
+			return relErr
+		}
+		relative = filepath.ToSlash(relative)
+		if entry.IsDir() || relative == CollectorLockFileName {
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			LogHelp.NewLog(LogHelp.Warn, "skipping file that is not a regular file", map[string]string{"path": p}).Log()
+			return nil
+		}
+		file, addErr := addBackupFile(archive, p, backupDataPrefix+relative)
+		if addErr != nil {
+			return addErr
+		}
+		file.Path = relative
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return manifest, errors.Join(errors.New("cannot back up data folder"), err)
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	err = archive.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0600, Size: int64(len(manifestBytes)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg})
+	if err == nil {
+		_, err = archive.Write(manifestBytes)
+	}
+	err = errors.Join(err, archive.Close(), compressor.Close())
+	if err != nil {
+		return manifest, errors.Join(errors.New("cannot write backup manifest"), err)
+	}
+	return manifest, nil
+}
+
+// BackupToFile writes a backup archive of the data folder to p, see Backup.
+// The archive is written next to p and renamed once it is complete.
+func (statIO *StatsIO) BackupToFile(p string, lockWait time.Duration) (manifest BackupManifest, err error) {
+	handle, err := os.OpenFile(p+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return manifest, errors.Join(errors.New("cannot create backup archive"), err)
+	}
+	manifest, err = statIO.Backup(handle, lockWait)
+	err = errors.Join(err, handle.Close())
+	if err == nil {
+		err = os.Rename(p+".tmp", p)
+	}
+	if err != nil {
+		_ = os.Remove(p + ".tmp")
+	}
+	return manifest, err
+}
+
+// addBackupFile adds the file at p to the archive under the given name and returns its size and checksum.
+func addBackupFile(archive *tar.Writer, p string, name string) (file BackupFile, err error) {
+	handle, err := os.Open(p)
+	if err != nil {
+		return file, err
+	}
+	defer handle.Close()
+	stat, err := handle.Stat()
+	if err != nil {
+		return file, err
+	}
+	err = archive.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: stat.Size(), ModTime: stat.ModTime(), Typeflag: tar.TypeReg})
+	if err != nil {
+		return file, err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(archive, hash), handle)
+	if err != nil {
+		return file, err
+	}
+	if written != stat.Size() {
+		return file, errors.New("file changed while it was backed up: " + p)
+	}
+	return BackupFile{Size: written, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Restore validates the backup archive read from r and replaces the data folder with its content.
+// The archive is extracted next to the data folder first, the data folder is only replaced once every file matches the manifest.
+// A data folder that holds files is only replaced if force is set, it is kept as previousFolder next to the restored one.
+// The collector lock of the data folder is held while it is replaced, waiting for up to lockWait for a running collection to finish.
+func (statIO *StatsIO) Restore(r io.Reader, force bool, lockWait time.Duration) (manifest BackupManifest, previousFolder string, err error) {
+	dataFolder := filepath.Clean(statIO.DataFolder)
+	suffix := time.Now().Format("20060102T150405")
+	stagingFolder := dataFolder + ".restore-" + suffix
+	manifest, err = extractBackup(r, stagingFolder)
+	if err != nil {
+		_ = os.RemoveAll(stagingFolder)
+		return manifest, "", errors.Join(errors.New("invalid backup archive"), err)
+	}
+
+	unlock, err := statIO.LockCollector(lockWait)
+	if err != nil {
+		_ = os.RemoveAll(stagingFolder)
+		return manifest, "", err
+	}
+	entries, _ := os.ReadDir(dataFolder)
+	if slices.ContainsFunc(entries, func(entry os.DirEntry) bool { return entry.Name() != CollectorLockFileName }) {
+		if !force {
+			_ = os.RemoveAll(stagingFolder)
+			return manifest, "", errors.Join(errors.New("the data folder is not empty, it is only replaced if forced: "+dataFolder), unlock())
+		}
+		previousFolder = dataFolder + ".before-restore-" + suffix
+		if err = os.Rename(dataFolder, previousFolder); err != nil {
+			_ = os.RemoveAll(stagingFolder)
+			return manifest, "", errors.Join(errors.New("cannot move the data folder aside"), err, unlock())
+		}
+		err = os.Rename(path.Join(previousFolder, CollectorLockFileName), path.Join(stagingFolder, CollectorLockFileName))
+	} else {
+		// the lock moves along with the restored data folder
+		err = os.Rename(path.Join(dataFolder, CollectorLockFileName), path.Join(stagingFolder, CollectorLockFileName))
+		if err == nil {
+			err = os.Remove(dataFolder)
+		}
+	}
+	if err == nil {
+		err = os.Rename(stagingFolder, dataFolder)
+	}
+	if err != nil {
+		return manifest, previousFolder, errors.Join(errors.New("cannot move the restored data folder into place, it is kept at "+stagingFolder), err)
+	}
+	return manifest, previousFolder, unlock()
+}
+
+// extractBackup extracts a backup archive into the folder and verifies its files against the manifest.
+func extractBackup(r io.Reader, folder string) (manifest BackupManifest, err error) {
+	decompressor, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, err
+	}
+	defer decompressor.Close()
+	if err = os.MkdirAll(folder, 0700); err != nil {
+		return manifest, err
+	}
+
+	extracted := make(map[string]BackupFile)
+	archive := tar.NewReader(decompressor)
+	var manifestFound bool
+	for {
+		header, nextErr := archive.Next()
+		if errors.Is(nextErr, io.EOF) {
+			break
+		}
+		if nextErr != nil {
+			return manifest, nextErr
+		}
+		if header.Name == backupManifestName {
+			if err = json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return manifest, errors.Join(errors.New("cannot decode manifest"), err)
+			}
+			manifestFound = true
+			continue
+		}
+		relative, found := strings.CutPrefix(header.Name, backupDataPrefix)
+		if !found || header.Typeflag != tar.TypeReg || !filepath.IsLocal(filepath.FromSlash(relative)) {
+			return manifest, errors.New("unexpected entry in backup archive: " + header.Name)
+		}
+		file, extractErr := extractBackupFile(archive, filepath.Join(folder, filepath.FromSlash(relative)))
+		if extractErr != nil {
+			return manifest, errors.Join(errors.New("cannot extract "+header.Name), extractErr)
+		}
+		extracted[relative] = file
+	}
+
+	if !manifestFound {
+		return manifest, errors.New("the archive holds no manifest")
+	}
+	if manifest.FormatVersion != BackupFormatVersion {
+		return manifest, errors.New("unsupported backup format version " + strconv.Itoa(manifest.FormatVersion) + ", expected " + strconv.Itoa(BackupFormatVersion))
+	}
+	if manifest.DataFolderVersion > DataFolderVersion {
+		return manifest, errors.Join(ErrNewerDataFolder, errors.New("data folder version "+strconv.Itoa(manifest.DataFolderVersion)+", supported up to "+strconv.Itoa(DataFolderVersion)))
+	}
+	var errs []error
+	for _, file := range manifest.Files {
+		got, found := extracted[file.Path]
+		switch {
+		case !found:
+			errs = append(errs, errors.New("missing file "+file.Path))
+		case got.Size != file.Size || got.SHA256 != file.SHA256:
+			errs = append(errs, errors.New("checksum mismatch of "+file.Path))
+		}
+		delete(extracted, file.Path)
+	}
+	for relative := range extracted {
+		errs = append(errs, errors.New("file not listed in the manifest "+relative))
+	}
+	return manifest, errors.Join(errs...)
+}
+
+// extractBackupFile writes the current entry of the archive to p and returns its size and checksum.
+func extractBackupFile(archive io.Reader, p string) (file BackupFile, err error) {
+	if err = os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return file, err
+	}
+	handle, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return file, err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(handle, hash), archive)
+	err = errors.Join(err, handle.Close())
+	return BackupFile{Size: written, SHA256: hex.EncodeToString(hash.Sum(nil))}, err
+}
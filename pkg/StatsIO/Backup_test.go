@@ -0,0 +1,198 @@
+package StatsIO
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	source := StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data")}
+	writeRawFile(t, source.DataFolder, "2025/01/03T0230.json", 1)
+	writeRawFile(t, source.DataFolder, "2025/01/04T0230.json", 2)
+	for name, content := range map[string]string{"videoDB.json": `{"1":{"id":1}}`, "TimeSeries/1.json": `[]`, "lazy-static/thumbnails/1.jpg": "thumbnail"} {
+		p := filepath.Join(source.DataFolder, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	manifest, err := source.Backup(&archive, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 5 {
+		t.Fatalf("Backup() backed up %d files, want 5 without the lock: %+v", len(manifest.Files), manifest.Files)
+	}
+	if _, err := os.Stat(filepath.Join(source.DataFolder, CollectorLockFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Backup() kept the collector lock: %v", err)
+	}
+
+	t.Run("restore into an empty folder", func(t *testing.T) {
+		target := StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data")}
+		restored, previousFolder, err := target.Restore(bytes.NewReader(archive.Bytes()), false, 0)
+		if err != nil || previousFolder != "" || len(restored.Files) != 5 {
+			t.Fatalf("Restore() = %d files, %q, %v, want 5 files", len(restored.Files), previousFolder, err)
+		}
+		for _, file := range manifest.Files {
+			want, _ := os.ReadFile(filepath.Join(source.DataFolder, filepath.FromSlash(file.Path)))
+			got, err := os.ReadFile(filepath.Join(target.DataFolder, filepath.FromSlash(file.Path)))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("restored %s = %q, %v, want %q", file.Path, got, err, want)
+			}
+		}
+	})
+
+	t.Run("a data folder with files is only replaced if forced", func(t *testing.T) {
+		target := StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data")}
+		writeRawFile(t, target.DataFolder, "2024/12/31T0000.json", 1)
+		if _, _, err := target.Restore(bytes.NewReader(archive.Bytes()), false, 0); err == nil {
+			t.Fatal("Restore() replaced a data folder with files without force")
+		}
+		_, previousFolder, err := target.Restore(bytes.NewReader(archive.Bytes()), true, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(previousFolder, "2024", "12", "31T0000.json")); err != nil {
+			t.Errorf("the previous data folder was not kept: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(previousFolder, CollectorLockFileName)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Restore() kept the collector lock of the previous data folder: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(target.DataFolder, "videoDB.json")); err != nil {
+			t.Errorf("the backup was not restored: %v", err)
+		}
+	})
+
+	t.Run("a damaged archive is rejected", func(t *testing.T) {
+		damaged := rewriteBackup(t, archive.Bytes(), func(name string, content []byte) []byte {
+			if name == "data/videoDB.json" {
+				return []byte(`{"2":{"id":2}}`)
+			}
+			return content
+		})
+		target := StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data")}
+		_, _, err := target.Restore(bytes.NewReader(damaged), false, 0)
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch of videoDB.json") {
+			t.Fatalf("Restore() error = %v, want a checksum mismatch", err)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(target.DataFolder)); len(entries) != 0 {
+			t.Errorf("Restore() left %d entries behind", len(entries))
+		}
+	})
+}
+
+// rewriteBackup returns the backup archive with the content of its entries replaced by edit.
+func rewriteBackup(t *testing.T, archive []byte, edit func(name string, content []byte) []byte) []byte {
+	t.Helper()
+	decompressor, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(decompressor)
+	var rewritten bytes.Buffer
+	compressor := gzip.NewWriter(&rewritten)
+	writer := tar.NewWriter(compressor)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		content = edit(header.Name, content)
+		header.Size = int64(len(content))
+		if err = writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = writer.Write(content)
+	}
+	_ = writer.Close()
+	_ = compressor.Close()
+	return rewritten.Bytes()
+}
+
+func TestLockCollector(t *testing.T) {
+	statIO := StatsIO{DataFolder: t.TempDir()}
+	lockPath := filepath.Join(statIO.DataFolder, CollectorLockFileName)
+	unlock, err := statIO.LockCollector(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relock, err := statIO.LockCollector(0)
+	if err != nil {
+		t.Fatalf("LockCollector() of a lock held by the process = %v, want it to be taken again", err)
+	}
+	if err = relock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(lockPath); err != nil {
+		t.Errorf("the lock was released before its last unlock: %v", err)
+	}
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock of another process
+	if err = os.WriteFile(lockPath, []byte("1 2025-01-01T00:00:00Z\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = statIO.LockCollector(10 * time.Millisecond); !errors.Is(err, ErrCollectorLocked) {
+		t.Errorf("LockCollector() of a held lock = %v, want %v", err, ErrCollectorLocked)
+	}
+
+	// a lock of a running process of this host is held, a lock of a process that ended is taken over right away
+	hostname, _ := os.Hostname()
+	ended := exec.Command(os.Args[0], "-test.run=^$")
+	if err = ended.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, holder := range []struct {
+		pid      int
+		wantHeld bool
+	}{{os.Getppid(), true}, {ended.Process.Pid, false}} {
+		if err = os.WriteFile(lockPath, []byte(strconv.Itoa(holder.pid)+" "+time.Now().Format(time.RFC3339)+" "+hostname+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		unlock, err = statIO.LockCollector(10 * time.Millisecond)
+		if held := errors.Is(err, ErrCollectorLocked); held != holder.wantHeld {
+			t.Errorf("LockCollector() of a lock of process %d = %v, want it to be held %v", holder.pid, err, holder.wantHeld)
+		}
+		if err == nil {
+			if err = unlock(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a lock left behind by a crashed writer is taken over
+	if err = os.WriteFile(lockPath, []byte("1 2025-01-01T00:00:00Z\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-collectorLockStaleAfter - time.Minute)
+	if err = os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = statIO.LockCollector(0)
+	if err != nil {
+		t.Fatalf("LockCollector() of a stale lock = %v, want it to be taken over", err)
+	}
+	if err = unlock(); err != nil {
+		t.Errorf("unlock() = %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package StatsIO
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+// The kinds of issues reported by CheckDataFolder.
+const (
+	IssueTruncatedJSON       = "truncated_json"
+	IssueMissingThumbnail    = "missing_thumbnail"
+	IssueMissingMetadata     = "missing_metadata"
+	IssueMissingSeries       = "missing_series"
+	IssueOrphanSeries        = "orphan_series"
+	IssueMismatchedSeries    = "mismatched_series"
+	IssueMismatchedCount     = "mismatched_count"
+	IssueMissingLifecycle    = "missing_lifecycle"
+	IssueMismatchedLifecycle = "mismatched_lifecycle"
+	IssueUnexpectedLifecycle = "unexpected_lifecycle"
+)
+
+// DataFolderIssue is a single inconsistency found in the data folder.
+type DataFolderIssue struct {
+	Kind     string `json:"kind"`
+	Path     string `json:"path,omitempty"`
+	VideoID  int64  `json:"video_id,omitempty"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+// DataFolderReport is the machine-readable summary of a CheckDataFolder run.
+type DataFolderReport struct {
+	DataFolder      string            `json:"data_folder"`
+	CheckedAt       time.Time         `json:"checked_at"`
+	Repair          bool              `json:"repair"`
+	RawFilesChecked int               `json:"raw_files_checked"`
+	VideosSeen      int               `json:"videos_seen"`
+	Issues          []DataFolderIssue `json:"issues"`
+	// Summary counts the issues per kind.
+	Summary    map[string]int `json:"summary"`
+	Unresolved int            `json:"unresolved"`
+}
+
+func (report *DataFolderReport) add(issue DataFolderIssue) {
+	report.Issues = append(report.Issues, issue)
+	report.Summary[issue.Kind]++
+	if !issue.Repaired {
+		report.Unresolved++
+	}
+}
+
+// CheckDataFolder verifies that the raw files, videoDB.json with its copies, lifecycle.json and the time series agree with each other.
+// Every raw file is parsed and replayed the same way CronSaveStats processes it, the result is compared to the files on disk.
+// If repair is set, the derived files are rewritten from the raw data, which is never modified. The collector lock is held
+// during a repair, ErrCollectorLocked is returned if another writer holds it longer than lockWait.
+// A check without repair does not take the lock, it reports the files a running collection is writing as inconsistent.
+func (statIO *StatsIO) CheckDataFolder(repair bool, lockWait time.Duration) (report DataFolderReport, err error) {
+	report = DataFolderReport{
+		DataFolder: statIO.DataFolder,
+		CheckedAt:  time.Now(),
+		Repair:     repair,
+		Issues:     []DataFolderIssue{},
+		Summary:    map[string]int{},
+	}
+	if stat, statErr := os.Stat(statIO.DataFolder); statErr != nil || !stat.IsDir() {
+		return report, errors.Join(errors.New("data folder is not accessible"), statErr)
+	}
+	if _, versionErr := ReadDataFolderVersion(statIO.DataFolder); errors.Is(versionErr, ErrNewerDataFolder) {
+		// the files of a newer layout would be reported, and repaired, as inconsistent
+		return report, versionErr
+	}
+	if repair {
+		unlock, lockErr := statIO.LockCollector(lockWait)
+		if lockErr != nil {
+			return report, lockErr
+		}
+		defer func() {
+			LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+		}()
+	}
+
+	collectionTimes := listRawFiles()
+	report.RawFilesChecked = len(collectionTimes)
+
+	expectedDB, expectedLifecycle := replayRawFiles(collectionTimes, func(rawPath string, parseErr error) {
+		// raw data is never touched, the valid part of it is used regardless.
+		report.add(DataFolderIssue{Kind: IssueTruncatedJSON, Path: rawPath, Detail: parseErr.Error()})
+	})
+
+	expectedVideos := make(map[int64]peertubeApi.VideoData)
+	expectedDB.Range(func(k, v interface{}) bool {
+		expectedVideos[k.(int64)] = v.(peertubeApi.VideoData)
+		return true
+	})
+	report.VideosSeen = len(expectedVideos)
+
+	statIO.checkVideoDB(&report, expectedDB, expectedVideos, collectionTimes, repair)
+	statIO.checkThumbnails(&report, expectedVideos, repair)
+	statIO.checkLifecycleDB(&report, expectedLifecycle, repair)
+	statIO.checkTimeSeries(&report, collectionTimes, repair)
+	return report, nil
+}
+
+// checkVideoDB compares videoDB.json and its monthly and yearly copies to the replayed database.
+func (statIO *StatsIO) checkVideoDB(report *DataFolderReport, expectedDB *sync.Map, expectedVideos map[int64]peertubeApi.VideoData, collectionTimes []time.Time, repair bool) {
+	expectedBytes, err := encodeVideoDB(expectedDB)
+	LogHelp.LogOnError("cannot encode replayed video database", nil, err)
+	writeExpected := func(p string) bool {
+		if !repair || err != nil {
+			return false
+		}
+		writeErr := os.WriteFile(p, expectedBytes, 0600)
+		LogHelp.LogOnError("cannot repair video database", map[string]string{"path": p}, writeErr)
+		return writeErr == nil
+	}
+
+	fullPath := path.Join(statIO.DataFolder, "videoDB.json")
+	var stored map[int64]peertubeApi.VideoData
+	storedBytes, readErr := os.ReadFile(fullPath)
+	if readErr == nil {
+		readErr = json.Unmarshal(storedBytes, &stored)
+	}
+	switch {
+	case os.IsNotExist(readErr) && len(expectedVideos) == 0:
+	case readErr != nil:
+		report.add(DataFolderIssue{Kind: IssueTruncatedJSON, Path: fullPath, Detail: readErr.Error(), Repaired: writeExpected(fullPath)})
+	default:
+		var missing []int64
+		for id := range expectedVideos {
+			if _, found := stored[id]; !found {
+				missing = append(missing, id)
+			}
+		}
+		slices.Sort(missing)
+		repaired := len(missing) > 0 && writeExpected(fullPath)
+		for _, id := range missing {
+			report.add(DataFolderIssue{Kind: IssueMissingMetadata, Path: fullPath, VideoID: id, Detail: "video is present in the raw data but not in the video database", Repaired: repaired})
+		}
+		if len(stored) != len(expectedVideos) {
+			report.add(DataFolderIssue{Kind: IssueMismatchedCount, Path: fullPath, Detail: "video database holds " + strconv.Itoa(len(stored)) + " videos, the raw data holds " + strconv.Itoa(len(expectedVideos)), Repaired: repaired || writeExpected(fullPath)})
+		}
+	}
+
+	// the copies are snapshots of the past, they are only checked for being readable.
+	// a broken copy is rebuilt from the raw data collected up to the end of its period.
+	var copies = make(map[string]time.Time)
+	for _, collectionTime := range collectionTimes {
+		copies[path.Join(statIO.DataFolder, collectionTime.Format("2006"), collectionTime.Format("1")+".json")] = collectionTime
+		copies[path.Join(statIO.DataFolder, collectionTime.Format("2006")+".json")] = collectionTime
+	}
+	for _, copyPath := range slices.Sorted(maps.Keys(copies)) {
+		lastCollection := copies[copyPath]
+		copyBytes, readErr := os.ReadFile(copyPath)
+		if os.IsNotExist(readErr) {
+			continue
+		}
+		if readErr == nil {
+			readErr = json.Unmarshal(copyBytes, &map[int64]peertubeApi.VideoData{})
+		}
+		if readErr == nil {
+			continue
+		}
+		issue := DataFolderIssue{Kind: IssueTruncatedJSON, Path: copyPath, Detail: readErr.Error()}
+		if repair {
+			issue.Repaired = rebuildVideoDBCopy(copyPath, collectionTimes, lastCollection) == nil
+		}
+		report.add(issue)
+	}
+}
+
+// rebuildVideoDBCopy replays the raw files up to the end of the period of the given copy and writes the result to copyPath.
+func rebuildVideoDBCopy(copyPath string, collectionTimes []time.Time, periodMember time.Time) error {
+	isYearCopy := strings.HasSuffix(copyPath, periodMember.Format("2006")+".json")
+	db := &sync.Map{}
+	deleted := &sync.Map{}
+	partial := partialCollections(Database.DataFolder)
+	for _, collectionTime := range collectionTimes {
+		if collectionTime.Year() > periodMember.Year() || (!isYearCopy && collectionTime.Year() == periodMember.Year() && collectionTime.Month() > periodMember.Month()) {
+			break
+		}
+		inputDB := &sync.Map{}
+		for _, video := range readRawResponses(collectionTime) {
+			inputDB.Store(video.ID, video)
+		}
+		err := mergeVideoDB(db, inputDB, deleted, collectionTime, isCollection(partial, collectionTime))
+		if err != nil {
+			return err
+		}
+	}
+	byts, err := encodeVideoDB(db)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(copyPath, byts, 0600)
+	LogHelp.LogOnError("cannot repair video database copy", map[string]string{"path": copyPath}, err)
+	return err
+}
+
+func (statIO *StatsIO) checkThumbnails(report *DataFolderReport, expectedVideos map[int64]peertubeApi.VideoData, repair bool) {
+	for _, id := range slices.Sorted(maps.Keys(expectedVideos)) {
+		video := expectedVideos[id]
+		if video.ThumbnailPath == "" {
+			continue
+		}
+		thumbnailPath := path.Join(statIO.DataFolder, video.ThumbnailPath)
+		if stat, _ := os.Stat(thumbnailPath); stat != nil {
+			continue
+		}
+		issue := DataFolderIssue{Kind: IssueMissingThumbnail, Path: thumbnailPath, VideoID: id, Detail: "thumbnail file does not exist"}
+		if repair {
+			err := statIO.ensureThumbnail(video)
+			if err != nil {
+				issue.Detail += ", cannot download it: " + err.Error()
+			}
+			issue.Repaired = err == nil
+		}
+		report.add(issue)
+	}
+}
+
+func (statIO *StatsIO) checkLifecycleDB(report *DataFolderReport, expectedLifecycle *sync.Map, repair bool) {
+	lifecyclePath := path.Join(statIO.DataFolder, LifecycleDatabaseFileName)
+	var stored = make(map[int64]*VideoLifecycle)
+	storedBytes, readErr := os.ReadFile(lifecyclePath)
+	if readErr == nil {
+		readErr = json.Unmarshal(storedBytes, &stored)
+	}
+
+	var issues []DataFolderIssue
+	if readErr != nil && !os.IsNotExist(readErr) {
+		issues = append(issues, DataFolderIssue{Kind: IssueTruncatedJSON, Path: lifecyclePath, Detail: readErr.Error()})
+	}
+	expectedLifecycle.Range(func(k, v interface{}) bool {
+		id := k.(int64)
+		expected := v.(*VideoLifecycle)
+		storedEntry, found := stored[id]
+		if !found {
+			issues = append(issues, DataFolderIssue{Kind: IssueMissingLifecycle, Path: lifecyclePath, VideoID: id, Detail: "video has no lifecycle record"})
+		} else if !slices.EqualFunc(storedEntry.Intervals, expected.Intervals, LifecycleInterval.equal) {
+			issues = append(issues, DataFolderIssue{Kind: IssueMismatchedLifecycle, Path: lifecyclePath, VideoID: id, Detail: "recorded lifecycle " + storedEntry.String() + ", the raw data shows " + expected.String()})
+		}
+		return true
+	})
+	for id := range stored {
+		if _, found := expectedLifecycle.Load(id); !found {
+			issues = append(issues, DataFolderIssue{Kind: IssueUnexpectedLifecycle, Path: lifecyclePath, VideoID: id, Detail: "video has a lifecycle record, but it is not present in the raw data"})
+		}
+	}
+	slices.SortFunc(issues, func(a, b DataFolderIssue) int { return cmp.Compare(a.VideoID, b.VideoID) })
+
+	repaired := false
+	if repair && len(issues) > 0 {
+		err := SaveLifecycleDBToDisk(expectedLifecycle)
+		LogHelp.LogOnError("cannot repair lifecycle database", nil, err)
+		repaired = err == nil
+	}
+	for _, issue := range issues {
+		issue.Repaired = repaired
+		report.add(issue)
+	}
+}
+
+func (statIO *StatsIO) checkTimeSeries(report *DataFolderReport, collectionTimes []time.Time, repair bool) {
+	expected := buildTimeSeriesFromRaw(collectionTimes)
+	var issues []DataFolderIssue
+	var orphans []string
+
+	indexPath := path.Join(statIO.DataFolder, TimeSeriesDatabaseFileName)
+	var index struct {
+		VideosSaved []int64
+	}
+	indexBytes, readErr := os.ReadFile(indexPath)
+	if readErr == nil {
+		readErr = json.Unmarshal(indexBytes, &index)
+	}
+	var expectedCount int
+	expected.Video.Range(func(_, _ interface{}) bool { expectedCount++; return true })
+	switch {
+	case os.IsNotExist(readErr) && expectedCount == 0:
+	case os.IsNotExist(readErr):
+		issues = append(issues, DataFolderIssue{Kind: IssueMissingSeries, Path: indexPath, Detail: "time series index does not exist"})
+	case readErr != nil:
+		issues = append(issues, DataFolderIssue{Kind: IssueTruncatedJSON, Path: indexPath, Detail: readErr.Error()})
+	case len(index.VideosSaved) != expectedCount:
+		issues = append(issues, DataFolderIssue{Kind: IssueMismatchedCount, Path: indexPath, Detail: "time series index lists " + strconv.Itoa(len(index.VideosSaved)) + " videos, the raw data holds " + strconv.Itoa(expectedCount)})
+	}
+
+	stored := &sync.Map{}
+	expected.Video.Range(func(k, v interface{}) bool {
+		id := k.(int64)
+		seriesPath := path.Join(statIO.DataFolder, "TimeSeries", strconv.FormatInt(id, 10)+".json")
+		loadErr := loadVideoTimeSeries(id, stored)
+		switch {
+		case os.IsNotExist(loadErr):
+			issues = append(issues, DataFolderIssue{Kind: IssueMissingSeries, Path: seriesPath, VideoID: id, Detail: "time series file does not exist"})
+		case loadErr != nil:
+			issues = append(issues, DataFolderIssue{Kind: IssueTruncatedJSON, Path: seriesPath, VideoID: id, Detail: loadErr.Error()})
+		default:
+			storedList, _ := stored.Load(id)
+			if detail := compareTimeSeries(v.(*VideoTimeSeries), storedList); detail != "" {
+				issues = append(issues, DataFolderIssue{Kind: IssueMismatchedSeries, Path: seriesPath, VideoID: id, Detail: detail})
+			}
+		}
+		return true
+	})
+
+	seriesFiles, _ := filepath.Glob(path.Join(statIO.DataFolder, "TimeSeries", "*.json"))
+	for _, seriesPath := range seriesFiles {
+		id, parseErr := strconv.ParseInt(strings.TrimSuffix(filepath.Base(seriesPath), ".json"), 10, 64)
+		if _, found := expected.Video.Load(id); parseErr == nil && found {
+			continue
+		}
+		orphans = append(orphans, seriesPath)
+		issues = append(issues, DataFolderIssue{Kind: IssueOrphanSeries, Path: seriesPath, VideoID: id, Detail: "time series file belongs to no video of the raw data"})
+	}
+
+	repaired := false
+	if repair && len(issues) > 0 {
+		err := serializeTimeSeries(expected)
+		for _, orphan := range orphans {
+			err = errors.Join(err, os.Remove(orphan))
+		}
+		LogHelp.LogOnError("cannot repair time series database", nil, err)
+		repaired = err == nil
+	}
+	for _, issue := range issues {
+		issue.Repaired = repaired
+		report.add(issue)
+	}
+}
+
+// compareTimeSeries returns a description of the first difference of the two series, or an empty string if they are equal.
+func compareTimeSeries(expected *VideoTimeSeries, storedValue interface{}) string {
+	stored, _ := storedValue.(*VideoTimeSeries)
+	var expectedEntries, storedEntries []TimeSeriesDataEntry
+	if expected != nil {
+		expectedEntries = expected.Entries
+	}
+	if stored != nil {
+		storedEntries = stored.Entries
+	}
+	for position := 0; position < max(len(expectedEntries), len(storedEntries)); position++ {
+		switch {
+		case position >= len(storedEntries):
+			return "time series ends before " + expectedEntries[position].Date.Format(time.DateOnly)
+		case position >= len(expectedEntries):
+			return "time series has an unexpected entry on " + storedEntries[position].Date.Format(time.DateOnly)
+		}
+		expectedEntry, storedEntry := expectedEntries[position], storedEntries[position]
+		if !expectedEntry.Date.Equal(storedEntry.Date) || !expectedEntry.Until.Equal(storedEntry.Until) || !expectedEntry.Data.Equal(&storedEntry.Data) {
+			return "entry " + strconv.Itoa(position+1) + " differs, expected " + strconv.FormatInt(expectedEntry.Data.Views, 10) + " views from " + expectedEntry.Date.Format(time.DateOnly) + " until " + expectedEntry.Until.Format(time.DateOnly) + ", found " + strconv.FormatInt(storedEntry.Data.Views, 10) + " views from " + storedEntry.Date.Format(time.DateOnly) + " until " + storedEntry.Until.Format(time.DateOnly)
+		}
+	}
+	return ""
+}
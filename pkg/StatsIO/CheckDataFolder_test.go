@@ -0,0 +1,154 @@
+package StatsIO
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDataFolder(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// replaceInFile replaces old by new in the file of the data folder, the file must hold old.
+	replaceInFile := func(t *testing.T, dataFolder, name, old, new string) {
+		t.Helper()
+		p := filepath.Join(dataFolder, filepath.FromSlash(name))
+		content, err := os.ReadFile(p)
+		if err != nil || !strings.Contains(string(content), old) {
+			t.Fatalf("%s does not hold %s: %v", name, old, err)
+		}
+		if err = os.WriteFile(p, []byte(strings.Replace(string(content), old, new, 1)), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(t *testing.T, dataFolder, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dataFolder, filepath.FromSlash(name)), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the missing thumbnails are left out, they are repaired by downloading them from the PeerTube instance.
+	tests := []struct {
+		name string
+		// damage breaks the consistent data folder
+		damage    func(t *testing.T, dataFolder string)
+		wantKinds []string
+		// wantRepaired is whether the issues of wantKinds are repaired.
+		wantRepaired bool
+		// wantUnresolved is the number of issues left after the repair, the raw data is never repaired.
+		wantUnresolved int
+	}{
+		{"consistent", func(t *testing.T, dataFolder string) {}, nil, true, 0},
+		{"truncated video database", func(t *testing.T, dataFolder string) {
+			writeFile(t, dataFolder, "videoDB.json", `{"1":{"id":1`)
+		}, []string{IssueTruncatedJSON}, true, 0},
+		{"truncated copy of the video database", func(t *testing.T, dataFolder string) {
+			writeFile(t, dataFolder, "2025.json", `{`)
+		}, []string{IssueTruncatedJSON}, true, 0},
+		{"video missing from the video database", func(t *testing.T, dataFolder string) {
+			writeFile(t, dataFolder, "videoDB.json", `{}`)
+		}, []string{IssueMissingMetadata, IssueMismatchedCount}, true, 0},
+		{"missing time series", func(t *testing.T, dataFolder string) {
+			if err := os.Remove(filepath.Join(dataFolder, "TimeSeries", "1.json")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{IssueMissingSeries}, true, 0},
+		{"missing time series index", func(t *testing.T, dataFolder string) {
+			if err := os.Remove(filepath.Join(dataFolder, TimeSeriesDatabaseFileName)); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{IssueMissingSeries}, true, 0},
+		{"orphan time series", func(t *testing.T, dataFolder string) {
+			writeFile(t, dataFolder, "TimeSeries/99.json", `{"entries":[]}`)
+		}, []string{IssueOrphanSeries}, true, 0},
+		{"mismatched time series", func(t *testing.T, dataFolder string) {
+			replaceInFile(t, dataFolder, "TimeSeries/1.json", `"views":2`, `"views":5`)
+		}, []string{IssueMismatchedSeries}, true, 0},
+		{"mismatched time series index", func(t *testing.T, dataFolder string) {
+			replaceInFile(t, dataFolder, TimeSeriesDatabaseFileName, `[1]`, `[1,2]`)
+		}, []string{IssueMismatchedCount}, true, 0},
+		{"missing lifecycle", func(t *testing.T, dataFolder string) {
+			writeFile(t, dataFolder, LifecycleDatabaseFileName, `{}`)
+		}, []string{IssueMissingLifecycle}, true, 0},
+		{"mismatched lifecycle", func(t *testing.T, dataFolder string) {
+			replaceInFile(t, dataFolder, LifecycleDatabaseFileName, `"visible":true`, `"visible":false`)
+		}, []string{IssueMismatchedLifecycle}, true, 0},
+		{"unexpected lifecycle", func(t *testing.T, dataFolder string) {
+			replaceInFile(t, dataFolder, LifecycleDatabaseFileName, `{"1":`, `{"99":{"id":99,"intervals":[]},"1":`)
+		}, []string{IssueUnexpectedLifecycle}, true, 0},
+		{"truncated raw file", func(t *testing.T, dataFolder string) {
+			replaceInFile(t, dataFolder, "2025/01/02.json", `}]}`, `}`)
+		}, []string{IssueTruncatedJSON}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2}
+			writeRawFile(t, Database.DataFolder, "2025/01/01.json", 1)
+			writeRawFile(t, Database.DataFolder, "2025/01/02.json", 2)
+			if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+				t.Fatal(err)
+			}
+			tt.damage(t, Database.DataFolder)
+
+			report, err := Database.CheckDataFolder(false, 0)
+			if err != nil {
+				t.Fatalf("CheckDataFolder() error = %v", err)
+			}
+			if len(report.Issues) != report.Unresolved || report.RawFilesChecked != 2 || report.VideosSeen != 1 {
+				t.Errorf("CheckDataFolder() = %+v, want 2 raw files, 1 video and every issue unresolved", report)
+			}
+			for _, kind := range tt.wantKinds {
+				if report.Summary[kind] == 0 {
+					t.Errorf("CheckDataFolder() issues = %+v, want an issue of kind %s", report.Issues, kind)
+				}
+			}
+			if len(tt.wantKinds) == 0 && len(report.Issues) > 0 {
+				t.Errorf("CheckDataFolder() issues = %+v, want none", report.Issues)
+			}
+
+			repair, err := Database.CheckDataFolder(true, 0)
+			if err != nil {
+				t.Fatalf("CheckDataFolder() with repair error = %v", err)
+			}
+			// the files derived from a truncated raw file follow its valid part, they are repaired regardless.
+			for _, issue := range repair.Issues {
+				if slices.Contains(tt.wantKinds, issue.Kind) && issue.Repaired != tt.wantRepaired {
+					t.Errorf("CheckDataFolder() with repair issue %+v, want repaired %v", issue, tt.wantRepaired)
+				}
+			}
+			check, err := Database.CheckDataFolder(false, 0)
+			if err != nil || check.Unresolved != tt.wantUnresolved {
+				t.Errorf("CheckDataFolder() after the repair = %+v, %v, want %d unresolved issues", check.Issues, err, tt.wantUnresolved)
+			}
+		})
+	}
+}
+
+func TestCheckDataFolder_locked(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2}
+	writeRawFile(t, Database.DataFolder, "2025/01/01.json", 1)
+	// a collection of another running process holds the collector lock
+	lockPath := filepath.Join(Database.DataFolder, CollectorLockFileName)
+	if err := os.WriteFile(lockPath, []byte(strconv.Itoa(os.Getppid())+" "+time.Now().Format(time.RFC3339)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := Database.CheckDataFolder(false, 0); err != nil || report.Summary[IssueMissingSeries] == 0 {
+		t.Errorf("CheckDataFolder() without repair = %+v, %v, want the missing time series to be reported", report.Issues, err)
+	}
+	if _, err := Database.CheckDataFolder(true, 0); !errors.Is(err, ErrCollectorLocked) {
+		t.Errorf("CheckDataFolder() with repair = %v, want ErrCollectorLocked", err)
+	}
+	if _, err := os.Stat(filepath.Join(Database.DataFolder, TimeSeriesDatabaseFileName)); !os.IsNotExist(err) {
+		t.Errorf("CheckDataFolder() repaired the data folder of a running collection: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package StatsIO
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// CohortCurve holds the likes and views of a video at the end of each day since its publication, Stats[0] is the day it was published on.
+// Days that have not passed yet are not part of the curve.
+type CohortCurve struct {
+	Video peertubeApi.VideoData
+	// Published is the reporting day of the publication.
+	Published time.Time
+	// Stats are unknown before the first collection of a video published before the first collection of all, its early days were never observed.
+	// A video published later was not collected before it existed, these stats are estimated as zero.
+	Stats []VideoStat
+}
+
+// CohortBand is the distribution of a counter over the videos of a cohort, on a day after their publication.
+// The bounds are the 10th, 25th, 50th, 75th and 90th percentile.
+type CohortBand struct {
+	Day int
+	// Videos is the number of videos whose counter is known on Day.
+	Videos                                             int
+	Lower, LowerQuartile, Median, UpperQuartile, Upper Stat
+}
+
+// CohortEntry compares a video to the median of its cohort, on the last of the compared days it has reached.
+type CohortEntry struct {
+	Video     peertubeApi.VideoData
+	Published time.Time
+	// Day is the last known day after publication, -1 if no day is known.
+	Day       int
+	Value     int64
+	Estimated bool
+	// RelativeToMedian is the value in relation to the median of the cohort on Day, 1 is the median.
+	RelativeToMedian float64
+}
+
+// CohortCurves returns the curves of the videos for the first days after their publication.
+// Videos without a valid publication date are left out, their errors are joined.
+func CohortCurves(videos []peertubeApi.VideoData, days int) (curves []CohortCurve, err error) {
+	var errs []error
+	today := Database.ReportingDay(time.Now())
+	timeSeries := Database.current().timeSeries
+	for _, video := range videos {
+		published, publishedErr := video.GetPublishedAt()
+		if publishedErr != nil {
+			errs = append(errs, errors.Join(errors.New("cannot parse publication date of video "+strconv.FormatInt(video.ID, 10)), publishedErr))
+			continue
+		}
+		curve := CohortCurve{Video: video, Published: Database.ReportingDay(published)}
+		series := getVideoTimeSeries(video.ID)
+		for day := range days {
+			ts := curve.Published.AddDate(0, 0, day)
+			if ts.After(today) {
+				break
+			}
+			stat, statErr := requestTimestamp(ts, video.ID)
+			if statErr != nil {
+				errs = append(errs, statErr)
+				break
+			}
+			if series == nil || unitEnd(ts, templates.TimeframeDaily).Before(series.Earliest) {
+				stat = VideoStat{Time: ts, Estimated: true}
+				stat.Unknown = series == nil || timeSeries == nil || published.Before(timeSeries.FirstTimestamp)
+			}
+			curve.Stats = append(curve.Stats, stat)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, errors.Join(errs...)
+}
+
+// cohortValue returns the counter of the metric, see templates.CohortViews and templates.CohortLikes.
+func cohortValue(stat VideoStat, metric string) int64 {
+	if metric == templates.CohortLikes {
+		return stat.Likes.Data
+	}
+	return stat.Views.Data
+}
+
+// CohortBands returns the distribution of the counter of the metric over the curves, for each of the first days after publication.
+// The percentages of the bounds are scaled to the largest upper bound, for the charts.
+func CohortBands(curves []CohortCurve, metric string, days int) (bands []CohortBand) {
+	for day := range days {
+		var values []float64
+		for _, curve := range curves {
+			if day < len(curve.Stats) && !curve.Stats[day].Unknown {
+				values = append(values, float64(cohortValue(curve.Stats[day], metric)))
+			}
+		}
+		slices.Sort(values)
+		band := CohortBand{Day: day, Videos: len(values)}
+		if len(values) > 0 {
+			band.Lower.Data = int64(math.Round(percentileOf(values, 0.1)))
+			band.LowerQuartile.Data = int64(math.Round(percentileOf(values, 0.25)))
+			band.Median.Data = int64(math.Round(percentileOf(values, 0.5)))
+			band.UpperQuartile.Data = int64(math.Round(percentileOf(values, 0.75)))
+			band.Upper.Data = int64(math.Round(percentileOf(values, 0.9)))
+		}
+		bands = append(bands, band)
+	}
+	prepareCohortBands(bands)
+	return bands
+}
+
+// percentileOf returns the p-th quantile of the sorted values, interpolated linearly between the closest ranks.
+func percentileOf(sorted []float64, p float64) float64 {
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// prepareCohortBands sets the percentages of the bounds, see prepareStatsForViewing. Days without a known video keep the line of the previous day.
+func prepareCohortBands(bands []CohortBand) {
+	var biggest int64
+	for _, band := range bands {
+		biggest = max(biggest, band.Upper.Data)
+	}
+	// Shift the max up, this results in a top-padding in the chart.
+	biggest += 15
+
+	var previous [5]float64
+	for i := range bands {
+		bounds := []*Stat{&bands[i].Lower, &bands[i].LowerQuartile, &bands[i].Median, &bands[i].UpperQuartile, &bands[i].Upper}
+		for j, bound := range bounds {
+			end := previous[j]
+			if bands[i].Videos > 0 {
+				end = float64(bound.Data) / float64(biggest)
+			}
+			bound.StartPercentage, bound.EndPercentage = end, end
+			if i > 0 {
+				bound.StartPercentage = previous[j]
+			}
+			previous[j] = end
+		}
+	}
+}
+
+// CompareCohort compares each curve to the median of the bands, on the last compared day it has reached. The best video comes first.
+func CompareCohort(curves []CohortCurve, bands []CohortBand, metric string) (entries []CohortEntry) {
+	for _, curve := range curves {
+		entry := CohortEntry{Video: curve.Video, Published: curve.Published, Day: -1}
+		for day := min(len(curve.Stats), len(bands)) - 1; day >= 0; day-- {
+			if stat := curve.Stats[day]; !stat.Unknown {
+				entry.Day, entry.Value, entry.Estimated = day, cohortValue(stat, metric), stat.Estimated
+				entry.RelativeToMedian = float64(entry.Value) / float64(max(1, bands[day].Median.Data))
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b CohortEntry) int {
+		return cmp.Or(cmp.Compare(b.RelativeToMedian, a.RelativeToMedian), cmp.Compare(a.Video.Name, b.Video.Name))
+	})
+	return entries
+}
+
+// RelativePercent returns the value in relation to the median of the cohort in percent.
+func (entry CohortEntry) RelativePercent() float64 {
+	return entry.RelativeToMedian * 100
+}
@@ -0,0 +1,146 @@
+package StatsIO
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_percentileOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{"single value", []float64{7}, 0.9, 7},
+		{"median of an odd count", []float64{1, 2, 9}, 0.5, 2},
+		{"median of an even count", []float64{1, 2, 4, 8}, 0.5, 3},
+		{"interpolated", []float64{0, 10, 20, 30, 40}, 0.1, 4},
+		{"maximum", []float64{0, 10, 20}, 1, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentileOf(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentileOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cohortCurve returns a curve with the given views per day, a negative value is an unknown day.
+func cohortCurve(id int64, views ...int64) CohortCurve {
+	curve := CohortCurve{Video: peertubeApi.VideoData{ID: id}}
+	for day, view := range views {
+		stat := VideoStat{Time: sampleDay(day), Views: Stat{Data: view}, Likes: Stat{Data: view / 10}}
+		stat.Unknown = view < 0
+		curve.Stats = append(curve.Stats, stat)
+	}
+	return curve
+}
+
+func TestCohortBands(t *testing.T) {
+	curves := []CohortCurve{
+		cohortCurve(1, 0, 100, 200),
+		cohortCurve(2, 10, 50),
+		cohortCurve(3, -1, 300, 400),
+	}
+
+	bands := CohortBands(curves, templates.CohortViews, 4)
+	if len(bands) != 4 {
+		t.Fatalf("CohortBands() returned %d bands, want 4", len(bands))
+	}
+	tests := []struct {
+		day                  int
+		videos               int
+		lower, median, upper int64
+	}{
+		{0, 2, 1, 5, 9},
+		{1, 3, 60, 100, 260},
+		{2, 2, 220, 300, 380},
+		{3, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		band := bands[tt.day]
+		if band.Videos != tt.videos || band.Lower.Data != tt.lower || band.Median.Data != tt.median || band.Upper.Data != tt.upper {
+			t.Errorf("day %d: got videos %d, bounds %d/%d/%d, want %d, %d/%d/%d", tt.day, band.Videos, band.Lower.Data, band.Median.Data, band.Upper.Data, tt.videos, tt.lower, tt.median, tt.upper)
+		}
+	}
+	if bands[3].Median.EndPercentage != bands[2].Median.EndPercentage {
+		t.Errorf("a day without videos should keep the line of the previous day, got %v, want %v", bands[3].Median.EndPercentage, bands[2].Median.EndPercentage)
+	}
+	if likes := CohortBands(curves, templates.CohortLikes, 4); likes[1].Median.Data != 10 {
+		t.Errorf("median likes on day 1 = %d, want 10", likes[1].Median.Data)
+	}
+
+	entries := CompareCohort(curves, bands, templates.CohortViews)
+	if entries[0].Video.ID != 3 || entries[0].Day != 2 || entries[0].RelativeToMedian != 400.0/300 {
+		t.Errorf("CompareCohort() first entry = %+v, want video 3 on day 2", entries[0])
+	}
+	if last := entries[len(entries)-1]; last.Video.ID != 2 || last.Day != 1 || last.RelativeToMedian != 0.5 {
+		t.Errorf("CompareCohort() last entry = %+v, want video 2 on day 1", last)
+	}
+}
+
+func TestCohortCurves(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// both videos are collected at noon from day 2, the second video is first collected on day 4.
+	var collections []time.Time
+	var early, late VideoTimeSeries
+	for day := 2; day < 10; day++ {
+		collection := sampleDay(day).Add(12 * time.Hour)
+		collections = append(collections, collection)
+		_ = early.insert(collection, LikeView{Views: int64(day) * 100})
+		if day >= 4 {
+			_ = late.insert(collection, LikeView{Views: int64(day-3) * 10})
+		}
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &early)
+	videos.Store(int64(2), &late)
+	Database = StatsIO{
+		Location:          time.UTC,
+		MissingDataPolicy: MissingDataCarryForward,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections, FirstTimestamp: collections[0]}}),
+	}
+
+	curves, err := CohortCurves([]peertubeApi.VideoData{
+		{ID: 1, PublishedAt: sampleDay(0).Add(8 * time.Hour).Format(time.RFC3339Nano)},
+		{ID: 2, PublishedAt: sampleDay(3).Add(8 * time.Hour).Format(time.RFC3339Nano)},
+		{ID: 3, PublishedAt: "not a date"},
+	}, 3)
+	if err == nil {
+		t.Error("CohortCurves() should report the invalid publication date")
+	}
+	if len(curves) != 2 {
+		t.Fatalf("CohortCurves() returned %d curves, want 2", len(curves))
+	}
+
+	tests := []struct {
+		name          string
+		curve         CohortCurve
+		wantViews     []int64
+		wantUnknown   []bool
+		wantEstimated []bool
+	}{
+		{"published before the first collection", curves[0], []int64{0, 0, 200}, []bool{true, true, false}, []bool{true, true, false}},
+		{"published after the first collection", curves[1], []int64{0, 10, 20}, []bool{false, false, false}, []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.curve.Stats) != len(tt.wantViews) {
+				t.Fatalf("got %d days, want %d", len(tt.curve.Stats), len(tt.wantViews))
+			}
+			for day, stat := range tt.curve.Stats {
+				if stat.Views.Data != tt.wantViews[day] || stat.Unknown != tt.wantUnknown[day] || stat.Estimated != tt.wantEstimated[day] {
+					t.Errorf("day %d: got views %d, unknown %v, estimated %v, want %d, %v, %v", day, stat.Views.Data, stat.Unknown, stat.Estimated, tt.wantViews[day], tt.wantUnknown[day], tt.wantEstimated[day])
+				}
+			}
+		})
+	}
+}
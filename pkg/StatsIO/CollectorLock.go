@@ -0,0 +1,105 @@
+package StatsIO
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CollectorLockFileName is the file within the data folder that is held while the data folder is written to,
+// by a collection of CronSaveStats, a backup or a restore. It is never part of a backup.
+// Readers do not take it, the webserver reloads a data folder that changed while it was loaded, see Reload.
+const CollectorLockFileName = ".collector.lock"
+
+// DefaultCollectorLockWait is how long a writer of the data folder waits for another writer to release the collector lock.
+const DefaultCollectorLockWait = 10 * time.Minute
+
+// collectorLockStaleAfter is the age from which a lock is considered left behind by a crashed writer, no collection takes that long.
+const collectorLockStaleAfter = 6 * time.Hour
+
+// heldCollectorLocks counts the collector locks this process holds by the absolute path of their lock file.
+var heldCollectorLocks = struct {
+	sync.Mutex
+	count map[string]int
+}{count: make(map[string]int)}
+
+// ErrCollectorLocked is returned if the collector lock is still held by another writer after waiting for it.
+var ErrCollectorLocked = errors.New("the data folder is locked by another collection, backup or restore")
+
+// LockCollector takes the collector lock of the data folder, waiting for up to wait for another writer to release it.
+// The lock holds the process id, the time it was taken and the host name. A lock of a process of this host that is no
+// longer running is taken over, e.g. after a fatal log ended CronSaveStats, as is any lock older than 6 hours.
+// A process may take a lock it already holds again, e.g. to migrate the data folder during a collection, it is released with the last unlock.
+// The returned function releases the lock.
+func (statIO *StatsIO) LockCollector(wait time.Duration) (unlock func() error, err error) {
+	lockPath := absolutePath(path.Join(statIO.DataFolder, CollectorLockFileName))
+	release := func() error {
+		heldCollectorLocks.Lock()
+		defer heldCollectorLocks.Unlock()
+		heldCollectorLocks.count[lockPath]--
+		if heldCollectorLocks.count[lockPath] > 0 {
+			return nil
+		}
+		delete(heldCollectorLocks.count, lockPath)
+		return os.Remove(lockPath)
+	}
+	heldCollectorLocks.Lock()
+	if heldCollectorLocks.count[lockPath] > 0 {
+		heldCollectorLocks.count[lockPath]++
+		heldCollectorLocks.Unlock()
+		return release, nil
+	}
+	heldCollectorLocks.Unlock()
+	if err = os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, errors.Join(errors.New("cannot create data folder"), err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		handle, createErr := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if createErr == nil {
+			hostname, _ := os.Hostname()
+			_, writeErr := handle.WriteString(strconv.Itoa(os.Getpid()) + " " + time.Now().Format(time.RFC3339) + " " + hostname + "\n")
+			err = errors.Join(writeErr, handle.Close())
+			if err != nil {
+				_ = os.Remove(lockPath)
+				return nil, errors.Join(errors.New("cannot write collector lock"), err)
+			}
+			heldCollectorLocks.Lock()
+			heldCollectorLocks.count[lockPath]++
+			heldCollectorLocks.Unlock()
+			return release, nil
+		}
+		if !errors.Is(createErr, os.ErrExist) {
+			return nil, errors.Join(errors.New("cannot create collector lock"), createErr)
+		}
+		if stat, statErr := os.Stat(lockPath); statErr == nil && time.Since(stat.ModTime()) > collectorLockStaleAfter || collectorLockAbandoned(lockPath) {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrCollectorLocked
+		}
+		time.Sleep(min(time.Second, max(time.Millisecond, time.Until(deadline))))
+	}
+}
+
+// collectorLockAbandoned reports whether the lock was taken by a process of this host that is no longer running.
+// A lock of another host, or one written before the host was recorded, is only taken over once it is stale.
+func collectorLockAbandoned(lockPath string) bool {
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(content))
+	hostname, hostnameErr := os.Hostname()
+	if len(fields) < 3 || hostnameErr != nil || fields[2] != hostname {
+		return false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	return err == nil && pid != os.Getpid() && !processRunning(pid)
+}
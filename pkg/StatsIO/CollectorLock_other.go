@@ -0,0 +1,8 @@
+//go:build !unix
+
+package StatsIO
+
+// processRunning reports every process as running, a lock is only taken over once it is stale on this platform.
+func processRunning(pid int) bool {
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package StatsIO
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning reports whether a process of this host with the given id is running, see collectorLockAbandoned.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,86 @@
+package StatsIO
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// PeriodTotals are the views and likes gained within a range, from the end of the day before it to the end of its last day.
+type PeriodTotals struct {
+	Dates       templates.TwoDateForm
+	ViewsGained int64
+	LikesGained int64
+	// Estimated is set if a counter was not collected at the start or the end of the range.
+	Estimated bool
+}
+
+// PeriodComparison compares the gains within the range of a request to the gains within the range it is compared to,
+// see templates.FrontPageRequest.ComparedDates.
+type PeriodComparison struct {
+	Current  PeriodTotals
+	Previous PeriodTotals
+}
+
+// ComparePeriods compares the gains of a video within the range of the request to its compared range.
+// A request that does not compare returns the zero comparison.
+func ComparePeriods(videoID int64, request templates.FrontPageRequest) (comparison PeriodComparison, err error) {
+	if request.Compare == "" || request.Compare == templates.CompareNone {
+		return comparison, nil
+	}
+	current, currentErr := periodTotals(videoID, request.Dates)
+	previous, previousErr := periodTotals(videoID, request.ComparedDates())
+	if currentErr != nil || previousErr != nil {
+		return comparison, errors.Join(errors.New("cannot compare the periods of video "+strconv.FormatInt(videoID, 10)), currentErr, previousErr)
+	}
+	return PeriodComparison{Current: current, Previous: previous}, nil
+}
+
+// periodTotals returns the gains of a video within the range of Dates, an open end is today, see videoRangeGain.
+func periodTotals(videoID int64, Dates templates.TwoDateForm) (totals PeriodTotals, err error) {
+	totals.Dates = Dates
+	gain, err := videoRangeGain(videoID, Dates)
+	if err != nil {
+		return totals, err
+	}
+	totals.ViewsGained, totals.LikesGained = gain.viewsGained, gain.likesGained
+	totals.Estimated = gain.start.Estimated || gain.start.Unknown || gain.end.Estimated || gain.end.Unknown
+	return totals, nil
+}
+
+// Add adds the gains of another comparison of the same ranges, it is used to sum up the comparisons of the videos.
+func (comparison *PeriodComparison) Add(other PeriodComparison) {
+	comparison.Current.Dates, comparison.Previous.Dates = other.Current.Dates, other.Previous.Dates
+	comparison.Current.ViewsGained += other.Current.ViewsGained
+	comparison.Current.LikesGained += other.Current.LikesGained
+	comparison.Current.Estimated = comparison.Current.Estimated || other.Current.Estimated
+	comparison.Previous.ViewsGained += other.Previous.ViewsGained
+	comparison.Previous.LikesGained += other.Previous.LikesGained
+	comparison.Previous.Estimated = comparison.Previous.Estimated || other.Previous.Estimated
+}
+
+// ViewsChange returns the views gained within the current range minus the views gained within the compared range.
+func (comparison PeriodComparison) ViewsChange() int64 {
+	return comparison.Current.ViewsGained - comparison.Previous.ViewsGained
+}
+
+// LikesChange returns the likes gained within the current range minus the likes gained within the compared range.
+func (comparison PeriodComparison) LikesChange() int64 {
+	return comparison.Current.LikesGained - comparison.Previous.LikesGained
+}
+
+// ViewsChangePercent returns the change of the views gained in percent of the compared range, no views gained count as one view.
+func (comparison PeriodComparison) ViewsChangePercent() float64 {
+	return float64(comparison.ViewsChange()) / float64(max(1, comparison.Previous.ViewsGained)) * 100
+}
+
+// LikesChangePercent returns the change of the likes gained in percent of the compared range, no likes gained count as one like.
+func (comparison PeriodComparison) LikesChangePercent() float64 {
+	return float64(comparison.LikesChange()) / float64(max(1, comparison.Previous.LikesGained)) * 100
+}
+
+// Estimated reports whether a counter of either range was not collected.
+func (comparison PeriodComparison) Estimated() bool {
+	return comparison.Current.Estimated || comparison.Previous.Estimated
+}
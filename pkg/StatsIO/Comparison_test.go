@@ -0,0 +1,88 @@
+package StatsIO
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestComparePeriods(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// the video is collected each day at noon, it gains 10 views a day in 2024 and 20 views a day in 2025.
+	var series VideoTimeSeries
+	var collections []time.Time
+	var views int64
+	for day := date(2024, 1, 1); day.Year() < 2026; day = day.AddDate(0, 0, 1) {
+		views += 10 * int64(day.Year()-2023)
+		collections = append(collections, day.Add(12*time.Hour))
+		_ = series.insert(day.Add(12*time.Hour), LikeView{Views: views, Likes: views / 10})
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &series)
+	Database = StatsIO{
+		Location:          time.UTC,
+		MissingDataPolicy: MissingDataCarryForward,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections, FirstTimestamp: collections[0]}}),
+	}
+
+	tests := []struct {
+		name                   string
+		compare                string
+		start, end             time.Time
+		wantStart, wantEnd     time.Time
+		wantPrevious, wantCurr int64
+		wantPercent            float64
+	}{
+		{"whole month to the previous month", templates.ComparePreviousPeriod, date(2025, 9, 1), date(2025, 9, 30), date(2025, 8, 1), date(2025, 8, 31), 620, 600, -20.0 / 620 * 100},
+		{"month to date to the same days of the previous month", templates.ComparePreviousPeriod, date(2025, 3, 1), date(2025, 3, 15), date(2025, 2, 1), date(2025, 2, 15), 300, 300, 0},
+		{"end of a longer month is clamped", templates.ComparePreviousPeriod, date(2025, 3, 1), date(2025, 3, 30), date(2025, 2, 1), date(2025, 2, 28), 560, 600, 40.0 / 560 * 100},
+		{"days to the days right before", templates.ComparePreviousPeriod, date(2025, 6, 10), date(2025, 6, 19), date(2025, 5, 31), date(2025, 6, 9), 200, 200, 0},
+		{"month to the same month of the previous year", templates.ComparePreviousYear, date(2025, 9, 1), date(2025, 9, 30), date(2024, 9, 1), date(2024, 9, 30), 300, 600, 100},
+		{"leap day to the previous year", templates.ComparePreviousYear, date(2025, 2, 28), date(2025, 3, 1), date(2024, 2, 28), date(2024, 3, 1), 30, 40, 100.0 / 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComparePeriods(1, templates.FrontPageRequest{Compare: tt.compare, Dates: templates.TwoDateForm{StartDate: tt.start, EndDate: tt.end}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Previous.Dates.StartDate.Equal(tt.wantStart) || !got.Previous.Dates.EndDate.Equal(tt.wantEnd) {
+				t.Errorf("compared range = %v - %v, want %v - %v", got.Previous.Dates.StartDate, got.Previous.Dates.EndDate, tt.wantStart, tt.wantEnd)
+			}
+			if got.Previous.ViewsGained != tt.wantPrevious || got.Current.ViewsGained != tt.wantCurr {
+				t.Errorf("views gained = %d, %d, want %d, %d", got.Previous.ViewsGained, got.Current.ViewsGained, tt.wantPrevious, tt.wantCurr)
+			}
+			if math.Abs(got.ViewsChangePercent()-tt.wantPercent) > 1e-9 {
+				t.Errorf("ViewsChangePercent() = %v, want %v", got.ViewsChangePercent(), tt.wantPercent)
+			}
+		})
+	}
+
+	t.Run("no comparison", func(t *testing.T) {
+		got, err := ComparePeriods(1, templates.FrontPageRequest{Compare: templates.CompareNone, Dates: templates.TwoDateForm{StartDate: date(2025, 9, 1), EndDate: date(2025, 9, 30)}})
+		if err != nil || got != (PeriodComparison{}) {
+			t.Errorf("ComparePeriods() = %+v, %v, want the zero comparison", got, err)
+		}
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		var summary PeriodComparison
+		request := templates.FrontPageRequest{Compare: templates.ComparePreviousYear, Dates: templates.TwoDateForm{StartDate: date(2025, 9, 1), EndDate: date(2025, 9, 30)}}
+		for range 2 {
+			comparison, _ := ComparePeriods(1, request)
+			summary.Add(comparison)
+		}
+		if summary.ViewsChange() != 600 || summary.LikesChange() != 60 {
+			t.Errorf("summary change = %d views, %d likes, want 600, 60", summary.ViewsChange(), summary.LikesChange())
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"maps"
 	"strconv"
+	"strings"
 
 	"github.com/sa-kemper/peertubestats/i18n"
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
@@ -18,6 +19,8 @@ type CsvGenerateParameters struct {
 	Scope           struct {
 		Views bool
 		Likes bool
+		// Metrics appends the engagement metrics at the end of the range, see RangeMetrics.
+		Metrics bool
 	}
 }
 
@@ -43,20 +46,82 @@ func CsvGenerate(parameters CsvGenerateParameters) (csvData [][]string) {
 	csvData[0] = []string{Translate("Video Name"), Translate("Video URL")}
 	for iterator, vid := range parameters.Videos {
 		iterator++
-		stats, err := ExportStats(vid.ID, parameters.DisplaySettings.Dates, parameters.DisplaySettings.Timeframe)
+		stats, err := ExportStatsForRequest(vid.ID, parameters.DisplaySettings)
 		var statStringSlice []string
+		// estimatedColumns are the headers of the columns of the row holding estimated values, see csvStatValue.
+		var estimatedColumns []string
 		for _, stat := range stats {
-			statStringSlice = append(statStringSlice, strconv.Itoa(int(stat.Views.Data)))
+			statStringSlice = append(statStringSlice, csvStatValue(stat))
+			if stat.Forecast != nil {
+				statStringSlice = append(statStringSlice, strconv.FormatInt(stat.Forecast.ViewsLower, 10), strconv.FormatInt(stat.Forecast.ViewsUpper, 10))
+			}
+			if stat.Estimated {
+				estimatedColumns = append(estimatedColumns, FormatStatTime(stat.Time, parameters.DisplaySettings.Timeframe))
+			}
 		}
 		if err != nil {
 			LogHelp.NewLog(LogHelp.Fatal, "cannot read stats for video", map[string]string{"error": err.Error()}).Log()
 		}
+		compared := parameters.DisplaySettings.Compare != "" && parameters.DisplaySettings.Compare != templates.CompareNone
+		if compared {
+			// the views gained within both ranges are followed by their change
+			comparison, err := ComparePeriods(vid.ID, parameters.DisplaySettings)
+			LogHelp.LogOnError("cannot compare periods of video", map[string]interface{}{"videoID": vid.ID}, err)
+			statStringSlice = append(statStringSlice,
+				strconv.FormatInt(comparison.Previous.ViewsGained, 10),
+				strconv.FormatInt(comparison.Current.ViewsGained, 10),
+				strconv.FormatInt(comparison.ViewsChange(), 10),
+				strconv.FormatFloat(comparison.ViewsChangePercent(), 'f', 1, 64),
+			)
+			if comparison.Previous.Estimated {
+				estimatedColumns = append(estimatedColumns, Translate("Views gained")+" "+csvDateRange(parameters.DisplaySettings.ComparedDates()))
+			}
+			if comparison.Current.Estimated {
+				estimatedColumns = append(estimatedColumns, Translate("Views gained")+" "+csvDateRange(parameters.DisplaySettings.Dates))
+			}
+		}
+		if parameters.Scope.Metrics {
+			metrics, err := RangeMetrics([]peertubeApi.VideoData{vid}, parameters.DisplaySettings.Dates)
+			LogHelp.LogOnError("cannot derive metrics of video", map[string]interface{}{"videoID": vid.ID}, err)
+			statStringSlice = append(statStringSlice,
+				strconv.FormatFloat(metrics.LikeRatio, 'f', 4, 64),
+				strconv.FormatFloat(metrics.DislikeRatio, 'f', 4, 64),
+				strconv.FormatFloat(metrics.CommentsPerThousandViews, 'f', 2, 64),
+				strconv.FormatFloat(metrics.ViewsPerDay, 'f', 2, 64),
+				strconv.FormatFloat(metrics.WatchHours, 'f', 1, 64),
+			)
+		}
 
-		if iterator == 2 {
+		if iterator == 1 {
 			// complete header
 			for _, stat := range stats {
-				csvData[0] = append(csvData[0], stat.Time.Format("2006-01-02"))
+				statTime := FormatStatTime(stat.Time, parameters.DisplaySettings.Timeframe)
+				if stat.Forecast != nil {
+					// a projected stat is followed by the bounds of its confidence interval
+					csvData[0] = append(csvData[0], Translate("Forecast")+" "+statTime, Translate("Forecast")+" "+statTime+" "+Translate("lower bound"), Translate("Forecast")+" "+statTime+" "+Translate("upper bound"))
+					continue
+				}
+				csvData[0] = append(csvData[0], statTime)
+			}
+			if compared {
+				previous, current := parameters.DisplaySettings.ComparedDates(), parameters.DisplaySettings.Dates
+				csvData[0] = append(csvData[0],
+					Translate("Views gained")+" "+csvDateRange(previous),
+					Translate("Views gained")+" "+csvDateRange(current),
+					Translate("Change"),
+					Translate("Change in percent"),
+				)
 			}
+			if parameters.Scope.Metrics {
+				csvData[0] = append(csvData[0],
+					Translate("Like/View Ratio"),
+					Translate("Dislike ratio"),
+					Translate("Comments per 1000 views"),
+					Translate("Views per day"),
+					Translate("Estimated watch hours"),
+				)
+			}
+			csvData[0] = append(csvData[0], Translate("Estimated values"), Translate("Mode"))
 		}
 
 		csvData[iterator] = []string{
@@ -65,9 +130,37 @@ func CsvGenerate(parameters CsvGenerateParameters) (csvData [][]string) {
 		}
 		// insert the stats data
 		csvData[iterator] = append(csvData[iterator], statStringSlice...)
-		csvData[iterator] = append(csvData[iterator], vid.Name)
+		csvData[iterator] = append(csvData[iterator], strings.Join(estimatedColumns, csvEstimatedSeparator), csvMode(parameters.DisplaySettings.Mode), vid.Name)
 
 	}
 	csvData[0] = append(csvData[0], Translate("Video Name"))
 	return csvData
 }
+
+// csvEstimatedSeparator separates the headers of the estimated columns of a row in the Estimated values column.
+// It is no semicolon, as the webserver joins the cells by semicolons without quoting them.
+const csvEstimatedSeparator = ", "
+
+// csvMode returns the mode of the views of a row, see templates.ModeCumulative and templates.ModeDelta.
+// It is not translated, ImportCsv reads it to refuse the views gained per period.
+func csvMode(mode string) string {
+	if mode == templates.ModeDelta {
+		return templates.ModeDelta
+	}
+	return templates.ModeCumulative
+}
+
+// csvStatValue formats the views of a stat, unknown views are left empty.
+// Estimated views are listed by the header of their column in the Estimated values column of the row, so that every cell stays numeric.
+func csvStatValue(stat VideoStat) string {
+	if stat.Unknown {
+		return ""
+	}
+	return strconv.FormatInt(stat.Views.Data, 10)
+}
+
+// csvDateRange formats the range of a comparison column, e.g. 2025-09-01 - 2025-09-30.
+func csvDateRange(dates templates.TwoDateForm) string {
+	location := Database.ReportingLocation()
+	return dates.StartDate.In(location).Format("2006-01-02") + " - " + dates.EndDate.In(location).Format("2006-01-02")
+}
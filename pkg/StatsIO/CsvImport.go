@@ -0,0 +1,442 @@
+package StatsIO
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// ImportFileName is the file within the data folder that records the collections imported from CSV files.
+const ImportFileName = "imported.json"
+
+// importHeaderSuffix follows the API version in the header of an imported raw file.
+const importHeaderSuffix = " (imported from a CSV file)"
+
+// The layouts of the CSV files read by ImportCsv.
+const (
+	// CsvFormatLong holds a sample per row: the video, the date, the views and optionally the likes.
+	CsvFormatLong = "long"
+	// CsvFormatWide holds a video per row and the views at each date per column, as written by CsvGenerate.
+	CsvFormatWide = "wide"
+)
+
+// The header names of the columns of the long format, compared case-insensitively.
+var (
+	csvVideoColumns = []string{"video", "video id", "id", "uuid", "url", "video url"}
+	csvDateColumns  = []string{"date", "day", "time"}
+	csvViewsColumns = []string{"views"}
+	csvLikesColumns = []string{"likes"}
+	// csvEstimatedColumns are the names of the column of the wide format listing the estimated columns of a row, see CsvGenerate.
+	csvEstimatedColumns = []string{"estimated values", "geschätzte werte"}
+	// csvModeColumns are the names of the column of the wide format holding the mode of the views of a row, see csvMode.
+	csvModeColumns = []string{"mode", "modus"}
+)
+
+// ImportRecord is the content of imported.json.
+type ImportRecord struct {
+	// Collections are the imported collections, oldest first. Their raw files hold the samples of the imported rows.
+	Collections []time.Time    `json:"collections"`
+	Sources     []ImportSource `json:"sources"`
+}
+
+// ImportSource is an imported CSV file.
+type ImportSource struct {
+	Source     string    `json:"source"`
+	ImportedAt time.Time `json:"imported_at"`
+	Samples    int       `json:"samples"`
+}
+
+// CsvImportRow is a row of a CSV file that was not imported.
+type CsvImportRow struct {
+	Line   int    `json:"line"`
+	Video  string `json:"video"`
+	Reason string `json:"reason"`
+}
+
+// CsvImportReport describes an import, see ImportCsv.
+type CsvImportReport struct {
+	Source string `json:"source"`
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	// Samples counts the views read from the file, Imported the ones written to the data folder.
+	Samples     int `json:"samples"`
+	Imported    int `json:"imported"`
+	Collections int `json:"collections"`
+	Videos      int `json:"videos"`
+	// Unmatched are the rows whose video is unknown, Skipped the rows whose sample was not imported otherwise.
+	Unmatched []CsvImportRow `json:"unmatched"`
+	Skipped   []CsvImportRow `json:"skipped"`
+}
+
+// csvSample is the views, and optionally the likes, of a video at a collection time read from a CSV file.
+type csvSample struct {
+	line     int
+	video    string
+	time     time.Time
+	views    int64
+	likes    int64
+	hasLikes bool
+}
+
+// ReadImportRecord returns the imported collections of the data folder, a data folder without imported.json has none.
+func ReadImportRecord(dataFolder string) (record ImportRecord, err error) {
+	recordBytes, err := os.ReadFile(path.Join(dataFolder, ImportFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return ImportRecord{Collections: []time.Time{}, Sources: []ImportSource{}}, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(recordBytes, &record)
+	}
+	if err != nil {
+		return record, errors.Join(errors.New("cannot read the imported collections"), err)
+	}
+	return record, nil
+}
+
+// writeImportRecord writes imported.json to the data folder.
+func writeImportRecord(dataFolder string, record ImportRecord) error {
+	recordBytes, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path.Join(dataFolder, ImportFileName), recordBytes)
+}
+
+// ImportCsv imports the views of videos tracked before they were collected, e.g. in a spreadsheet, from a CSV file in the
+// long or the wide format, see CsvFormatLong and CsvFormatWide. The delimiter is a comma or a semicolon.
+// A row is matched to a video of the data folder by its id, UUID, short UUID or URL, unmatched rows are reported.
+// A date holds the views at the end of its day, a column of the wide format the views at the end of its period.
+// A file of the wide format exported in the Delta mode is refused, its columns hold the views gained per period.
+// Estimated views of the wide format, see CsvGenerate, and days that hold a collection are skipped, the samples of a date that was imported
+// before are replaced. The likes of a sample without likes are the ones of the next collection of the video.
+// The samples are written as raw files flagged in their header, recorded in imported.json, and the derived files are rebuilt.
+// The collector lock is held during the import. If dryRun is set, the rows are matched without writing anything.
+func (statIO *StatsIO) ImportCsv(r io.Reader, source string, dryRun bool, lockWait time.Duration) (report CsvImportReport, err error) {
+	report = CsvImportReport{Source: source, DryRun: dryRun, Unmatched: []CsvImportRow{}, Skipped: []CsvImportRow{}}
+	if !dryRun {
+		unlock, lockErr := statIO.LockCollector(lockWait)
+		if lockErr != nil {
+			return report, lockErr
+		}
+		defer func() {
+			LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+		}()
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return report, errors.Join(errors.New("cannot read CSV file"), err)
+	}
+	var samples []csvSample
+	report.Format, samples, report.Skipped, err = parseCsvSamples(content)
+	if err != nil {
+		return report, err
+	}
+	report.Samples = len(samples)
+
+	videoDb, err := loadVideoDB()
+	if err != nil {
+		return report, errors.Join(errors.New("cannot load video db"), err)
+	}
+	videos := csvVideoIndex(videoDb)
+	if len(videos) == 0 {
+		return report, errors.New("the data folder holds no video to match the rows against")
+	}
+	record, err := ReadImportRecord(statIO.DataFolder)
+	if err != nil {
+		return report, err
+	}
+	collections := listRawFiles()
+	collectedDays := map[time.Time]bool{}
+	for _, collection := range collections {
+		if !isCollection(record.Collections, collection) {
+			collectedDays[statIO.ReportingDay(collection)] = true
+		}
+	}
+
+	// imports maps the time of each imported collection to its samples by video id, a later row replaces an earlier one
+	imports := map[time.Time]map[int64]csvSample{}
+	matchedVideos := map[int64]bool{}
+	for _, sample := range samples {
+		video, found := videos[csvVideoKey(sample.video)]
+		if !found {
+			report.Unmatched = append(report.Unmatched, CsvImportRow{Line: sample.line, Video: sample.video, Reason: "unknown video"})
+			continue
+		}
+		if collectedDays[statIO.ReportingDay(sample.time)] {
+			report.Skipped = append(report.Skipped, CsvImportRow{Line: sample.line, Video: sample.video, Reason: "the day holds a collection"})
+			continue
+		}
+		if imports[sample.time] == nil {
+			imports[sample.time] = map[int64]csvSample{}
+		}
+		imports[sample.time][video.ID] = sample
+		matchedVideos[video.ID] = true
+	}
+	for _, samplesByVideo := range imports {
+		report.Imported += len(samplesByVideo)
+	}
+	report.Collections, report.Videos = len(imports), len(matchedVideos)
+	if dryRun || len(imports) == 0 {
+		return report, nil
+	}
+
+	TSDB, err := loadTimeSeriesForWriting()
+	if err != nil {
+		return report, errors.Join(errors.New("cannot load time series"), err)
+	}
+	var version string
+	if len(collections) > 0 {
+		version = rawFileVersion(getRawFilePath(collections[len(collections)-1]))
+	}
+	header := rawHeaderPrefix + version + importHeaderSuffix + "\r\n"
+	for collectionTime, samplesByVideo := range imports {
+		collected := map[int64]peertubeApi.VideoData{}
+		if isCollection(record.Collections, collectionTime) {
+			previous, parseErr := parseRawFile(getRawFilePath(collectionTime))
+			if parseErr != nil {
+				return report, errors.Join(errors.New("cannot read the imported collection "+collectionTime.Format(time.RFC3339)), parseErr)
+			}
+			for _, video := range previous {
+				collected[video.ID] = video
+			}
+		}
+		for id, sample := range samplesByVideo {
+			video, _ := videoDb.Load(id)
+			imported := video.(peertubeApi.VideoData)
+			imported.Views, imported.Likes = sample.views, sample.likes
+			if !sample.hasLikes {
+				imported.Likes = likesAfter(TSDB, id, collectionTime, imported.Likes)
+			}
+			collected[id] = imported
+		}
+		data := slices.SortedFunc(maps.Values(collected), func(a, b peertubeApi.VideoData) int { return cmp.Compare(a.ID, b.ID) })
+		rawContent, marshalErr := json.Marshal(peertubeApi.VideoResponse{Total: int64(len(data)), Data: data})
+		if marshalErr != nil {
+			return report, marshalErr
+		}
+		rawPath := rawFilePathIn(statIO.DataFolder, collectionTime)
+		if err = os.MkdirAll(path.Dir(rawPath), 0700); err == nil {
+			err = writeFileAtomically(rawPath, append([]byte(header), rawContent...))
+		}
+		if err != nil {
+			return report, errors.Join(errors.New("cannot write imported raw file"), err)
+		}
+		if !isCollection(record.Collections, collectionTime) {
+			record.Collections = append(record.Collections, collectionTime)
+		}
+	}
+	slices.SortFunc(record.Collections, time.Time.Compare)
+	record.Sources = append(record.Sources, ImportSource{Source: source, ImportedAt: time.Now(), Samples: report.Imported})
+	if err = writeImportRecord(statIO.DataFolder, record); err != nil {
+		return report, errors.Join(errors.New("cannot record the imported collections"), err)
+	}
+	if _, err = statIO.rebuildDerivedFiles(listRawFiles()); err != nil {
+		return report, errors.Join(errors.New("cannot rebuild the imported data folder"), err)
+	}
+	statIO.update(func(loaded *loadedData) { loaded.imported = record.Collections })
+	return report, nil
+}
+
+// parseCsvSamples reads the samples of a CSV file in the long or the wide format.
+// Rows whose views cannot be imported are returned as skipped, empty cells of the wide format were not collected and are left out.
+func parseCsvSamples(content []byte) (format string, samples []csvSample, skipped []CsvImportRow, err error) {
+	skipped = []CsvImportRow{}
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", nil, skipped, errors.Join(errors.New("cannot parse CSV file"), err)
+	}
+	if len(rows) == 0 {
+		return "", nil, skipped, errors.New("the CSV file is empty")
+	}
+	column := func(names []string) int {
+		return slices.IndexFunc(rows[0], func(name string) bool {
+			return slices.Contains(names, strings.ToLower(strings.TrimSpace(name)))
+		})
+	}
+	views := func(line int, video, cell string) (int64, bool) {
+		cell = strings.TrimSpace(cell)
+		value, parseErr := strconv.ParseInt(cell, 10, 64)
+		if parseErr != nil || value < 0 {
+			skipped = append(skipped, CsvImportRow{Line: line, Video: video, Reason: "invalid views " + cell})
+			return 0, false
+		}
+		return value, true
+	}
+
+	videoColumn, dateColumn, viewsColumn, likesColumn := column(csvVideoColumns), column(csvDateColumns), column(csvViewsColumns), column(csvLikesColumns)
+	if videoColumn >= 0 && dateColumn >= 0 && viewsColumn >= 0 {
+		for i, row := range rows[1:] {
+			line := i + 2
+			if len(row) <= max(videoColumn, dateColumn, viewsColumn) {
+				continue
+			}
+			sample := csvSample{line: line, video: strings.TrimSpace(row[videoColumn])}
+			var ok bool
+			if sample.time, ok = parseCsvTime(row[dateColumn]); !ok {
+				skipped = append(skipped, CsvImportRow{Line: line, Video: sample.video, Reason: "invalid date " + row[dateColumn]})
+				continue
+			}
+			if sample.views, ok = views(line, sample.video, row[viewsColumn]); !ok {
+				continue
+			}
+			if likesColumn >= 0 && likesColumn < len(row) && strings.TrimSpace(row[likesColumn]) != "" {
+				likes, likesErr := strconv.ParseInt(strings.TrimSpace(row[likesColumn]), 10, 64)
+				sample.likes, sample.hasLikes = likes, likesErr == nil && likes >= 0
+			}
+			samples = append(samples, sample)
+		}
+		return CsvFormatLong, samples, skipped, nil
+	}
+
+	// the wide format holds the name and the URL of the video, followed by the views at the end of each period.
+	// columns that are no date, e.g. the bounds of a forecast or the metrics, are left out.
+	type dateColumnTime struct {
+		column int
+		end    time.Time
+	}
+	var dates []dateColumnTime
+	for i, name := range rows[0] {
+		if end, ok := parseCsvColumnEnd(name); ok {
+			dates = append(dates, dateColumnTime{column: i, end: end})
+		}
+	}
+	if len(dates) == 0 || len(rows[0]) < 2 {
+		return "", nil, skipped, errors.New("unknown CSV format, expected the columns video, date and views, or a column per date as exported")
+	}
+	if videoColumn < 0 {
+		videoColumn = 1
+	}
+	estimatedColumn, modeColumn := column(csvEstimatedColumns), column(csvModeColumns)
+	for i, row := range rows[1:] {
+		line := i + 2
+		if len(row) <= videoColumn || strings.TrimSpace(row[videoColumn]) == "" {
+			continue
+		}
+		// the views gained within each period cannot be told apart from the counters, exports without a mode are cumulative
+		if modeColumn >= 0 && modeColumn < len(row) && strings.EqualFold(strings.TrimSpace(row[modeColumn]), templates.ModeDelta) {
+			return "", nil, skipped, errors.New("line " + strconv.Itoa(line) + " holds the views gained per period of the Delta mode, export the file in the Cumulative mode to import it")
+		}
+		var estimated []string
+		if estimatedColumn >= 0 && estimatedColumn < len(row) {
+			for _, header := range strings.Split(row[estimatedColumn], strings.TrimSpace(csvEstimatedSeparator)) {
+				estimated = append(estimated, strings.TrimSpace(header))
+			}
+		}
+		for _, date := range dates {
+			if date.column >= len(row) || strings.TrimSpace(row[date.column]) == "" {
+				continue
+			}
+			sample := csvSample{line: line, video: strings.TrimSpace(row[videoColumn]), time: date.end}
+			if slices.Contains(estimated, strings.TrimSpace(rows[0][date.column])) {
+				skipped = append(skipped, CsvImportRow{Line: line, Video: sample.video, Reason: "estimated views"})
+				continue
+			}
+			var ok bool
+			if sample.views, ok = views(line, sample.video, row[date.column]); ok {
+				samples = append(samples, sample)
+			}
+		}
+	}
+	return CsvFormatWide, samples, skipped, nil
+}
+
+// parseCsvTime parses the date of a sample of the long format, a date without a time holds the views at the end of the day.
+func parseCsvTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+		if day, err := time.ParseInLocation(layout, value, Database.ReportingLocation()); err == nil {
+			return Database.CollectionTimestamp(day.AddDate(0, 0, 1).Add(-time.Minute)), true
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if collectionTime, err := time.ParseInLocation(layout, value, Database.ReportingLocation()); err == nil {
+			return Database.CollectionTimestamp(collectionTime), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseCsvColumnEnd parses the header of a column of the wide format, see FormatStatTime, and returns the end of the day or hour it names.
+// CsvGenerate names a column by the last day of its period, e.g. the last day of the week, the column holds the views at its end.
+func parseCsvColumnEnd(value string) (time.Time, bool) {
+	for _, column := range []struct{ layout, timeframe string }{{"2006-01-02 15:04", templates.TimeframeHourly}, {"2006-01-02", templates.TimeframeDaily}} {
+		if start, err := time.ParseInLocation(column.layout, strings.TrimSpace(value), Database.ReportingLocation()); err == nil {
+			return Database.CollectionTimestamp(unitEnd(start, column.timeframe)), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// csvVideoIndex maps the id, the UUID and the short UUID of each video to the video.
+func csvVideoIndex(videoDb *sync.Map) map[string]peertubeApi.VideoData {
+	index := map[string]peertubeApi.VideoData{}
+	videoDb.Range(func(_, value interface{}) bool {
+		video := value.(peertubeApi.VideoData)
+		index[strconv.FormatInt(video.ID, 10)] = video
+		if video.UUID != "" {
+			index[strings.ToLower(video.UUID)] = video
+		}
+		if video.ShortUUID != "" {
+			index[video.ShortUUID] = video
+		}
+		return true
+	})
+	return index
+}
+
+// csvVideoKey returns the key of csvVideoIndex a video is referenced by in a CSV file.
+// The URL of a video ends with its UUID or short UUID, e.g. https://peertube.example.com/w/<short UUID>.
+func csvVideoKey(value string) string {
+	value = strings.TrimSpace(value)
+	if parsed, err := url.Parse(value); err == nil && strings.Contains(value, "/") {
+		value = path.Base(strings.TrimSuffix(parsed.Path, "/"))
+	}
+	if len(value) == 36 && strings.Count(value, "-") == 4 {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// likesAfter returns the likes of the first collection of a video after t, or of its last collection before t.
+// A video without a time series keeps the given likes.
+func likesAfter(TSDB *TimeSeriesDatabase, id int64, t time.Time, likes int64) int64 {
+	value, found := TSDB.Video.Load(id)
+	if !found {
+		return likes
+	}
+	series := value.(*VideoTimeSeries)
+	if len(series.Entries) == 0 {
+		return likes
+	}
+	position := series.search(t)
+	if position == len(series.Entries) || (position > 0 && !t.After(series.Entries[position-1].Until)) {
+		// t is within the last run, or after the last collection
+		return series.Entries[position-1].Data.Likes
+	}
+	return series.Entries[position].Data.Likes
+}
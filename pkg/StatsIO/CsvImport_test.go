@@ -0,0 +1,202 @@
+package StatsIO
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_parseCsvSamples(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{Location: time.UTC}
+	endOfDay := func(day int) time.Time { return sampleDay(day).Add(23*time.Hour + 59*time.Minute) }
+
+	tests := []struct {
+		name        string
+		content     string
+		wantFormat  string
+		wantTimes   []time.Time
+		wantViews   []int64
+		wantSkipped int
+		wantErr     bool
+	}{
+		{"long format", "video,date,views,likes\n1,2025-01-01,10,2\n1,2025-01-02T12:00:00Z,12,\n1,yesterday,13,\n", CsvFormatLong, []time.Time{endOfDay(0), sampleDay(1).Add(12 * time.Hour)}, []int64{10, 12}, 1, false},
+		{"long format with semicolons", "\ufeffUUID;Day;Views\nabc;03.01.2025;7\nabc;2025-01-04;-1\n", CsvFormatLong, []time.Time{endOfDay(2)}, []int64{7}, 1, false},
+		{"wide format as exported", "Video Name,Video URL,2025-01-01,2025-01-02,2025-01-03,Forecast 2025-01-04,Estimated values,Video Name\n" +
+			"First,https://peertube.example.com/w/abc,1,2,,9,\"2025-01-02, 2025-01-03\",First\n",
+			CsvFormatWide, []time.Time{endOfDay(0)}, []int64{1}, 1, false},
+		{"wide format exported in the Cumulative mode", "Video Name,Video URL,2025-01-01,2025-01-02,Estimated values,Mode,Video Name\n" +
+			"First,https://peertube.example.com/w/abc,1,2,,Cumulative,First\n",
+			CsvFormatWide, []time.Time{endOfDay(0), endOfDay(1)}, []int64{1, 2}, 0, false},
+		{"wide format exported in the Delta mode", "Video Name;Video URL;2025-01-01;2025-01-02;Geschätzte Werte;Modus;Video Name\n" +
+			"First;https://peertube.example.com/w/abc;1;1;;Delta;First\n",
+			"", nil, nil, 0, true},
+		{"unknown format", "name,count\nfirst,1\n", "", nil, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, samples, skipped, err := parseCsvSamples([]byte(tt.content))
+			if (err != nil) != tt.wantErr || format != tt.wantFormat || len(skipped) != tt.wantSkipped {
+				t.Fatalf("parseCsvSamples() = %q, %+v, %v, want %q with %d skipped", format, skipped, err, tt.wantFormat, tt.wantSkipped)
+			}
+			times := make([]time.Time, len(samples))
+			views := make([]int64, len(samples))
+			for i, sample := range samples {
+				times[i], views[i] = sample.time, sample.views
+			}
+			if !slices.EqualFunc(times, tt.wantTimes, time.Time.Equal) || !slices.Equal(views, tt.wantViews) {
+				t.Errorf("parseCsvSamples() samples at %v with views %v, want %v with %v", times, views, tt.wantTimes, tt.wantViews)
+			}
+		})
+	}
+}
+
+func Test_parseCsvSamples_roundTrip(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, WeekStart: time.Monday, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataCarryForward}
+	if flag.Lookup("api-host") == nil {
+		flag.String("api-host", "peertube.example.com", "peertube API host")
+	}
+
+	// a collection each day from January 1st until the 26th, except for Sunday the 12th
+	for day := range 26 {
+		if day != 11 {
+			writeRawFile(t, Database.DataFolder, sampleDay(day).Format("2006/01/02")+"T1200.json", int64(10*(day+1)))
+		}
+	}
+	if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Database.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	video, err := GetVideo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := CsvGenerateParameters{Videos: []peertubeApi.VideoData{video}, TargetLang: "en"}
+	parameters.DisplaySettings = templates.FrontPageRequest{Timeframe: templates.TimeframeWeekly, Dates: templates.TwoDateForm{StartDate: sampleDay(5), EndDate: sampleDay(25)}}
+	var exported bytes.Buffer
+	writer := csv.NewWriter(&exported)
+	if err = writer.WriteAll(CsvGenerate(parameters)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the weeks end on Sunday the 12th, the 19th and the 26th, the 12th was estimated
+	_, samples, skipped, err := parseCsvSamples(exported.Bytes())
+	if err != nil || len(skipped) != 1 || skipped[0].Reason != "estimated views" {
+		t.Fatalf("parseCsvSamples() of the exported file skipped %+v, %v, want the estimated week", skipped, err)
+	}
+
+	// the views gained per period of the Delta mode are refused
+	parameters.DisplaySettings.Mode = templates.ModeDelta
+	var delta bytes.Buffer
+	writer = csv.NewWriter(&delta)
+	if err = writer.WriteAll(CsvGenerate(parameters)); err != nil {
+		t.Fatal(err)
+	}
+	if _, deltaSamples, _, deltaErr := parseCsvSamples(delta.Bytes()); deltaErr == nil {
+		t.Errorf("parseCsvSamples() of the file exported in the Delta mode = %+v, want an error", deltaSamples)
+	}
+
+	wantTimes := []time.Time{sampleDay(18).Add(23*time.Hour + 59*time.Minute), sampleDay(25).Add(23*time.Hour + 59*time.Minute)}
+	times, views := make([]time.Time, len(samples)), make([]int64, len(samples))
+	for i, sample := range samples {
+		times[i], views[i] = sample.time, sample.views
+		stat, statErr := requestTimestamp(sample.time, 1)
+		if statErr != nil || stat.Views.Data != sample.views {
+			t.Errorf("the sample at %v holds %d views, the stat at that time %+v, %v", sample.time, sample.views, stat, statErr)
+		}
+	}
+	if !slices.EqualFunc(times, wantTimes, time.Time.Equal) || !slices.Equal(views, []int64{190, 260}) {
+		t.Errorf("parseCsvSamples() of the exported file = samples at %v with views %v, want %v with [190 260]", times, views, wantTimes)
+	}
+}
+
+func TestImportCsv(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataCarryForward}
+
+	// both videos were collected from day 10 on, they were tracked in a spreadsheet before
+	collection := "# Peertube API Version: 7.0.0\r\n" + `{"total":2,"data":[` +
+		`{"id":1,"uuid":"9c9de5e8-0a1b-4d43-9a1c-3b1d2f6e0a11","shortUUID":"kkGMgK9ZtnKfYAgnEtQxbv","views":100,"likes":9},` +
+		`{"id":2,"uuid":"1d2e3f40-5a6b-4c7d-8e9f-a0b1c2d3e4f5","shortUUID":"3S7V8uSHrGDwUPUvSkTq5B","views":50,"likes":4}]}`
+	if err := os.MkdirAll(filepath.Join(Database.DataFolder, "2025", "01"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"11T1200.json", "12T1200.json"} {
+		if err := os.WriteFile(filepath.Join(Database.DataFolder, "2025", "01", name), []byte(collection), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+		t.Fatal(err)
+	}
+
+	spreadsheet := "video,date,views,likes\n" +
+		"1,2025-01-01,10,1\n" +
+		"https://peertube.example.com/w/kkGMgK9ZtnKfYAgnEtQxbv,2025-01-02,20,\n" +
+		"1d2e3f40-5a6b-4c7d-8e9f-a0b1c2d3e4f5,2025-01-01,5,0\n" +
+		"https://peertube.example.com/w/unknown,2025-01-02,1,\n" +
+		"2,2025-01-11,49,\n"
+
+	report, err := Database.ImportCsv(strings.NewReader(spreadsheet), "spreadsheet.csv", true, 0)
+	if err != nil || report.Imported != 3 || len(report.Unmatched) != 1 || len(report.Skipped) != 1 || len(listRawFiles()) != 2 {
+		t.Fatalf("dry run ImportCsv() = %+v, %v, want 3 samples, 1 unmatched and 1 skipped row without writing", report, err)
+	}
+
+	report, err = Database.ImportCsv(strings.NewReader(spreadsheet), "spreadsheet.csv", false, 0)
+	if err != nil || report.Imported != 3 || report.Collections != 2 || report.Videos != 2 {
+		t.Fatalf("ImportCsv() = %+v, %v, want 3 samples in 2 collections of 2 videos", report, err)
+	}
+	if err = Database.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id           int64
+		day          int
+		wantViews    int64
+		wantLikes    int64
+		wantImported bool
+	}{
+		{1, 0, 10, 1, true},
+		// the likes of a sample without likes are the ones of the next collection
+		{1, 1, 20, 9, true},
+		{1, 10, 100, 9, false},
+		// video 2 is not part of the sample of day 1, it is not missing on that day
+		{2, 1, 5, 0, true},
+		{2, 10, 50, 4, false},
+	}
+	for _, tt := range tests {
+		stat, err := requestTimestamp(sampleDay(tt.day), tt.id)
+		if err != nil || stat.Views.Data != tt.wantViews || stat.Likes.Data != tt.wantLikes || stat.Imported != tt.wantImported || stat.Missing {
+			t.Errorf("requestTimestamp(day %d, video %d) = %+v, %v, want %d views, %d likes, imported %v", tt.day, tt.id, stat, err, tt.wantViews, tt.wantLikes, tt.wantImported)
+		}
+	}
+	check, err := Database.CheckDataFolder(false, 0)
+	if err != nil || check.Unresolved > 0 {
+		t.Errorf("CheckDataFolder() of the imported folder = %+v, %v, want it to be consistent", check.Issues, err)
+	}
+
+	// importing the file again replaces its samples
+	if _, err = Database.ImportCsv(strings.NewReader(spreadsheet), "spreadsheet.csv", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	record, _ := ReadImportRecord(Database.DataFolder)
+	if len(record.Collections) != 2 || len(record.Sources) != 2 || len(listRawFiles()) != 4 {
+		t.Errorf("import record = %+v with %d collections, want 2 imported collections of 2 imports", record, len(listRawFiles()))
+	}
+}
@@ -1,62 +1,132 @@
 package StatsIO
 
 import (
-	"cmp"
 	"errors"
-	"slices"
 	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
 )
 
 func ExportStats(videoID int64, Dates Timeframe, Timeframe string) (Bucket []VideoStat, err error) {
 	// Cache this functions return. Note: but it runs so fast with the time seriesDB that it doesnt really matter
-	var dateVals = []int{0, 0, 0}
-	if Timeframe != "Daily" && Timeframe != "Monthly" && Timeframe != "Yearly" {
-		Timeframe = "Daily"
+	timestamps, _ := bucketTimestamps(Dates, Timeframe)
+	if len(timestamps) == 0 {
+		return make([]VideoStat, 0), errors.New("timestamps is empty")
 	}
-	switch Timeframe {
-	case "Daily":
-		dateVals = []int{0, 0, -1}
-	case "Monthly":
-		dateVals = []int{0, -1, 0}
-	case "Yearly":
-		dateVals = []int{-1, 0, 0}
+
+	Bucket, err = collectStats(videoID, timestamps, Timeframe)
+	if err != nil {
+		return []VideoStat{}, err
 	}
+	Bucket = prepareStatsForViewing(Bucket)
+	return Bucket, nil
 
-	var timestamps = make([]time.Time, 0)
-	var currentDate = Dates.GetEndDate()
-	var startDate = Dates.GetStartDate()
+}
 
-	if startDate.IsZero() || currentDate.Before(startDate) {
-		startDate = time.Now().AddDate(dateVals[0]*4, dateVals[1]*5, dateVals[2]*6)
+// ExportDeltaStats returns the views and likes gained within each bucket, instead of the counters at its end.
+// The first bucket is compared to the counters one period before it.
+// A counter that decreased is handled by counterIncrease.
+func ExportDeltaStats(videoID int64, Dates Timeframe, Timeframe string) (Bucket []VideoStat, err error) {
+	timestamps, before := bucketTimestamps(Dates, Timeframe)
+	if len(timestamps) == 0 {
+		return make([]VideoStat, 0), errors.New("timestamps is empty")
 	}
-	if currentDate.IsZero() {
-		currentDate = time.Now().AddDate(0, 0, 0)
+	timestamps = append([]time.Time{before}, timestamps...)
+
+	cumulative, err := collectStats(videoID, timestamps, Timeframe)
+	if err != nil {
+		return []VideoStat{}, err
+	}
+	for i := 1; i < len(cumulative); i++ {
+		previous, current := cumulative[i-1], cumulative[i]
+		delta := VideoStat{
+			Time:      current.Time,
+			Likes:     Stat{Data: counterIncrease(previous.Likes.Data, current.Likes.Data)},
+			Views:     Stat{Data: counterIncrease(previous.Views.Data, current.Views.Data)},
+			Missing:   current.Missing,
+			Estimated: previous.Estimated || current.Estimated,
+			Unknown:   previous.Unknown || current.Unknown,
+			// the gain of the first real collection over the last backfilled one is backfilled as well
+			Backfilled: previous.Backfilled || current.Backfilled,
+			Imported:   previous.Imported || current.Imported,
+		}
+		if delta.Unknown {
+			delta.Likes.Data, delta.Views.Data = 0, 0
+		}
+		Bucket = append(Bucket, delta)
 	}
 
-	for currentDate.After(startDate) || startDate.Equal(currentDate) {
-		timestamps = append(timestamps, currentDate)
-		currentDate = currentDate.AddDate(dateVals[0], dateVals[1], dateVals[2])
+	Bucket = prepareStatsForViewing(Bucket)
+	return Bucket, nil
+}
+
+// ExportStatsForRequest returns the stats of a video in the timeframe and mode of the request.
+// The buckets are marked with the anomalies detected and the PeerTube upgrades made within them, the forecast periods of the request follow them.
+func ExportStatsForRequest(videoID int64, request templates.FrontPageRequest) (Bucket []VideoStat, err error) {
+	if request.Mode == templates.ModeDelta {
+		Bucket, err = ExportDeltaStats(videoID, request.Dates, request.Interval())
+	} else {
+		Bucket, err = ExportStats(videoID, request.Dates, request.Interval())
+	}
+	if err != nil || len(Bucket) == 0 {
+		return Bucket, err
+	}
+	timeframe, _ := templates.ParseTimeframe(request.Interval())
+	_, before := bucketTimestamps(request.Dates, request.Interval())
+	first := unitEnd(before, timeframe).Add(time.Nanosecond)
+	markAnomalies(Bucket, DetectAnomalies(videoID, templates.TwoDateForm{StartDate: first, EndDate: Bucket[len(Bucket)-1].Time}), request.Interval())
+	markUpgrades(Bucket, first, request.Interval())
+	if request.ForecastPeriods > 0 {
+		Bucket = prepareStatsForViewing(appendForecast(videoID, Bucket, request))
 	}
+	return Bucket, nil
+}
 
-	if len(timestamps) == 0 {
-		return make([]VideoStat, 0), errors.New("timestamps is empty")
+// counterIncrease returns the increase of a counter. A counter that fell below half of its previous value was reset,
+// its increase is the counter after the reset. A smaller decrease, e.g. of removed likes or views, is no increase.
+func counterIncrease(previous, current int64) int64 {
+	if current < previous/2 {
+		return current
+	}
+	if current < previous {
+		return 0
 	}
+	return current - previous
+}
+
+// rangeGain holds the stats of a video at the end of the day before a range and at the end of its last day, and the gains in between.
+type rangeGain struct {
+	start, end               VideoStat
+	viewsGained, likesGained int64
+}
 
-	slices.SortFunc(timestamps, func(a, b time.Time) int {
-		return cmp.Compare(a.Unix(), b.Unix())
-	})
+// videoRangeGain returns the gains of a video within the range of Dates, an open end is today.
+// The counters at the start are the ones of the day before the range, a counter that decreased is handled by counterIncrease.
+func videoRangeGain(videoID int64, Dates Timeframe) (gain rangeGain, err error) {
+	end := lastReportingDay(Dates)
+	start := Database.ReportingDay(Dates.GetStartDate()).AddDate(0, 0, -1)
+	if gain.start, err = requestTimestamp(start, videoID); err != nil {
+		return gain, err
+	}
+	if gain.end, err = requestTimestamp(end, videoID); err != nil {
+		return gain, err
+	}
+	gain.viewsGained = counterIncrease(gain.start.Views.Data, gain.end.Views.Data)
+	gain.likesGained = counterIncrease(gain.start.Likes.Data, gain.end.Likes.Data)
+	return gain, nil
+}
 
+// collectStats requests the stats of a video in the unit starting at each timestamp, see bucketTimestamps.
+func collectStats(videoID int64, timestamps []time.Time, Timeframe string) (Bucket []VideoStat, err error) {
+	timeframe, _ := templates.ParseTimeframe(Timeframe)
 	for _, timestamp := range timestamps {
-		stat, err := requestTimestamp(timestamp, videoID)
+		stat, err := requestInterval(timestamp, unitEnd(timestamp, timeframe), videoID)
 		if err != nil {
 			return []VideoStat{}, err
 		}
 		Bucket = append(Bucket, stat)
 	}
-
-	Bucket = prepareStatsForViewing(Bucket)
 	return Bucket, nil
-
 }
 
 func prepareStatsForViewing(bucket []VideoStat) []VideoStat {
@@ -73,14 +143,15 @@ func prepareStatsForViewing(bucket []VideoStat) []VideoStat {
 	ViewsBiggest += 15
 	LikesBiggest += 15
 
+	var likesCurrentPercent, viewsCurrentPercent float64
 	for i, stat := range bucket {
-		likesCurrentPercent := float64(stat.Likes.Data) / max(float64(1), float64(LikesBiggest))
-		viewsCurrentPercent := float64(stat.Views.Data) / max(float64(1), float64(ViewsBiggest))
+		// unknown stats keep the line at the previous value, they are hidden by the charts.
+		if !stat.Unknown {
+			likesCurrentPercent = float64(stat.Likes.Data) / max(float64(1), float64(LikesBiggest))
+			viewsCurrentPercent = float64(stat.Views.Data) / max(float64(1), float64(ViewsBiggest))
+		}
 
 		if i+1 == len(bucket) {
-			bucket[i].Views.EndPercentage = viewsCurrentPercent
-			bucket[i].Likes.EndPercentage = likesCurrentPercent
-
 			bucket[i].Views.EndPercentage = viewsCurrentPercent
 			bucket[i].Likes.EndPercentage = likesCurrentPercent
 			break
@@ -0,0 +1,74 @@
+package StatsIO
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func TestExportDeltaStats(t *testing.T) {
+	// the counter is reset on day 4, day 6 was not collected.
+	var series VideoTimeSeries
+	collections := []time.Time{}
+	for day, views := range []int64{0, 10, 15, 30, 5, 8, -1, 20} {
+		if views < 0 {
+			continue
+		}
+		_ = series.insert(sampleDay(day), LikeView{Views: views})
+		collections = append(collections, sampleDay(day))
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &series)
+
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{
+		MissingDataPolicy: MissingDataUnknown,
+		Location:          time.UTC,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections}}),
+	}
+
+	got, err := ExportStatsForRequest(1, templates.FrontPageRequest{
+		Timeframe: "Daily",
+		Mode:      templates.ModeDelta,
+		Dates:     templates.TwoDateForm{StartDate: sampleDay(1), EndDate: sampleDay(7)},
+	})
+	if err != nil {
+		t.Fatalf("ExportDeltaStats() error = %v", err)
+	}
+	wantViews := []int64{10, 5, 15, 5, 3, 0, 0}
+	wantUnknown := []bool{false, false, false, false, false, true, true}
+	if len(got) != len(wantViews) {
+		t.Fatalf("ExportDeltaStats() returned %v buckets, want %v", len(got), len(wantViews))
+	}
+	for i, stat := range got {
+		if !stat.Time.Equal(sampleDay(i+1)) || stat.Views.Data != wantViews[i] || stat.Unknown != wantUnknown[i] {
+			t.Errorf("bucket %v = %v views on %v, unknown %v, want %v views on %v, unknown %v",
+				i, stat.Views.Data, stat.Time.Format(time.DateOnly), stat.Unknown, wantViews[i], sampleDay(i+1).Format(time.DateOnly), wantUnknown[i])
+		}
+	}
+}
+
+func Test_counterIncrease(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current int64
+		want              int64
+	}{
+		{name: "increase", previous: 10, current: 15, want: 5},
+		{name: "unchanged", previous: 10, current: 10, want: 0},
+		{name: "small decrease", previous: 30, current: 28, want: 0},
+		{name: "half of the previous value", previous: 30, current: 15, want: 0},
+		{name: "reset", previous: 30, current: 5, want: 5},
+		{name: "reset to zero", previous: 30, current: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterIncrease(tt.previous, tt.current); got != tt.want {
+				t.Errorf("counterIncrease(%v, %v) = %v, want %v", tt.previous, tt.current, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package StatsIO
+
+import (
+	"math"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+const (
+	// forecastHistoryDays is the number of days up to the last collection the forecast models are fitted to.
+	forecastHistoryDays = 8 * 7
+	// forecastSeason is the season of the Holt-Winters model in days, views follow a weekly pattern.
+	forecastSeason = 7
+	// forecastZ is the quantile of the normal distribution bounding the 95 % confidence intervals.
+	forecastZ = 1.96
+	// forecastDamping damps the trend of the Holt-Winters model, a trend of the gains does not continue for months.
+	forecastDamping = 0.9
+)
+
+// forecastSmoothing are the smoothing factors tried for the level, trend and season of the Holt-Winters model.
+var forecastSmoothing = []float64{0.1, 0.3, 0.5, 0.7, 0.9}
+
+// ForecastPoint is the projected likes and views of a video, or of the sum of a group of videos, at the end of the reporting day of Time.
+// The lower and upper bounds form an approximate 95 % confidence interval.
+type ForecastPoint struct {
+	Time                          time.Time
+	Views, ViewsLower, ViewsUpper float64
+	Likes, LikesLower, LikesUpper float64
+}
+
+// ForecastInterval holds the bounds of the confidence interval of a projected stat, see VideoStat.Forecast.
+type ForecastInterval struct {
+	ViewsLower int64 `json:"views_lower"`
+	ViewsUpper int64 `json:"views_upper"`
+	LikesLower int64 `json:"likes_lower"`
+	LikesUpper int64 `json:"likes_upper"`
+}
+
+// counterForecast is the projection of a counter, the gains of the days after its last value.
+type counterForecast struct {
+	last  float64
+	gains []float64
+	// sigma is the standard deviation of the error of a projected daily gain.
+	sigma float64
+}
+
+// at returns the counter projected h days after its last value, and the bounds of its confidence interval.
+// The errors of the days are treated as independent, a counter never falls below its last value.
+func (forecast counterForecast) at(h int) (value, lower, upper float64) {
+	value = forecast.last
+	for _, gain := range forecast.gains[:min(max(h, 0), len(forecast.gains))] {
+		value += gain
+	}
+	spread := forecastZ * forecast.sigma * math.Sqrt(float64(max(h, 0)))
+	return value, max(forecast.last, value-spread), value + spread
+}
+
+// ForecastVideos projects the likes and views of the videos, summed, at the end of the reporting day of each timestamp.
+// The models are fitted to the forecastHistoryDays up to the last collection, see fitCounter.
+func ForecastVideos(videoIDs []int64, timestamps []time.Time) (points []ForecastPoint) {
+	timeSeries := Database.current().timeSeries
+	if timeSeries == nil || timeSeries.LastTimestamp.IsZero() {
+		for _, timestamp := range timestamps {
+			points = append(points, ForecastPoint{Time: timestamp})
+		}
+		return points
+	}
+	lastDay := Database.ReportingDay(timeSeries.LastTimestamp)
+	horizon := 0
+	for _, timestamp := range timestamps {
+		horizon = max(horizon, int(calendarDay(timestamp)-calendarDay(lastDay)))
+	}
+
+	views, likes := dailyCounters(videoIDs, lastDay.AddDate(0, 0, -forecastHistoryDays), lastDay)
+	viewForecast, likeForecast := fitCounter(views, horizon), fitCounter(likes, horizon)
+	for _, timestamp := range timestamps {
+		h := int(calendarDay(timestamp) - calendarDay(lastDay))
+		point := ForecastPoint{Time: timestamp}
+		point.Views, point.ViewsLower, point.ViewsUpper = viewForecast.at(h)
+		point.Likes, point.LikesLower, point.LikesUpper = likeForecast.at(h)
+		points = append(points, point)
+	}
+	return points
+}
+
+// ForecastChannel projects the likes and views of the videos of the channel among videos, summed, see ForecastVideos.
+func ForecastChannel(channelID int64, videos []peertubeApi.VideoData, timestamps []time.Time) []ForecastPoint {
+	var videoIDs []int64
+	for _, video := range videos {
+		if video.Channel.ID == channelID {
+			videoIDs = append(videoIDs, video.ID)
+		}
+	}
+	return ForecastVideos(videoIDs, timestamps)
+}
+
+// ForecastRanking sets the projection at the end of the forecast periods of the request for each channel of a ranking of the videos, see RankingEntry.Forecast.
+// Like appendForecast, nothing is projected for a range ending before the last collection or in the Hourly timeframe.
+func ForecastRanking(ranking []RankingEntry, videos []peertubeApi.VideoData, request templates.FrontPageRequest) {
+	timeSeries := Database.current().timeSeries
+	if request.ForecastPeriods < 1 || request.Timeframe == templates.TimeframeHourly || timeSeries == nil {
+		return
+	}
+	if lastReportingDay(request.Dates).Before(Database.ReportingDay(timeSeries.LastTimestamp)) {
+		return
+	}
+	timestamps := forecastTimestamps(request.Dates, request.Interval(), request.ForecastPeriods)
+	if len(timestamps) == 0 {
+		return
+	}
+	for i := range ranking {
+		if ranking[i].ChannelID == 0 {
+			continue
+		}
+		point := ForecastChannel(ranking[i].ChannelID, videos, timestamps[len(timestamps)-1:])[0]
+		ranking[i].Forecast = &point
+	}
+}
+
+// dailyCounters returns the views and likes of the videos, summed, at the end of each reporting day from from to to.
+// The counters of a video are interpolated between its collections, they are carried backward before its first and forward after its last collection.
+// A video thereby gains nothing outside its collections, its first collection is no jump of the sum.
+// The days before the first collection of any of the videos are left out.
+func dailyCounters(videoIDs []int64, from, to time.Time) (views, likes []float64) {
+	length := int(calendarDay(to)-calendarDay(from)) + 1
+	views, likes = make([]float64, length), make([]float64, length)
+	firstCollected := length
+	for _, videoID := range videoIDs {
+		days, counters := collectedDays(videoID, from, unitEnd(to, templates.TimeframeDaily))
+		if len(days) == 0 {
+			continue
+		}
+		firstCollected = min(firstCollected, int(calendarDay(days[0])-calendarDay(from)))
+		next := 0
+		for i := range length {
+			day := calendarDay(from) + int64(i)
+			for next < len(days) && calendarDay(days[next]) <= day {
+				next++
+			}
+			var counter LikeView
+			switch {
+			case next == 0:
+				counter = counters[0]
+			case next == len(days) || calendarDay(days[next-1]) == day:
+				counter = counters[next-1]
+			default:
+				previous, following := calendarDay(days[next-1]), calendarDay(days[next])
+				ratio := float64(day-previous) / float64(following-previous)
+				views[i] += float64(counters[next-1].Views) + ratio*float64(counters[next].Views-counters[next-1].Views)
+				likes[i] += float64(counters[next-1].Likes) + ratio*float64(counters[next].Likes-counters[next-1].Likes)
+				continue
+			}
+			views[i] += float64(counter.Views)
+			likes[i] += float64(counter.Likes)
+		}
+	}
+	return views[firstCollected:], likes[firstCollected:]
+}
+
+// fitCounter fits a model to the daily gains of a counter and projects them for horizon days.
+// From two seasons of history on an additive Holt-Winters model with a weekly season and a damped trend is used,
+// the linear trend of the counter before. Projected gains are never negative, a decrease of the counter is treated as no gain.
+func fitCounter(values []float64, horizon int) (forecast counterForecast) {
+	forecast.gains = make([]float64, horizon)
+	if len(values) == 0 {
+		return forecast
+	}
+	forecast.last = values[len(values)-1]
+	gains := make([]float64, 0, len(values)-1)
+	for i := 1; i < len(values); i++ {
+		gains = append(gains, max(0, values[i]-values[i-1]))
+	}
+
+	var projected []float64
+	if len(gains) >= 2*forecastSeason {
+		projected, forecast.sigma = holtWinters(gains, horizon)
+	} else {
+		projected, forecast.sigma = linearTrend(values, horizon)
+	}
+	for i, gain := range projected {
+		forecast.gains[i] = max(0, gain)
+	}
+	return forecast
+}
+
+// linearTrend fits a least squares line to the daily values of a counter, its slope is projected as the gain of each of the horizon days.
+// sigma is the standard deviation of the daily gains around the slope.
+func linearTrend(values []float64, horizon int) (projected []float64, sigma float64) {
+	var slope float64
+	if len(values) > 1 {
+		n := float64(len(values))
+		var sumX, sumY, sumXY, sumXX float64
+		for i, value := range values {
+			x := float64(i)
+			sumX += x
+			sumY += value
+			sumXY += x * value
+			sumXX += x * x
+		}
+		slope = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	}
+
+	if len(values) > 2 {
+		var squaredErrors float64
+		for i := 1; i < len(values); i++ {
+			deviation := values[i] - values[i-1] - slope
+			squaredErrors += deviation * deviation
+		}
+		sigma = math.Sqrt(squaredErrors / float64(len(values)-2))
+	}
+
+	projected = make([]float64, horizon)
+	for h := range projected {
+		projected[h] = slope
+	}
+	return projected, sigma
+}
+
+// holtWinters fits an additive Holt-Winters model with a season of forecastSeason steps and a damped trend to the values and projects them for horizon steps.
+// The smoothing factors minimizing the squared one-step errors are chosen from forecastSmoothing, sigma is the standard deviation of these errors.
+// The values must cover at least two seasons.
+func holtWinters(values []float64, horizon int) (projected []float64, sigma float64) {
+	bestErrors := math.Inf(1)
+	for _, alpha := range forecastSmoothing {
+		for _, beta := range forecastSmoothing {
+			for _, gamma := range forecastSmoothing {
+				candidate, squaredErrors := holtWintersFit(values, horizon, alpha, beta, gamma)
+				if squaredErrors < bestErrors {
+					bestErrors, projected = squaredErrors, candidate
+				}
+			}
+		}
+	}
+	return projected, math.Sqrt(bestErrors / float64(len(values)-forecastSeason))
+}
+
+// holtWintersFit runs the model with the given smoothing factors over the values, it returns the projection and the sum of the squared one-step errors.
+// The level and trend start from the means of the first two seasons, the season from the deviations of the first season.
+func holtWintersFit(values []float64, horizon int, alpha, beta, gamma float64) (projected []float64, squaredErrors float64) {
+	var firstMean, secondMean float64
+	for i := range forecastSeason {
+		firstMean += values[i] / forecastSeason
+		secondMean += values[forecastSeason+i] / forecastSeason
+	}
+	level, trend := firstMean, (secondMean-firstMean)/forecastSeason
+	season := make([]float64, forecastSeason)
+	for i := range season {
+		season[i] = values[i] - firstMean
+	}
+
+	for t := forecastSeason; t < len(values); t++ {
+		value, seasonal := values[t], season[t%forecastSeason]
+		oneStepError := value - (level + forecastDamping*trend + seasonal)
+		squaredErrors += oneStepError * oneStepError
+
+		previousLevel := level
+		level = alpha*(value-seasonal) + (1-alpha)*(level+forecastDamping*trend)
+		trend = beta*(level-previousLevel) + (1-beta)*forecastDamping*trend
+		season[t%forecastSeason] = gamma*(value-level) + (1-gamma)*seasonal
+	}
+
+	projected = make([]float64, horizon)
+	var damping, damped float64 = 1, 0
+	for h := range projected {
+		damping *= forecastDamping
+		damped += damping
+		projected[h] = level + damped*trend + season[(len(values)+h)%forecastSeason]
+	}
+	return projected, squaredErrors
+}
+
+// forecastTimestamps returns the last unit of each of the periods following the range, see bucketTimestamps.
+func forecastTimestamps(Dates Timeframe, Timeframe string, periods int) (timestamps []time.Time) {
+	timeframe, intervalDays := templates.ParseTimeframe(Timeframe)
+	buckets, before := bucketTimestamps(Dates, Timeframe)
+	if len(buckets) == 0 {
+		return nil
+	}
+	// custom intervals are aligned to the first period of the range
+	origin := unitEnd(before, timeframe).Add(time.Nanosecond)
+	current := nextPeriodStart(periodStart(buckets[len(buckets)-1], timeframe, intervalDays, origin, Database.WeekStart), timeframe, intervalDays)
+	for range periods {
+		next := nextPeriodStart(current, timeframe, intervalDays)
+		timestamps = append(timestamps, previousUnit(next, timeframe))
+		current = next
+	}
+	return timestamps
+}
+
+// appendForecast appends the projected stats of the periods following the range of the request to the bucket, see VideoStat.Forecast.
+// A forecast continues the collected stats, nothing is appended to a range ending before the last collection or in the Hourly timeframe.
+func appendForecast(videoID int64, Bucket []VideoStat, request templates.FrontPageRequest) []VideoStat {
+	timeSeries := Database.current().timeSeries
+	if request.ForecastPeriods < 1 || request.Timeframe == templates.TimeframeHourly || len(Bucket) == 0 || timeSeries == nil {
+		return Bucket
+	}
+	last := Bucket[len(Bucket)-1].Time
+	if last.Before(Database.ReportingDay(timeSeries.LastTimestamp)) {
+		return Bucket
+	}
+	timestamps := forecastTimestamps(request.Dates, request.Interval(), request.ForecastPeriods)
+	points := ForecastVideos([]int64{videoID}, append([]time.Time{last}, timestamps...))
+
+	for i, point := range points[1:] {
+		stat := VideoStat{
+			Time:  point.Time,
+			Views: Stat{Data: int64(math.Round(point.Views))},
+			Likes: Stat{Data: int64(math.Round(point.Likes))},
+			Forecast: &ForecastInterval{
+				ViewsLower: int64(math.Round(point.ViewsLower)),
+				ViewsUpper: int64(math.Round(point.ViewsUpper)),
+				LikesLower: int64(math.Round(point.LikesLower)),
+				LikesUpper: int64(math.Round(point.LikesUpper)),
+			},
+		}
+		if request.Mode == templates.ModeDelta {
+			// the gains of the period, relative to the projection at the end of the previous one
+			previous := points[i]
+			stat.Views.Data = int64(math.Round(point.Views - previous.Views))
+			stat.Likes.Data = int64(math.Round(point.Likes - previous.Likes))
+			stat.Forecast = &ForecastInterval{
+				ViewsLower: int64(math.Round(max(0, point.ViewsLower-previous.Views))),
+				ViewsUpper: int64(math.Round(point.ViewsUpper - previous.Views)),
+				LikesLower: int64(math.Round(max(0, point.LikesLower-previous.Likes))),
+				LikesUpper: int64(math.Round(point.LikesUpper - previous.Likes)),
+			}
+		}
+		Bucket = append(Bucket, stat)
+	}
+	return Bucket
+}
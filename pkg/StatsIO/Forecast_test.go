@@ -0,0 +1,157 @@
+package StatsIO
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_fitCounter(t *testing.T) {
+	weekly := []float64{50, 50, 50, 50, 50, 200, 200}
+	tests := []struct {
+		name      string
+		gains     []float64
+		wantGains []float64
+	}{
+		{"no history", nil, []float64{0, 0, 0}},
+		{"single gain", []float64{30}, []float64{30, 30, 30}},
+		{"linear trend", []float64{10, 20, 30}, []float64{20, 20, 20}},
+		{"constant gains", []float64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100}, []float64{100, 100, 100}},
+		{"weekly season", append(append(append(append([]float64{}, weekly...), weekly...), weekly...), weekly...), weekly},
+		{"decreasing counter", []float64{-10, -10, -10}, []float64{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the counter starts at 1000 and gains the given views each day
+			values := []float64{1000}
+			for _, gain := range tt.gains {
+				values = append(values, values[len(values)-1]+gain)
+			}
+			if tt.gains == nil {
+				values = nil
+			}
+			forecast := fitCounter(values, len(tt.wantGains))
+			for i, want := range tt.wantGains {
+				if math.Abs(forecast.gains[i]-want) > want*0.1+0.5 {
+					t.Fatalf("fitCounter() gains = %v, want %v", forecast.gains, tt.wantGains)
+				}
+			}
+			value, lower, upper := forecast.at(len(tt.wantGains))
+			if lower > value || upper < value || lower < forecast.last {
+				t.Errorf("at() = %v in [%v, %v], want a value within its bounds, not below %v", value, lower, upper, forecast.last)
+			}
+		})
+	}
+}
+
+// forecastSampleDatabase publishes two videos, the first one gains 100 views a day from day 0 on,
+// the second one 10 views a day, it is collected from day 10 on with 500 views. The last collection is on day 20.
+func forecastSampleDatabase(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	first, second := &VideoTimeSeries{}, &VideoTimeSeries{}
+	var collections []time.Time
+	for day := range 21 {
+		collection := sampleDay(day).Add(12 * time.Hour)
+		collections = append(collections, collection)
+		_ = first.insert(collection, LikeView{Views: int64(100 * day), Likes: int64(day)})
+		if day >= 10 {
+			_ = second.insert(collection, LikeView{Views: int64(500 + 10*(day-10))})
+		}
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), first)
+	videos.Store(int64(2), second)
+	Database = StatsIO{
+		Location: time.UTC,
+		loaded:   publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections, FirstTimestamp: collections[0], LastTimestamp: collections[len(collections)-1]}}),
+	}
+}
+
+func TestForecastVideos(t *testing.T) {
+	forecastSampleDatabase(t)
+
+	points := ForecastVideos([]int64{1, 2}, []time.Time{sampleDay(20), sampleDay(27)})
+	if len(points) != 2 {
+		t.Fatalf("ForecastVideos() = %+v, want 2 points", points)
+	}
+	if points[0].Views != 2600 || points[0].ViewsLower != 2600 || points[0].ViewsUpper != 2600 {
+		t.Errorf("ForecastVideos() at the last collection = %+v, want the collected 2600 views", points[0])
+	}
+	if math.Abs(points[1].Views-(2600+7*110)) > 7*110*0.1 {
+		t.Errorf("ForecastVideos() one week later = %v views, want about %v", points[1].Views, 2600+7*110)
+	}
+	if math.Abs(points[1].Likes-27) > 1 {
+		t.Errorf("ForecastVideos() one week later = %v likes, want about 27", points[1].Likes)
+	}
+}
+
+func TestForecastRanking(t *testing.T) {
+	forecastSampleDatabase(t)
+	videos := []peertubeApi.VideoData{
+		{ID: 1, Name: "first", Channel: peertubeApi.Channel{ID: 1, Name: "a"}},
+		{ID: 2, Name: "second", Channel: peertubeApi.Channel{ID: 2, Name: "b"}},
+	}
+	// the daily range ends with the last collection, the seventh projected day is day 27.
+	request := templates.FrontPageRequest{Timeframe: templates.TimeframeDaily, ForecastPeriods: 7, Dates: templates.TwoDateForm{StartDate: sampleDay(14), EndDate: sampleDay(20)}}
+
+	tests := []struct {
+		name    string
+		group   string
+		request func(request templates.FrontPageRequest) templates.FrontPageRequest
+		// wantViews are the projected views of the entries by name, nil if nothing is projected.
+		wantViews map[string]float64
+	}{
+		{"channels", templates.RankChannels, func(request templates.FrontPageRequest) templates.FrontPageRequest { return request },
+			map[string]float64{"a": 2000 + 7*100, "b": 600 + 7*10}},
+		{"videos", templates.RankVideos, func(request templates.FrontPageRequest) templates.FrontPageRequest { return request }, nil},
+		{"no forecast periods", templates.RankChannels, func(request templates.FrontPageRequest) templates.FrontPageRequest {
+			request.ForecastPeriods = 0
+			return request
+		}, nil},
+		{"range before the last collection", templates.RankChannels, func(request templates.FrontPageRequest) templates.FrontPageRequest {
+			request.Dates.EndDate = sampleDay(19)
+			return request
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request(request)
+			ranking, err := Rank(videos, request.Dates, tt.group, templates.RankByViews)
+			if err != nil {
+				t.Fatalf("Rank() error = %v", err)
+			}
+			ForecastRanking(ranking, videos, request)
+			for _, entry := range ranking {
+				want, found := tt.wantViews[entry.Name]
+				if !found {
+					if entry.Forecast != nil {
+						t.Errorf("ForecastRanking() %s = %+v, want no forecast", entry.Name, *entry.Forecast)
+					}
+					continue
+				}
+				if entry.Forecast == nil || !entry.Forecast.Time.Equal(sampleDay(27)) || math.Abs(entry.Forecast.Views-want) > want*0.1 {
+					t.Errorf("ForecastRanking() %s = %+v, want about %v views on day 27", entry.Name, entry.Forecast, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_forecastTimestamps(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{Location: time.UTC, WeekStart: time.Monday}
+
+	// 2025-01-01 is a wednesday, the range ends within the week starting on 2025-01-13.
+	got := forecastTimestamps(templates.TwoDateForm{StartDate: sampleDay(0), EndDate: sampleDay(14)}, templates.TimeframeWeekly, 2)
+	want := []time.Time{sampleDay(25), sampleDay(32)}
+	if len(got) != len(want) || !got[0].Equal(want[0]) || !got[1].Equal(want[1]) {
+		t.Errorf("forecastTimestamps() = %v, want %v", got, want)
+	}
+}
@@ -2,7 +2,6 @@ package StatsIO
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"io"
 	"os"
@@ -10,6 +9,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,17 +17,37 @@ import (
 	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
 )
 
+// ImportFromRaw stores the pages of a collection as its raw file and imports it.
+// The pages are validated against the PeerTube API schema first, see ValidateSnapshot, an invalid collection is written to the
+// QuarantineFolder instead and ErrInvalidSnapshot is returned.
 func (statIO *StatsIO) ImportFromRaw(rawResponses [][]byte, serverVersion string, CollectionTime time.Time) (err error) {
-	allResponses := []byte("# Peertube API Version: " + serverVersion + "\r\n")
+	allResponses := []byte(rawHeaderPrefix + serverVersion + "\r\n")
 	for _, response := range rawResponses {
 		allResponses = append(allResponses, response...)
 	}
 
+	validation, err := ValidateSnapshot(rawResponses)
+	if err != nil {
+		return errors.Join(errors.New("cannot validate raw stats"), err)
+	}
+	logSnapshotDrift(validation, CollectionTime)
+	if !validation.Valid {
+		quarantinePath, quarantineErr := statIO.quarantineSnapshot(allResponses, validation, CollectionTime)
+		if quarantineErr != nil {
+			return errors.Join(ErrInvalidSnapshot, errors.New("cannot quarantine raw stats"), quarantineErr)
+		}
+		return errors.Join(ErrInvalidSnapshot, errors.New("raw stats quarantined to "+quarantinePath))
+	}
+
 	dataPath := getRawFilePath(CollectionTime)
+	if _, _, archived := splitArchivePath(dataPath); archived || !strings.HasSuffix(dataPath, rawFileSuffix) {
+		// a compressed or archived collection is replaced by a new raw file, which is preferred over it
+		dataPath = absolutePath(rawFileCandidates(Database.DataFolder, rawFileName(CollectionTime))[0])
+	}
 	err = os.MkdirAll(path.Dir(dataPath), 0700)
 	LogHelp.LogOnError("cannot create directory", map[string]string{"path": dataPath}, err)
 
-	err = os.WriteFile(getRawFilePath(CollectionTime), allResponses, 0600)
+	err = os.WriteFile(dataPath, allResponses, 0600)
 	if err != nil {
 		return errors.Join(errors.New("failed to write raw stats"), err)
 	}
@@ -41,6 +61,8 @@ processRawImport validates the raw data, loads additional data, and updates the
 It errors to the LogHelp utility, as it is meant to run concurrently.
 */
 func (statIO *StatsIO) processRawImport(collectionTime time.Time) {
+	// the time series and lifecycle record the collection with the timestamp of its raw file, the same way as a rebuild from raw does.
+	collectionTime = statIO.CollectionTimestamp(collectionTime)
 	videos := readRawResponses(collectionTime) // TODO: Adapt to stateless port
 	var videosDb = sync.Map{}
 	var LocalWg sync.WaitGroup
@@ -50,27 +72,8 @@ func (statIO *StatsIO) processRawImport(collectionTime time.Time) {
 		videosDb.Store(video.ID, video)
 		go func() {
 			defer LocalWg.Done()
-			thumbnailPath := path.Join(Database.DataFolder, video.ThumbnailPath)
-			mkErr := os.MkdirAll(path.Dir(thumbnailPath), 0700)
-			if mkErr != nil {
-				LogHelp.NewLog(LogHelp.Fatal, "cannot create directory", map[string]string{"path": path.Dir(thumbnailPath), "fullPath": thumbnailPath}).Log()
-			}
-			absPath, _ := filepath.Abs(thumbnailPath)
 			// BUG(Samuel): if the collectionTime is far in the past, it is impossible to retrieve the original thumbnail. the current thumbnail is obtained regardless (if it has the same path). This may be subject to a fix in the future.
-			if stat, _ := os.Stat(absPath); stat == nil { // if the file does not exist. load it.
-				thumb, err := statIO.Api.GetThumbnail(video.ID)
-				if err != nil {
-					LogHelp.NewLog(LogHelp.Error, "cannot get thumbnail", map[string]string{"error": err.Error(), "localPath": thumbnailPath, "videoID": strconv.FormatInt(video.ID, 10), "videoThumbnailPath": video.ThumbnailPath}).Log()
-					return // this stops execution for the thumbnail download.
-				}
-				fHandler, err := os.OpenFile(absPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
-				LogHelp.LogOnError("cannot open thumbnail file", map[string]interface{}{"error": err, "localPath": thumbnailPath}, err)
-				_, err = io.Copy(fHandler, bytes.NewBuffer(thumb))
-				if err != nil {
-					LogHelp.NewLog(LogHelp.Fatal, "cannot write thumbnail file", map[string]string{"error": err.Error()}).Log()
-					return
-				}
-			}
+			LogHelp.LogOnError("cannot store thumbnail", map[string]string{"videoID": strconv.FormatInt(video.ID, 10), "videoThumbnailPath": video.ThumbnailPath}, statIO.ensureThumbnail(video))
 		}()
 	}
 
@@ -82,55 +85,199 @@ func (statIO *StatsIO) processRawImport(collectionTime time.Time) {
 
 	currentDB, err := loadVideoDB()
 	LogHelp.LogOnError("cannot load video db", nil, err)
-	deletedDB, err := LoadDeletedDBFromDisk()
-	LogHelp.LogOnError("cannot load deleted db", nil, err)
+	lifecycleDB, err := LoadLifecycleDBFromDisk()
+	LogHelp.LogOnError("cannot load lifecycle db", nil, err)
 
 	LocalWg.Wait()
 
-	err = mergeVideoDB(currentDB, &videosDb, deletedDB, collectionTime)
-	LogHelp.LogOnError("failed to merge input database into stored database", map[string]string{"collectionTime": collectionTime.Format("2006.01.02")}, err)
+	err = statIO.updateTimeSeries(videos, collectionTime)
+	LogHelp.LogOnError("failed to update time series", map[string]string{"collectionTime": collectionTime.Format("2006.01.02 15:04")}, err)
 
-	err = SaveDeletedDBToDisk(deletedDB)
-	LogHelp.LogOnError("failed to save deleted db to disk", nil, err)
+	err = updateVideoHistory(videos, collectionTime)
+	LogHelp.LogOnError("failed to update video history", map[string]string{"collectionTime": collectionTime.Format("2006.01.02 15:04")}, err)
+
+	err = mergeVideoDB(currentDB, &videosDb, lifecycleDB, collectionTime, false)
+	if errors.Is(err, errLifecycleConflict) {
+		// the collection was imported out of order, the recorded runs cannot be split without the raw data.
+		LogHelp.NewLog(LogHelp.Info, "lifecycle conflicts with the collection, rebuilding it from raw", map[string]string{"collectionTime": collectionTime.Format("2006.01.02 15:04")}).Log()
+		_, lifecycleDB = replayRawFiles(listRawFiles(), nil)
+		err = nil
+	}
+	LogHelp.LogOnError("failed to merge input database into stored database", map[string]string{"collectionTime": collectionTime.Format("2006.01.02 15:04")}, err)
+
+	err = SaveLifecycleDBToDisk(lifecycleDB)
+	LogHelp.LogOnError("failed to save lifecycle db to disk", nil, err)
+	statIO.update(func(loaded *loadedData) { loaded.lifecycleDb = lifecycleDB })
 	err = saveVideoDB(currentDB, time.Now())
 	LogHelp.LogOnError("failed to save video db to disk", nil, err)
 
 }
 
+// ensureThumbnail downloads the thumbnail of the video into the data folder, if it is not already present.
+func (statIO *StatsIO) ensureThumbnail(video peertubeApi.VideoData) error {
+	thumbnailPath := path.Join(Database.DataFolder, video.ThumbnailPath)
+	err := os.MkdirAll(path.Dir(thumbnailPath), 0700)
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Fatal, "cannot create directory", map[string]string{"path": path.Dir(thumbnailPath), "fullPath": thumbnailPath}).Log()
+		return err
+	}
+	absPath, _ := filepath.Abs(thumbnailPath)
+	if stat, _ := os.Stat(absPath); stat != nil {
+		return nil // the thumbnail is already present
+	}
+	if statIO.Api == nil {
+		return errors.New("cannot download thumbnail without an api client")
+	}
+	thumb, err := statIO.Api.GetThumbnail(video.ID)
+	if err != nil {
+		return errors.Join(errors.New("cannot get thumbnail"), err)
+	}
+	fHandler, err := os.OpenFile(absPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Join(errors.New("cannot open thumbnail file"), err)
+	}
+	defer fHandler.Close()
+	_, err = io.Copy(fHandler, bytes.NewBuffer(thumb))
+	if err != nil {
+		LogHelp.NewLog(LogHelp.Fatal, "cannot write thumbnail file", map[string]string{"error": err.Error()}).Log()
+	}
+	return err
+}
+
 func readRawResponses(collectionTime time.Time) (Videos []peertubeApi.VideoData) {
+	Videos, err := parseRawFile(getRawFilePath(collectionTime))
+	LogHelp.LogOnError("cannot read imported data", map[string]interface{}{"collectionTime": collectionTime.Format("2006.01.02 15:04")}, err)
+	return Videos
+}
+
+// parseRawFile reads a raw api dump from disk, see readRawFile for the forms it may be stored in.
+// The videos are normalised by the parsers of the PeerTube version in its header, see rawParsers.
+// On a parsing error the videos decoded up to that point are returned alongside the error.
+func parseRawFile(p string) (Videos []peertubeApi.VideoData, err error) {
 	Videos = make([]peertubeApi.VideoData, 0)
 
-	VideosBytes, err := os.ReadFile(getRawFilePath(collectionTime))
+	VideosBytes, err := readRawFile(p)
 	if err != nil {
-		LogHelp.LogOnError("cannot read imported data", map[string]interface{}{"collectionTime": collectionTime.Format("2006.01.02")}, err)
 		return
 	}
-	versionIndex := bytes.IndexByte(VideosBytes, byte('\n'))
-	if versionIndex == -1 {
-		LogHelp.NewLog(LogHelp.Error, "cannot find version header of raw data", map[string]interface{}{"collectionTime": collectionTime.Format("2006.01.02")}).Log()
-		versionIndex = 0
-	}
-	decoder := json.NewDecoder(bytes.NewReader(VideosBytes[versionIndex+1:]))
-	for {
-		var video peertubeApi.VideoResponse
-		err = decoder.Decode(&video)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+	version, body, found := splitRawHeader(VideosBytes)
+	if !found {
+		LogHelp.NewLog(LogHelp.Error, "cannot find version header of raw data", map[string]interface{}{"path": p}).Log()
+	}
+	pages, err := decodeRawPages(version, body)
+	for _, page := range pages {
+		Videos = slices.Concat(Videos, page.Data)
+	}
+	if err != nil {
+		return Videos, errors.Join(errors.New("error parsing imported data"), err)
+	}
+	return Videos, nil
+}
+
+// The layouts of raw file paths below the data folder, relative to the reporting time zone.
+// A collection is stored with the minute it was made in, files of the legacy layout hold one collection per day made at midnight.
+// The clock time of a collection within the hour repeated at the end of daylight saving time is ambiguous, the file of
+// the collection that the clock time is not parsed as carries the UTC offset, see rawFileName.
+const (
+	rawFileLayout       = "2006/01/02T1504"
+	rawFileOffsetLayout = "2006/01/02T1504-0700"
+	legacyRawFileLayout = "2006/01/02"
+)
+
+// rawFileName returns the path of the raw file of a collection below the data folder, without its suffix.
+func rawFileName(collectionTime time.Time) string {
+	collectionTime = Database.CollectionTimestamp(collectionTime)
+	name := collectionTime.Format(rawFileLayout)
+	if parsed, err := time.ParseInLocation(rawFileLayout, name, Database.ReportingLocation()); err != nil || !parsed.Equal(collectionTime) {
+		return collectionTime.Format(rawFileOffsetLayout)
+	}
+	return name
+}
+
+// parseRawFileName returns the collection time of the raw file of the given path below the data folder, without its suffix, see rawFileName.
+func parseRawFileName(name string) (collectionTime time.Time, err error) {
+	for _, layout := range []string{rawFileOffsetLayout, rawFileLayout, legacyRawFileLayout} {
+		collectionTime, err = time.ParseInLocation(layout, name, Database.ReportingLocation())
+		if err == nil {
+			return collectionTime.In(Database.ReportingLocation()), nil
+		}
+	}
+	return collectionTime, err
+}
+
+// listRawFiles walks the data folder and returns the collection time of every raw file, oldest first.
+// Compressed raw files and the raw files within the archives of the months are listed as well.
+func listRawFiles() (collectionTimes []time.Time) {
+	return listRawFilesIn(Database.DataFolder)
+}
+
+// listRawFilesIn lists the raw files of the given data folder, see listRawFiles.
+func listRawFilesIn(dataFolder string) (collectionTimes []time.Time) {
+	addRawFile := func(value string) {
+		collectionTime, err := parseRawFileName(value)
+		if err == nil {
+			collectionTimes = append(collectionTimes, collectionTime)
+		}
+	}
+	years, _ := os.ReadDir(dataFolder)
+	for _, year := range years {
+		if !year.IsDir() || len(year.Name()) != 4 {
+			continue
+		}
+		months, _ := os.ReadDir(path.Join(dataFolder, year.Name()))
+		for _, month := range months {
+			if !month.IsDir() && len(month.Name()) == 2+len(rawArchiveSuffix) && strings.HasSuffix(month.Name(), rawArchiveSuffix) {
+				for _, entry := range archiveEntries(path.Join(dataFolder, year.Name(), month.Name())) {
+					addRawFile(year.Name() + "/" + strings.TrimSuffix(month.Name(), rawArchiveSuffix) + "/" + strings.TrimSuffix(entry, rawFileSuffix))
+				}
+				continue
+			}
+			if !month.IsDir() || len(month.Name()) != 2 {
+				continue
+			}
+			days, _ := os.ReadDir(path.Join(dataFolder, year.Name(), month.Name()))
+			for _, day := range days {
+				name := strings.TrimSuffix(day.Name(), ".gz")
+				if day.IsDir() || !strings.HasSuffix(name, rawFileSuffix) {
+					continue
+				}
+				addRawFile(year.Name() + "/" + month.Name() + "/" + strings.TrimSuffix(name, rawFileSuffix))
 			}
-			LogHelp.LogOnError("error parsing imported data", map[string]interface{}{"collectionTime": collectionTime.Format("2006.01.02")}, err)
-			return
 		}
-		Videos = slices.Concat(Videos, video.Data)
 	}
-	return
+	slices.SortFunc(collectionTimes, func(a, b time.Time) int { return a.Compare(b) })
+	// a legacy file and a file collected at midnight hold the same collection, as do a raw file and its compressed form
+	return slices.CompactFunc(collectionTimes, func(a, b time.Time) bool { return a.Equal(b) })
 }
 
+// getRawFilePath returns the path of the raw file of a collection, see rawFileCandidates for the forms it may be stored in.
+// The legacy file of the day is used for collections at midnight, if it exists.
+// A collection that is not stored in any form returns the path a new raw file is written to.
 func getRawFilePath(collectionTime time.Time) (result string) {
-	inputPath := path.Join(Database.DataFolder, collectionTime.Format("2006"), collectionTime.Format("01"), collectionTime.Format("02")+".json")
-	abs, err := filepath.Abs(inputPath)
+	return rawFilePathIn(Database.DataFolder, collectionTime)
+}
+
+// rawFilePathIn returns the path of the raw file of a collection within the given data folder, see getRawFilePath.
+func rawFilePathIn(dataFolder string, collectionTime time.Time) (result string) {
+	collectionTime = Database.CollectionTimestamp(collectionTime)
+	var candidates []string
+	if collectionTime.Equal(Database.ReportingDay(collectionTime)) {
+		candidates = rawFileCandidates(dataFolder, collectionTime.Format(legacyRawFileLayout))
+	}
+	candidates = append(candidates, rawFileCandidates(dataFolder, rawFileName(collectionTime))...)
+	for _, candidate := range candidates {
+		if rawFileExists(candidate) {
+			return absolutePath(candidate)
+		}
+	}
+	return absolutePath(rawFileCandidates(dataFolder, rawFileName(collectionTime))[0])
+}
+
+// absolutePath returns the absolute form of a path, or the path itself if it cannot be resolved.
+func absolutePath(p string) string {
+	abs, err := filepath.Abs(p)
 	if err == nil {
 		return abs
 	}
-	return inputPath
+	return p
 }
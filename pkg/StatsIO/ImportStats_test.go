@@ -1,25 +1,29 @@
 package StatsIO
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
 )
 
 func Test_mergeVideoDB(t *testing.T) {
 	type lenStruct struct {
-		currentDb int
-		inputDb   int
-		deletedDb int
+		currentDb   int
+		inputDb     int
+		lifecycleDb int
 	}
 
 	type args struct {
 		currentData   *sync.Map
 		inputDatabase *sync.Map
-		deletedDb     *sync.Map
+		lifecycleDb   *sync.Map
 		recordedTs    time.Time
 	}
 	testVideo := peertubeApi.VideoData{
@@ -98,12 +102,12 @@ func Test_mergeVideoDB(t *testing.T) {
 			args: args{
 				currentData:   &sync.Map{},
 				inputDatabase: dbWithVid,
-				deletedDb:     &sync.Map{},
+				lifecycleDb:   &sync.Map{},
 			},
 			expectedLengths: lenStruct{
-				currentDb: 1,
-				inputDb:   1,
-				deletedDb: 0,
+				currentDb:   1,
+				inputDb:     1,
+				lifecycleDb: 1,
 			},
 			wantErr: false,
 		},
@@ -112,26 +116,26 @@ func Test_mergeVideoDB(t *testing.T) {
 			args: args{
 				currentData:   dbWithVid,
 				inputDatabase: &sync.Map{},
-				deletedDb:     &sync.Map{},
+				lifecycleDb:   &sync.Map{},
 			},
 			expectedLengths: lenStruct{
-				currentDb: 1,
-				inputDb:   0,
-				deletedDb: 1,
+				currentDb:   1,
+				inputDb:     0,
+				lifecycleDb: 1,
 			},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mergeVideoDB(tt.args.currentData, tt.args.inputDatabase, tt.args.deletedDb, tt.args.recordedTs)
+			err := mergeVideoDB(tt.args.currentData, tt.args.inputDatabase, tt.args.lifecycleDb, tt.args.recordedTs, false)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("mergeVideoDB() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			var currentDbLen, inputDbLen, deletedDbLen int
+			var currentDbLen, inputDbLen, lifecycleDbLen int
 			tt.args.currentData.Range(func(key, value interface{}) bool { currentDbLen++; return true })
 			tt.args.inputDatabase.Range(func(key, value interface{}) bool { inputDbLen++; return true })
-			tt.args.deletedDb.Range(func(key, value interface{}) bool { deletedDbLen++; return true })
+			tt.args.lifecycleDb.Range(func(key, value interface{}) bool { lifecycleDbLen++; return true })
 
 			if !reflect.DeepEqual(tt.expectedLengths.inputDb, inputDbLen) {
 				t.Errorf("expexted input length is not met. expected: %v, actual: %v", tt.expectedLengths.inputDb, inputDbLen)
@@ -139,9 +143,138 @@ func Test_mergeVideoDB(t *testing.T) {
 			if !reflect.DeepEqual(tt.expectedLengths.currentDb, currentDbLen) {
 				t.Errorf("expexted currentDb length is not met. expected: %v, actual: %v", tt.expectedLengths.currentDb, currentDbLen)
 			}
-			if !reflect.DeepEqual(tt.expectedLengths.deletedDb, deletedDbLen) {
-				t.Errorf("expexted deletedDb length is not met. expected: %v, actual: %v", tt.expectedLengths.deletedDb, deletedDbLen)
+			if !reflect.DeepEqual(tt.expectedLengths.lifecycleDb, lifecycleDbLen) {
+				t.Errorf("expexted lifecycleDb length is not met. expected: %v, actual: %v", tt.expectedLengths.lifecycleDb, lifecycleDbLen)
 			}
 		})
 	}
 }
+
+// writeRawFile writes a raw collection of video 1 with the given views, name is relative to the data folder.
+func writeRawFile(t *testing.T, dataFolder, name string, views int64) {
+	t.Helper()
+	rawPath := filepath.Join(dataFolder, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(rawPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	content := "# Peertube API Version: 7.0.0\r\n" + `{"total":1,"data":[{"id":1,"views":` + strconv.FormatInt(views, 10) + `}]}`
+	if err := os.WriteFile(rawPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubDailyCollections(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, MissingDataPolicy: MissingDataUnknown}
+
+	// day 1 and 2 use the legacy layout, on day 3 the video was released and collected every few hours.
+	writeRawFile(t, Database.DataFolder, "2025/01/01.json", 1)
+	writeRawFile(t, Database.DataFolder, "2025/01/02.json", 2)
+	writeRawFile(t, Database.DataFolder, "2025/01/03T0005.json", 3)
+	writeRawFile(t, Database.DataFolder, "2025/01/03T0210.json", 50)
+	writeRawFile(t, Database.DataFolder, "2025/01/03T0230.json", 80)
+	writeRawFile(t, Database.DataFolder, "2025/01/03T0400.json", 120)
+	writeRawFile(t, Database.DataFolder, "2025/01/03T2345.json", 400)
+
+	at := func(value string) time.Time {
+		parsed, _ := time.Parse("2006-01-02 15:04", value)
+		return parsed
+	}
+	wantCollections := []time.Time{at("2025-01-01 00:00"), at("2025-01-02 00:00"), at("2025-01-03 00:05"), at("2025-01-03 02:10"), at("2025-01-03 02:30"), at("2025-01-03 04:00"), at("2025-01-03 23:45")}
+	collections := listRawFiles()
+	if len(collections) != len(wantCollections) {
+		t.Fatalf("listRawFiles() = %v, want %v", collections, wantCollections)
+	}
+	for i := range collections {
+		if !collections[i].Equal(wantCollections[i]) {
+			t.Fatalf("listRawFiles() = %v, want %v", collections, wantCollections)
+		}
+	}
+	if got, want := getRawFilePath(at("2025-01-02 00:00")), filepath.Join(Database.DataFolder, "2025", "01", "02.json"); got != want {
+		t.Errorf("getRawFilePath() of a legacy collection = %v, want %v", got, want)
+	}
+	if got, want := getRawFilePath(at("2025-01-03 02:30").Add(42*time.Second)), filepath.Join(Database.DataFolder, "2025", "01", "03T0230.json"); got != want {
+		t.Errorf("getRawFilePath() of a sub-daily collection = %v, want %v", got, want)
+	}
+
+	timeSeries := buildTimeSeriesFromRaw(collections)
+	timeSeries.Collections = collections
+	Database.publish(&loadedData{timeSeries: timeSeries, lifecycleDb: &sync.Map{}})
+
+	tests := []struct {
+		name      string
+		timeframe string
+		start     string
+		end       string
+		wantViews []int64
+		// wantUnknown lists the buckets without a collection
+		wantUnknown map[int]bool
+	}{
+		{"a day ends with its last collection", templates.TimeframeDaily, "2025-01-01 00:00", "2025-01-03 00:00", []int64{1, 2, 400}, nil},
+		{"hours end with their last collection", templates.TimeframeHourly, "2025-01-03 00:00", "2025-01-03 00:00", []int64{3, 0, 80, 0, 120}, map[int]bool{1: true, 3: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExportStats(1, templates.TwoDateForm{StartDate: at(tt.start), EndDate: at(tt.end)}, tt.timeframe)
+			if err != nil {
+				t.Fatalf("ExportStats() error = %v", err)
+			}
+			if len(got) < len(tt.wantViews) {
+				t.Fatalf("ExportStats() returned %v buckets, want at least %v", len(got), len(tt.wantViews))
+			}
+			for i, wantViews := range tt.wantViews {
+				if tt.wantUnknown[i] {
+					if !got[i].Unknown {
+						t.Errorf("bucket %v at %v is known, want unknown", i, got[i].Time)
+					}
+					continue
+				}
+				if got[i].Views.Data != wantViews || got[i].Estimated {
+					t.Errorf("bucket %v at %v = %v views, estimated %v, want %v collected views", i, got[i].Time, got[i].Views.Data, got[i].Estimated, wantViews)
+				}
+			}
+		})
+	}
+}
+
+func TestImportFromRaw_fallBackNight(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: berlin, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataUnknown}
+
+	// on 2025-10-26 the clock is set back from 03:00 CEST to 02:00 CET, both hourly collections are made at 02:30 on the clock
+	summerTime := time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC)
+	winterTime := summerTime.Add(time.Hour)
+	for i, collectionTime := range []time.Time{summerTime, winterTime} {
+		page := []byte(`{"total":1,"data":[{"id":1,"views":` + strconv.Itoa(10*(i+1)) + `,"likes":0}]}`)
+		if err := Database.ImportFromRaw([][]byte{page}, "7.0.0", collectionTime); err != nil {
+			t.Fatalf("ImportFromRaw() at %v = %v", collectionTime, err)
+		}
+	}
+
+	collections := listRawFiles()
+	if len(collections) != 2 || !collections[0].Equal(summerTime) || !collections[1].Equal(winterTime) {
+		t.Fatalf("listRawFiles() = %v, want both collections of the repeated hour", collections)
+	}
+	if getRawFilePath(summerTime) == getRawFilePath(winterTime) {
+		t.Errorf("both collections are stored in %v", getRawFilePath(summerTime))
+	}
+	timeSeries, err := loadTimeSeries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, _ := timeSeries.Video.Load(int64(1))
+	for _, sample := range []struct {
+		at    time.Time
+		views int64
+	}{{summerTime, 10}, {winterTime, 20}} {
+		if got := series.(*VideoTimeSeries).At(sample.at); got.Views != sample.views {
+			t.Errorf("time series at %v = %v views, want %v", sample.at.In(berlin), got.Views, sample.views)
+		}
+	}
+}
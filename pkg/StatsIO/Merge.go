@@ -0,0 +1,321 @@
+package StatsIO
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+// The rules resolving a day that was collected into both data folders of a merge.
+const (
+	// MergeKeepAll keeps the collections of both folders, a collection made in the same minute is taken from the primary folder.
+	MergeKeepAll = "all"
+	// MergePrimary keeps the collections of the day of the primary folder only.
+	MergePrimary = "primary"
+	// MergeSecondary keeps the collections of the day of the secondary folder only.
+	MergeSecondary = "secondary"
+	// MergeMostVideos keeps the collections of the folder whose last collection of the day holds more videos, the primary folder on a tie.
+	MergeMostVideos = "most-videos"
+)
+
+// MergeRules lists the valid rules of MergeDataFolders.
+var MergeRules = []string{MergeKeepAll, MergePrimary, MergeSecondary, MergeMostVideos}
+
+// MergeConflict is a day that was collected into both data folders of a merge.
+type MergeConflict struct {
+	Day time.Time `json:"day"`
+	// Kept is MergePrimary, MergeSecondary or MergeKeepAll for both.
+	Kept      string      `json:"kept"`
+	Primary   []time.Time `json:"primary"`
+	Secondary []time.Time `json:"secondary"`
+}
+
+// MergeReport is the machine-readable summary of a MergeDataFolders run.
+type MergeReport struct {
+	Primary    string `json:"primary"`
+	Secondary  string `json:"secondary"`
+	DataFolder string `json:"data_folder"`
+	Rule       string `json:"rule"`
+	DryRun     bool   `json:"dry_run"`
+	// FromPrimary and FromSecondary count the collections taken from each folder.
+	FromPrimary   int             `json:"from_primary"`
+	FromSecondary int             `json:"from_secondary"`
+	Conflicts     []MergeConflict `json:"conflicts"`
+	Videos        int             `json:"videos"`
+	Thumbnails    int             `json:"thumbnails"`
+}
+
+// mergedCollection is a collection of a data folder that is taken into the merged data folder.
+type mergedCollection struct {
+	folder string
+	time   time.Time
+}
+
+// MergeDataFolders merges the raw files of two data folders into the empty data folder, e.g. after a second collector
+// filled the gap of the first one. A day collected into both folders is resolved by the rule, see MergeRules.
+// The derived files, the video database with its copies, the lifecycle, the time series and the video history, are rebuilt
+// from the merged raw files the same way CronSaveStats builds them, the thumbnails are copied from either folder.
+// Neither folder is modified, the collector locks of all three folders are held during the merge.
+// If dryRun is set, the resolved conflicts are reported without writing anything.
+func (statIO *StatsIO) MergeDataFolders(primary, secondary string, rule string, dryRun bool, lockWait time.Duration) (report MergeReport, err error) {
+	report = MergeReport{Primary: primary, Secondary: secondary, DataFolder: statIO.DataFolder, Rule: rule, DryRun: dryRun, Conflicts: []MergeConflict{}}
+	if !slices.Contains(MergeRules, rule) {
+		return report, errors.New("unknown merge rule " + rule + ", expected one of " + strings.Join(MergeRules, ", "))
+	}
+	folders := []string{filepath.Clean(primary), filepath.Clean(secondary), filepath.Clean(statIO.DataFolder)}
+	if folders[0] == folders[1] || folders[0] == folders[2] || folders[1] == folders[2] {
+		return report, errors.New("the primary, the secondary and the merged data folder must differ")
+	}
+	entries, _ := os.ReadDir(statIO.DataFolder)
+	if slices.ContainsFunc(entries, func(entry os.DirEntry) bool { return entry.Name() != CollectorLockFileName }) {
+		return report, errors.New("the merged data folder must be empty: " + statIO.DataFolder)
+	}
+
+	for _, folder := range []string{primary, secondary} {
+		// an older folder is read the same way its derived files are rebuilt by the migrations
+		if _, versionErr := ReadDataFolderVersion(folder); versionErr != nil {
+			return report, errors.Join(errors.New("cannot merge "+folder), versionErr)
+		}
+	}
+
+	for _, folder := range []string{primary, secondary, statIO.DataFolder} {
+		if dryRun && folder == statIO.DataFolder {
+			continue
+		}
+		unlock, lockErr := (&StatsIO{DataFolder: folder}).LockCollector(lockWait)
+		if lockErr != nil {
+			return report, errors.Join(errors.New("cannot lock "+folder), lockErr)
+		}
+		defer func() {
+			LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": folder}, unlock())
+		}()
+	}
+
+	collections := resolveMerge(&report, primary, secondary, rule)
+	if dryRun {
+		return report, nil
+	}
+
+	for _, collection := range collections {
+		if err = copyRawFile(collection.folder, statIO.DataFolder, collection.time); err != nil {
+			return report, err
+		}
+	}
+	if err = mergePartialRecords(statIO.DataFolder, collections); err != nil {
+		return report, errors.Join(errors.New("cannot record the backfilled and imported collections of the merged data folder"), err)
+	}
+	videoDb, err := statIO.rebuildDerivedFiles(listRawFiles())
+	if err == nil {
+		err = writeDataFolderVersion(statIO.DataFolder, DataFolderVersionFile{Version: DataFolderVersion, Migrations: []AppliedMigration{}})
+	}
+	if err != nil {
+		return report, errors.Join(errors.New("cannot rebuild the merged data folder"), err)
+	}
+	videoDb.Range(func(_, value interface{}) bool {
+		report.Videos++
+		if copyThumbnail(value.(peertubeApi.VideoData), []string{primary, secondary}, statIO.DataFolder) {
+			report.Thumbnails++
+		}
+		return true
+	})
+	return report, nil
+}
+
+// mergePartialRecords records the backfilled and the imported collections taken into the merged data folder, they stay flagged.
+func mergePartialRecords(dataFolder string, collections []mergedCollection) error {
+	backfill := BackfillRecord{Collections: []time.Time{}}
+	imported := ImportRecord{Collections: []time.Time{}, Sources: []ImportSource{}}
+	backfillRecords, importRecords := map[string]BackfillRecord{}, map[string]ImportRecord{}
+	for _, collection := range collections {
+		if _, found := backfillRecords[collection.folder]; !found {
+			backfillRecords[collection.folder], _ = ReadBackfillRecord(collection.folder)
+			importRecords[collection.folder], _ = ReadImportRecord(collection.folder)
+			imported.Sources = append(imported.Sources, importRecords[collection.folder].Sources...)
+		}
+		if record := backfillRecords[collection.folder]; isCollection(record.Collections, collection.time) {
+			backfill.Collections = append(backfill.Collections, collection.time)
+			backfill.Until, backfill.BackfilledAt = record.Until, record.BackfilledAt
+		}
+		if isCollection(importRecords[collection.folder].Collections, collection.time) {
+			imported.Collections = append(imported.Collections, collection.time)
+		}
+	}
+	var errs []error
+	if len(backfill.Collections) > 0 {
+		errs = append(errs, writeBackfillRecord(dataFolder, backfill))
+	}
+	if len(imported.Collections) > 0 {
+		errs = append(errs, writeImportRecord(dataFolder, imported))
+	}
+	return errors.Join(errs...)
+}
+
+// resolveMerge returns the collections of both folders that are taken into the merged data folder, oldest first.
+func resolveMerge(report *MergeReport, primary, secondary string, rule string) (collections []mergedCollection) {
+	days := func(collectionTimes []time.Time) map[time.Time][]time.Time {
+		grouped := make(map[time.Time][]time.Time)
+		for _, collectionTime := range collectionTimes {
+			day := Database.ReportingDay(collectionTime)
+			grouped[day] = append(grouped[day], collectionTime)
+		}
+		return grouped
+	}
+	primaryDays, secondaryDays := days(listRawFilesIn(primary)), days(listRawFilesIn(secondary))
+
+	take := func(folder string, collectionTimes []time.Time) {
+		for _, collectionTime := range collectionTimes {
+			collections = append(collections, mergedCollection{folder: folder, time: collectionTime})
+		}
+		if folder == primary {
+			report.FromPrimary += len(collectionTimes)
+		} else {
+			report.FromSecondary += len(collectionTimes)
+		}
+	}
+	allDays := slices.Collect(maps.Keys(primaryDays))
+	for day := range secondaryDays {
+		if _, found := primaryDays[day]; !found {
+			allDays = append(allDays, day)
+		}
+	}
+	slices.SortFunc(allDays, time.Time.Compare)
+	for _, day := range allDays {
+		primaryTimes, secondaryTimes := primaryDays[day], secondaryDays[day]
+		if len(primaryTimes) == 0 || len(secondaryTimes) == 0 {
+			take(primary, primaryTimes)
+			take(secondary, secondaryTimes)
+			continue
+		}
+
+		conflict := MergeConflict{Day: day, Kept: rule, Primary: primaryTimes, Secondary: secondaryTimes}
+		if rule == MergeMostVideos {
+			conflict.Kept = MergePrimary
+			if countVideos(secondary, secondaryTimes[len(secondaryTimes)-1]) > countVideos(primary, primaryTimes[len(primaryTimes)-1]) {
+				conflict.Kept = MergeSecondary
+			}
+		}
+		switch conflict.Kept {
+		case MergePrimary:
+			take(primary, primaryTimes)
+		case MergeSecondary:
+			take(secondary, secondaryTimes)
+		default:
+			take(primary, primaryTimes)
+			take(secondary, slices.DeleteFunc(slices.Clone(secondaryTimes), func(collectionTime time.Time) bool {
+				return slices.ContainsFunc(primaryTimes, collectionTime.Equal)
+			}))
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+	slices.SortFunc(collections, func(a, b mergedCollection) int { return a.time.Compare(b.time) })
+	return collections
+}
+
+// countVideos returns the number of videos of a collection of the data folder.
+func countVideos(dataFolder string, collectionTime time.Time) int {
+	videos, err := parseRawFile(rawFilePathIn(dataFolder, collectionTime))
+	LogHelp.LogOnError("cannot count the videos of raw file", map[string]string{"path": rawFilePathIn(dataFolder, collectionTime)}, err)
+	return len(videos)
+}
+
+// copyRawFile copies the raw file of a collection from one data folder to another, uncompressed and under the same name.
+func copyRawFile(from, to string, collectionTime time.Time) error {
+	sourcePath := rawFilePathIn(from, collectionTime)
+	content, err := readRawFile(sourcePath)
+	if err != nil {
+		return errors.Join(errors.New("cannot read raw file "+sourcePath), err)
+	}
+	targetName := rawFileName(collectionTime)
+	if name := strings.TrimSuffix(filepath.Base(sourcePath), ".gz"); len(name) == len("02"+rawFileSuffix) {
+		targetName = Database.CollectionTimestamp(collectionTime).Format(legacyRawFileLayout)
+	}
+	targetPath := rawFileCandidates(to, targetName)[0]
+	if err = os.MkdirAll(filepath.Dir(targetPath), 0700); err == nil {
+		err = writeFileAtomically(targetPath, content)
+	}
+	if err != nil {
+		return errors.Join(errors.New("cannot write raw file "+targetPath), err)
+	}
+	return nil
+}
+
+// copyThumbnail copies the thumbnail of the video from the first folder that holds it, if the data folder lacks it.
+// It reports whether the thumbnail was copied.
+func copyThumbnail(video peertubeApi.VideoData, folders []string, dataFolder string) bool {
+	if video.ThumbnailPath == "" {
+		return false
+	}
+	targetPath := path.Join(dataFolder, video.ThumbnailPath)
+	if _, err := os.Stat(targetPath); err == nil {
+		return false
+	}
+	for _, folder := range folders {
+		content, err := os.ReadFile(path.Join(folder, video.ThumbnailPath))
+		if err != nil {
+			continue
+		}
+		err = os.MkdirAll(path.Dir(targetPath), 0700)
+		if err == nil {
+			err = os.WriteFile(targetPath, content, 0600)
+		}
+		LogHelp.LogOnError("cannot copy thumbnail", map[string]string{"from": folder, "path": targetPath}, err)
+		return err == nil
+	}
+	return false
+}
+
+// rebuildDerivedFiles replays the raw files of the data folder and writes every file derived from them: videoDB.json with its
+// monthly and yearly copies, lifecycle.json, the time series and the video history. It returns the video database.
+func (statIO *StatsIO) rebuildDerivedFiles(collectionTimes []time.Time) (videoDb *sync.Map, err error) {
+	videoDb = &sync.Map{}
+	lifecycleDb := &sync.Map{}
+	partial := partialCollections(statIO.DataFolder)
+	var errs []error
+	for i, collectionTime := range collectionTimes {
+		inputDB := &sync.Map{}
+		for _, video := range readRawResponses(collectionTime) {
+			inputDB.Store(video.ID, video)
+		}
+		if mergeErr := mergeVideoDB(videoDb, inputDB, lifecycleDb, collectionTime, isCollection(partial, collectionTime)); mergeErr != nil {
+			errs = append(errs, mergeErr)
+		}
+
+		// each copy holds the database at the end of its period
+		day := statIO.ReportingDay(collectionTime)
+		var next time.Time
+		if i+1 < len(collectionTimes) {
+			next = statIO.ReportingDay(collectionTimes[i+1])
+		}
+		if next.IsZero() || next.Year() != day.Year() || next.Month() != day.Month() {
+			errs = append(errs, writeVideoDB(path.Join(statIO.DataFolder, day.Format("2006"), day.Format("1")+".json"), videoDb))
+		}
+		if next.IsZero() || next.Year() != day.Year() {
+			errs = append(errs, writeVideoDB(path.Join(statIO.DataFolder, day.Format("2006")+".json"), videoDb))
+		}
+	}
+	errs = append(errs,
+		writeVideoDB(path.Join(statIO.DataFolder, "videoDB.json"), videoDb),
+		SaveLifecycleDBToDisk(lifecycleDb),
+		serializeTimeSeries(buildTimeSeriesFromRaw(collectionTimes)),
+		rebuildVideoHistory(collectionTimes),
+	)
+	return videoDb, errors.Join(errs...)
+}
+
+// writeVideoDB writes the video database to p in the format of videoDB.json.
+func writeVideoDB(p string, videoDb *sync.Map) error {
+	byts, err := encodeVideoDB(videoDb)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, byts, 0600)
+}
@@ -0,0 +1,82 @@
+package StatsIO
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeDataFolders(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// the primary collector ran until the morning of day 3, the secondary one from the noon of day 3 on.
+	// the secondary collection of day 3 holds a second video.
+	at := func(day, hour int) time.Time { return sampleDay(day).Add(time.Duration(hour) * time.Hour) }
+	writeFolder := func(t *testing.T, names map[string]int64) string {
+		folder := t.TempDir()
+		for name, views := range names {
+			writeRawFile(t, folder, name, views)
+		}
+		return folder
+	}
+
+	tests := []struct {
+		name            string
+		rule            string
+		wantCollections []time.Time
+		wantKept        string
+	}{
+		{"keep all", MergeKeepAll, []time.Time{at(0, 0), at(1, 0), at(2, 0), at(2, 9), at(2, 12), at(3, 12)}, MergeKeepAll},
+		{"prefer the primary folder", MergePrimary, []time.Time{at(0, 0), at(1, 0), at(2, 0), at(2, 9), at(3, 12)}, MergePrimary},
+		{"prefer the secondary folder", MergeSecondary, []time.Time{at(0, 0), at(1, 0), at(2, 0), at(2, 12), at(3, 12)}, MergeSecondary},
+		{"prefer the folder with more videos", MergeMostVideos, []time.Time{at(0, 0), at(1, 0), at(2, 0), at(2, 12), at(3, 12)}, MergeSecondary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := writeFolder(t, map[string]int64{"2025/01/01.json": 1, "2025/01/02.json": 2, "2025/01/03T0000.json": 3, "2025/01/03T0900.json": 4})
+			secondary := writeFolder(t, map[string]int64{"2025/01/03.json": 3, "2025/01/03T1200.json": 5, "2025/01/04T1200.json": 6})
+			secondVideo := "# Peertube API Version: 7.0.0\r\n" + `{"total":2,"data":[{"id":1,"views":5},{"id":2,"views":1}]}`
+			if err := os.WriteFile(filepath.Join(secondary, "2025", "01", "03T1200.json"), []byte(secondVideo), 0600); err != nil {
+				t.Fatal(err)
+			}
+			Database = StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data"), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataCarryForward}
+
+			report, err := Database.MergeDataFolders(primary, secondary, tt.rule, false, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Conflicts) != 1 || !report.Conflicts[0].Day.Equal(sampleDay(2)) || report.Conflicts[0].Kept != tt.wantKept {
+				t.Errorf("MergeDataFolders() conflicts = %+v, want day 2 kept by %s", report.Conflicts, tt.wantKept)
+			}
+			if collections := listRawFiles(); !slices.EqualFunc(collections, tt.wantCollections, time.Time.Equal) {
+				t.Errorf("merged collections = %v, want %v", collections, tt.wantCollections)
+			}
+			for _, folder := range []string{primary, secondary} {
+				if _, err := os.Stat(filepath.Join(folder, CollectorLockFileName)); !os.IsNotExist(err) {
+					t.Errorf("the collector lock of %s was not released: %v", folder, err)
+				}
+			}
+
+			check, err := Database.CheckDataFolder(false, 0)
+			if err != nil || check.Unresolved > 0 {
+				t.Errorf("CheckDataFolder() of the merged folder = %+v, %v, want it to be consistent", check.Issues, err)
+			}
+		})
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		primary := writeFolder(t, map[string]int64{"2025/01/01.json": 1})
+		secondary := writeFolder(t, map[string]int64{"2025/01/01T1200.json": 2})
+		Database = StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data"), Location: time.UTC}
+		report, err := Database.MergeDataFolders(primary, secondary, MergeKeepAll, true, 0)
+		if err != nil || len(report.Conflicts) != 1 || report.FromPrimary != 1 || report.FromSecondary != 1 {
+			t.Errorf("MergeDataFolders() = %+v, %v, want one conflict and one collection of each folder", report, err)
+		}
+		if _, err := os.Stat(Database.DataFolder); !os.IsNotExist(err) {
+			t.Errorf("a dry run wrote the merged data folder: %v", err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package StatsIO
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// EngagementMetrics are derived from the counters of a video, or of a group of videos, at the end of a bucket or a range.
+// The time series holds the likes and views only, the dislikes and comments are the counters of the metadata that was valid at that time, see GetVideoAt.
+type EngagementMetrics struct {
+	// Time is the time of the bucket, see VideoStat.Time, or the last day of the range.
+	Time  time.Time `json:"time"`
+	Views int64     `json:"views"`
+	Likes int64     `json:"likes"`
+	// LikeRatio is the number of likes per view.
+	LikeRatio float64 `json:"like_ratio"`
+	// DislikeRatio is the share of the dislikes within all ratings, the likes and the dislikes.
+	DislikeRatio float64 `json:"dislike_ratio"`
+	// CommentsPerThousandViews is the number of comments per 1000 views.
+	CommentsPerThousandViews float64 `json:"comments_per_1k_views"`
+	// ViewsPerDay is the number of views per day since the publication, the first day counts as a whole day.
+	ViewsPerDay float64 `json:"views_per_day"`
+	// WatchHours estimates the watch time, as if every view watched the whole video.
+	WatchHours float64 `json:"watch_hours"`
+	Estimated  bool    `json:"estimated"`
+	Unknown    bool    `json:"unknown"`
+}
+
+// VideoMetrics are the metrics of a video at the end of the range of a request, and at the end of each of its buckets.
+type VideoMetrics struct {
+	VideoID int64               `json:"video_id"`
+	Name    string              `json:"name"`
+	Range   EngagementMetrics   `json:"range"`
+	Buckets []EngagementMetrics `json:"buckets"`
+}
+
+// engagementCounters sums up the counters the metrics are derived from.
+type engagementCounters struct {
+	views, likes, dislikes, comments int64
+	viewsPerDay, watchHours          float64
+}
+
+// add adds the counters of a video at the given time, the stat holds its likes and views at that time.
+// The other counters are read from the metadata that was valid at that time, the given metadata is used if none was recorded.
+func (counters *engagementCounters) add(video peertubeApi.VideoData, stat VideoStat, at time.Time) {
+	if historic, err := GetVideoAt(video.ID, at); err == nil {
+		video = historic
+	}
+	counters.views += stat.Views.Data
+	counters.likes += stat.Likes.Data
+	counters.dislikes += video.Dislikes
+	counters.comments += video.Comments
+	counters.watchHours += float64(stat.Views.Data) * float64(video.Duration) / 3600
+	if published, err := video.GetPublishedAt(); err == nil && at.After(published) {
+		counters.viewsPerDay += float64(stat.Views.Data) / max(1, at.Sub(published).Hours()/24)
+	}
+}
+
+// metrics derives the metrics of the counters.
+func (counters engagementCounters) metrics(at time.Time) EngagementMetrics {
+	return EngagementMetrics{
+		Time:                     at,
+		Views:                    counters.views,
+		Likes:                    counters.likes,
+		LikeRatio:                float64(counters.likes) / float64(max(1, counters.views)),
+		DislikeRatio:             float64(counters.dislikes) / float64(max(1, counters.likes+counters.dislikes)),
+		CommentsPerThousandViews: float64(counters.comments) * 1000 / float64(max(1, counters.views)),
+		ViewsPerDay:              counters.viewsPerDay,
+		WatchHours:               counters.watchHours,
+	}
+}
+
+// BucketMetrics returns the metrics of a video at the end of each bucket of the range and timeframe.
+func BucketMetrics(video peertubeApi.VideoData, Dates Timeframe, Timeframe string) (metrics []EngagementMetrics, err error) {
+	bucket, err := ExportStats(video.ID, Dates, Timeframe)
+	if err != nil {
+		return nil, err
+	}
+	timeframe, _ := templates.ParseTimeframe(Timeframe)
+	for _, stat := range bucket {
+		var counters engagementCounters
+		end := unitEnd(stat.Time, timeframe)
+		counters.add(video, stat, end)
+		metric := counters.metrics(stat.Time)
+		metric.Estimated, metric.Unknown = stat.Estimated, stat.Unknown
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// RangeMetrics returns the metrics of the videos together at the end of the range, an open end is today.
+// The ratios are derived from the summed up counters, the views per day and the watch hours are summed up.
+// Videos whose stats cannot be resolved are left out, their errors are joined.
+func RangeMetrics(videos []peertubeApi.VideoData, Dates Timeframe) (metrics EngagementMetrics, err error) {
+	end := lastReportingDay(Dates)
+	at := unitEnd(end, templates.TimeframeDaily)
+
+	var errs []error
+	var counters engagementCounters
+	var estimated, unknown bool
+	for _, video := range videos {
+		stat, statErr := requestTimestamp(end, video.ID)
+		if statErr != nil {
+			errs = append(errs, errors.Join(errors.New("cannot derive the metrics of video "+strconv.FormatInt(video.ID, 10)), statErr))
+			continue
+		}
+		counters.add(video, stat, at)
+		estimated, unknown = estimated || stat.Estimated, unknown || stat.Unknown
+	}
+	metrics = counters.metrics(end)
+	metrics.Estimated, metrics.Unknown = estimated, unknown
+	return metrics, errors.Join(errs...)
+}
+
+// ExportMetrics returns the metrics of each video within the range and timeframe of the request, see VideoMetrics.
+func ExportMetrics(videos []peertubeApi.VideoData, request templates.FrontPageRequest) (exported []VideoMetrics, err error) {
+	var errs []error
+	for _, video := range videos {
+		rangeMetrics, rangeErr := RangeMetrics([]peertubeApi.VideoData{video}, request.Dates)
+		buckets, bucketErr := BucketMetrics(video, request.Dates, request.Interval())
+		if rangeErr != nil || bucketErr != nil {
+			errs = append(errs, rangeErr, bucketErr)
+			continue
+		}
+		exported = append(exported, VideoMetrics{VideoID: video.ID, Name: video.Name, Range: rangeMetrics, Buckets: buckets})
+	}
+	return exported, errors.Join(errs...)
+}
+
+// DislikePercent returns the dislike ratio in percent.
+func (metrics EngagementMetrics) DislikePercent() float64 {
+	return metrics.DislikeRatio * 100
+}
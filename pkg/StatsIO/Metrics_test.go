@@ -0,0 +1,119 @@
+package StatsIO
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func TestRangeMetrics(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	// the first video gains 100 views and 10 likes a day, the second one 50 views and no likes, both are collected at noon of days 0 to 9.
+	var first, second VideoTimeSeries
+	var collections []time.Time
+	for day := range 10 {
+		collection := sampleDay(day).Add(12 * time.Hour)
+		collections = append(collections, collection)
+		_ = first.insert(collection, LikeView{Views: int64(day+1) * 100, Likes: int64(day+1) * 10})
+		_ = second.insert(collection, LikeView{Views: int64(day+1) * 50})
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &first)
+	videos.Store(int64(2), &second)
+	Database = StatsIO{
+		Location:          time.UTC,
+		MissingDataPolicy: MissingDataCarryForward,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections, FirstTimestamp: collections[0]}}),
+	}
+	firstVideo := peertubeApi.VideoData{ID: 1, Duration: 360, Dislikes: 25, Comments: 5, PublishedAt: sampleDay(0).Format(time.RFC3339Nano)}
+	secondVideo := peertubeApi.VideoData{ID: 2, Duration: 720, Comments: 1, PublishedAt: sampleDay(5).Format(time.RFC3339Nano)}
+
+	tests := []struct {
+		name   string
+		videos []peertubeApi.VideoData
+		end    int
+		want   EngagementMetrics
+	}{
+		{"single video", []peertubeApi.VideoData{firstVideo}, 4, EngagementMetrics{
+			Views: 500, Likes: 50, LikeRatio: 0.1, DislikeRatio: 25.0 / 75, CommentsPerThousandViews: 10, ViewsPerDay: 100, WatchHours: 50,
+		}},
+		{"two videos", []peertubeApi.VideoData{firstVideo, secondVideo}, 9, EngagementMetrics{
+			Views: 1500, Likes: 100, LikeRatio: 100.0 / 1500, DislikeRatio: 0.2, CommentsPerThousandViews: 4, ViewsPerDay: 100 + 100, WatchHours: 100 + 100,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RangeMetrics(tt.videos, templates.TwoDateForm{StartDate: sampleDay(0), EndDate: sampleDay(tt.end)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Time = sampleDay(tt.end)
+			if !got.Time.Equal(tt.want.Time) || got.Views != tt.want.Views || got.Likes != tt.want.Likes {
+				t.Errorf("RangeMetrics() = %+v, want %+v", got, tt.want)
+			}
+			for _, metric := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"LikeRatio", got.LikeRatio, tt.want.LikeRatio},
+				{"DislikeRatio", got.DislikeRatio, tt.want.DislikeRatio},
+				{"CommentsPerThousandViews", got.CommentsPerThousandViews, tt.want.CommentsPerThousandViews},
+				{"ViewsPerDay", got.ViewsPerDay, tt.want.ViewsPerDay},
+				{"WatchHours", got.WatchHours, tt.want.WatchHours},
+			} {
+				if math.Abs(metric.got-metric.want) > 1e-6 {
+					t.Errorf("%s = %v, want %v", metric.name, metric.got, metric.want)
+				}
+			}
+		})
+	}
+
+	t.Run("buckets", func(t *testing.T) {
+		got, err := BucketMetrics(firstVideo, templates.TwoDateForm{StartDate: sampleDay(0), EndDate: sampleDay(9)}, templates.TimeframeDaily)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 10 {
+			t.Fatalf("BucketMetrics() returned %d buckets, want 10", len(got))
+		}
+		for day, metrics := range got {
+			if !metrics.Time.Equal(sampleDay(day)) || metrics.Views != int64(day+1)*100 || math.Abs(metrics.ViewsPerDay-100) > 1e-6 {
+				t.Errorf("day %d: got %+v, want %d views and 100 views per day", day, metrics, (day+1)*100)
+			}
+		}
+	})
+
+	t.Run("metadata at the end of the range", func(t *testing.T) {
+		Database.DataFolder = t.TempDir()
+		t.Cleanup(func() { Database.DataFolder = "" })
+		// the video had 5 dislikes and a comment until it was renamed on day 6
+		before, after := firstVideo, firstVideo
+		before.Dislikes, before.Comments = 5, 1
+		after.Name = "renamed"
+		var history VideoHistory
+		history.insert(before, sampleDay(0).Add(12*time.Hour))
+		history.insert(after, sampleDay(6).Add(12*time.Hour))
+		if err := os.MkdirAll(filepath.Join(Database.DataFolder, VideoHistoryFolderName), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveVideoHistory(firstVideo.ID, history); err != nil {
+			t.Fatal(err)
+		}
+		got, err := RangeMetrics([]peertubeApi.VideoData{firstVideo}, templates.TwoDateForm{StartDate: sampleDay(0), EndDate: sampleDay(4)})
+		if err != nil || math.Abs(got.DislikeRatio-5.0/55) > 1e-6 || math.Abs(got.CommentsPerThousandViews-2) > 1e-6 {
+			t.Errorf("RangeMetrics() = %+v, %v, want the dislikes and comments of day 4", got, err)
+		}
+		buckets, err := BucketMetrics(firstVideo, templates.TwoDateForm{StartDate: sampleDay(5), EndDate: sampleDay(6)}, templates.TimeframeDaily)
+		if err != nil || len(buckets) != 2 || math.Abs(buckets[0].DislikeRatio-5.0/65) > 1e-6 || math.Abs(buckets[1].DislikeRatio-25.0/95) > 1e-6 {
+			t.Errorf("BucketMetrics() = %+v, %v, want the dislikes before and after the rename", buckets, err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package StatsIO
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+)
+
+// DataFolderVersion is the version of the layout of the data folder written by this program.
+// Version 0 is a data folder written before versions were recorded.
+//
+// Version 1:
+//   - raw files are named YYYY/MM/DDTHHMM.json and start with the line "# Peertube API Version: <version>", see DataStorage.md
+//   - videoDB.json and its copies map from the video id to its metadata
+//   - TimeSeriesDB.json lists the videos and the first and last collection as VideosSaved, FirstItem and LastItem
+//   - the time series of a video holds a run per unchanged value, from the first to the last collection of the run
+//   - lifecycle.json and the History folder are recorded, lifecycle.json replaces deleted.json
+const DataFolderVersion = 1
+
+// DataFolderVersionFileName is the file within the data folder that records its version.
+const DataFolderVersionFileName = "version.json"
+
+// legacyDeletedFileName is the file a data folder of version 0 recorded the deleted videos in, it is replaced by the LifecycleDatabaseFileName.
+const legacyDeletedFileName = "deleted.json"
+
+// ErrNewerDataFolder is returned for a data folder written by a newer version of this program.
+var ErrNewerDataFolder = errors.New("the data folder was written by a newer version of peertubestats")
+
+// DataFolderVersionFile is the content of version.json.
+type DataFolderVersionFile struct {
+	Version    int                `json:"version"`
+	Migrations []AppliedMigration `json:"migrations"`
+}
+
+// AppliedMigration records a migration of the data folder, and the backup taken before it.
+type AppliedMigration struct {
+	From        int       `json:"from"`
+	To          int       `json:"to"`
+	Description string    `json:"description"`
+	MigratedAt  time.Time `json:"migrated_at"`
+	Backup      string    `json:"backup"`
+}
+
+// migration upgrades the data folder by one version.
+type migration struct {
+	description string
+	migrate     func(statIO *StatsIO) error
+}
+
+// migrations holds the migration from each version to the next one, migrations[v] upgrades version v to v+1.
+var migrations = []migration{
+	{"rebuild the files derived from the raw data in the layout of version 1", func(statIO *StatsIO) error {
+		_, err := statIO.rebuildDerivedFiles(listRawFiles())
+		if err != nil {
+			return err
+		}
+		// deleted.json recorded the collection a video went missing in, the lifecycle rebuilt from the raw data holds it as well.
+		err = os.Remove(path.Join(statIO.DataFolder, legacyDeletedFileName))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}},
+}
+
+// ReadDataFolderVersion returns the recorded version of the data folder.
+// A data folder without version.json is of version 0, or of the current version if it holds no data yet.
+func ReadDataFolderVersion(dataFolder string) (version DataFolderVersionFile, err error) {
+	versionBytes, err := os.ReadFile(path.Join(dataFolder, DataFolderVersionFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		version.Migrations = []AppliedMigration{}
+		if _, statErr := os.Stat(path.Join(dataFolder, "videoDB.json")); statErr != nil && len(listRawFilesIn(dataFolder)) == 0 {
+			version.Version = DataFolderVersion
+		}
+		return version, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(versionBytes, &version)
+	}
+	if err != nil {
+		return version, errors.Join(errors.New("cannot read the version of the data folder"), err)
+	}
+	if version.Version > DataFolderVersion {
+		return version, errors.Join(ErrNewerDataFolder, errors.New("data folder version "+strconv.Itoa(version.Version)+", supported up to "+strconv.Itoa(DataFolderVersion)))
+	}
+	return version, nil
+}
+
+// writeDataFolderVersion writes version.json to the data folder.
+func writeDataFolderVersion(dataFolder string, version DataFolderVersionFile) error {
+	versionBytes, err := json.MarshalIndent(version, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dataFolder, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomically(path.Join(dataFolder, DataFolderVersionFileName), versionBytes)
+}
+
+// MigrateDataFolder upgrades the data folder to DataFolderVersion one version after another, holding the collector lock.
+// A backup archive of the data folder is written next to it before each migration, it is recorded in version.json.
+// A data folder of a newer version returns ErrNewerDataFolder and is left untouched.
+func (statIO *StatsIO) MigrateDataFolder(lockWait time.Duration) (applied []AppliedMigration, err error) {
+	version, err := ReadDataFolderVersion(statIO.DataFolder)
+	if err != nil {
+		return nil, err
+	}
+	if version.Version == DataFolderVersion {
+		if _, statErr := os.Stat(path.Join(statIO.DataFolder, DataFolderVersionFileName)); statErr == nil {
+			return nil, nil
+		}
+		return nil, writeDataFolderVersion(statIO.DataFolder, version)
+	}
+
+	unlock, err := statIO.LockCollector(lockWait)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+	}()
+	for version.Version < DataFolderVersion {
+		step := migrations[version.Version]
+		backupPath := filepath.Clean(statIO.DataFolder) + ".v" + strconv.Itoa(version.Version) + "-" + time.Now().Format("20060102T150405") + ".tar.gz"
+		if _, err = statIO.BackupToFile(backupPath, lockWait); err != nil {
+			return applied, errors.Join(errors.New("cannot back up the data folder before migrating it"), err)
+		}
+		LogHelp.NewLog(LogHelp.Info, "migrating data folder", map[string]interface{}{"from": version.Version, "to": version.Version + 1, "migration": step.description, "backup": backupPath}).Log()
+		if err = step.migrate(statIO); err != nil {
+			return applied, errors.Join(errors.New("cannot migrate the data folder from version "+strconv.Itoa(version.Version)+", restore it from "+backupPath), err)
+		}
+		migrated := AppliedMigration{From: version.Version, To: version.Version + 1, Description: step.description, MigratedAt: time.Now(), Backup: backupPath}
+		version.Version++
+		version.Migrations = append(version.Migrations, migrated)
+		if err = writeDataFolderVersion(statIO.DataFolder, version); err != nil {
+			return applied, errors.Join(errors.New("cannot record the version of the migrated data folder"), err)
+		}
+		applied = append(applied, migrated)
+	}
+	return applied, nil
+}
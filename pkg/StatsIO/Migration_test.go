@@ -0,0 +1,109 @@
+package StatsIO
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateDataFolder(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	tests := []struct {
+		name string
+		// setup fills the data folder
+		setup       func(t *testing.T, dataFolder string)
+		wantApplied int
+		wantVersion int
+		wantErr     error
+	}{
+		{"empty data folder", func(t *testing.T, dataFolder string) {}, 0, DataFolderVersion, nil},
+		{"unversioned data folder", func(t *testing.T, dataFolder string) {
+			writeRawFile(t, dataFolder, "2025/01/01.json", 1)
+			writeRawFile(t, dataFolder, "2025/01/02T1200.json", 2)
+			// a time series of the layout before runs were recorded
+			if err := os.MkdirAll(filepath.Join(dataFolder, "TimeSeries"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dataFolder, "TimeSeries", "1.json"), []byte(`{"items":{"1":{"date":"2025-01-01T00:00:00Z","data":{"views":1}}}}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dataFolder, legacyDeletedFileName), []byte(`{"2":{"id":2,"deleted":"2025-01-02T12:00:00Z"}}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, 1, DataFolderVersion, nil},
+		{"current data folder", func(t *testing.T, dataFolder string) {
+			writeRawFile(t, dataFolder, "2025/01/01.json", 1)
+			if err := writeDataFolderVersion(dataFolder, DataFolderVersionFile{Version: DataFolderVersion}); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, DataFolderVersion, nil},
+		{"newer data folder", func(t *testing.T, dataFolder string) {
+			if err := writeDataFolderVersion(dataFolder, DataFolderVersionFile{Version: DataFolderVersion + 1}); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, DataFolderVersion + 1, ErrNewerDataFolder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Database = StatsIO{DataFolder: filepath.Join(t.TempDir(), "Data"), Location: time.UTC, StatIOMaxThreads: 2}
+			if err := os.MkdirAll(Database.DataFolder, 0700); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(t, Database.DataFolder)
+
+			applied, err := Database.MigrateDataFolder(0)
+			if !errors.Is(err, tt.wantErr) || len(applied) != tt.wantApplied {
+				t.Fatalf("MigrateDataFolder() = %+v, %v, want %d migrations, error %v", applied, err, tt.wantApplied, tt.wantErr)
+			}
+			version, _ := ReadDataFolderVersion(Database.DataFolder)
+			if version.Version != tt.wantVersion || len(version.Migrations) != tt.wantApplied {
+				t.Errorf("recorded version = %+v, want version %d with %d migrations", version, tt.wantVersion, tt.wantApplied)
+			}
+			if _, err := os.Stat(filepath.Join(Database.DataFolder, CollectorLockFileName)); !os.IsNotExist(err) {
+				t.Errorf("the collector lock was not released: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(Database.DataFolder, legacyDeletedFileName)); !os.IsNotExist(err) {
+				t.Errorf("%s was not replaced by the lifecycle: %v", legacyDeletedFileName, err)
+			}
+
+			for _, migration := range applied {
+				handle, err := os.Open(migration.Backup)
+				if err != nil {
+					t.Fatalf("backup of the migration from version %d: %v", migration.From, err)
+				}
+				manifest, err := extractBackup(handle, t.TempDir())
+				_ = handle.Close()
+				if err != nil || manifest.DataFolderVersion != migration.From {
+					t.Errorf("backup of the migration from version %d = version %d, %v", migration.From, manifest.DataFolderVersion, err)
+				}
+			}
+			if tt.wantApplied > 0 {
+				check, err := Database.CheckDataFolder(false, 0)
+				if err != nil || check.Unresolved > 0 {
+					t.Errorf("CheckDataFolder() of the migrated folder = %+v, %v, want it to be consistent", check.Issues, err)
+				}
+			}
+		})
+	}
+}
+
+func TestInit_newerDataFolder(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataUnknown}
+	writeRawFile(t, Database.DataFolder, "2025/01/01.json", 1)
+	if err := writeDataFolderVersion(Database.DataFolder, DataFolderVersionFile{Version: DataFolderVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Database.Init(nil); !errors.Is(err, ErrNewerDataFolder) {
+		t.Errorf("Init() = %v, want ErrNewerDataFolder", err)
+	}
+	if Database.loaded != nil || !LastReload().IsZero() {
+		t.Errorf("Init() of a newer data folder published its data")
+	}
+}
@@ -0,0 +1,119 @@
+package StatsIO
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// RankingEntry is a video, channel or category of a ranking, with its counters within the ranked range.
+type RankingEntry struct {
+	// Name is the name of the video or channel, or the label of the category.
+	Name string
+	// VideoID is only set in a ranking of videos.
+	VideoID int64
+	// ChannelID is only set in a ranking of channels.
+	ChannelID int64
+	// Videos is the number of videos the entry is made of.
+	Videos               int
+	ViewsStart, ViewsEnd int64
+	LikesStart, LikesEnd int64
+	ViewsGained          int64
+	LikesGained          int64
+	// GrowthRate is the views gained relative to the views at the start of the range, no views at the start count as one view.
+	GrowthRate float64
+	// LikeRatio is the number of likes per view at the end of the range.
+	LikeRatio float64
+	// Estimated is set if a counter of the entry was not collected at the start or the end of the range.
+	Estimated bool
+	// Forecast is the projection of the channel at the end of the forecast periods, it is set by ForecastRanking.
+	Forecast *ForecastPoint
+}
+
+// Value returns the metric of the entry the ranking is sorted by, see templates.RankMetrics.
+func (entry RankingEntry) Value(metric string) float64 {
+	switch metric {
+	case templates.RankByViewsGained:
+		return float64(entry.ViewsGained)
+	case templates.RankByLikesGained:
+		return float64(entry.LikesGained)
+	case templates.RankByGrowthRate:
+		return entry.GrowthRate
+	case templates.RankByLikeRatio:
+		return entry.LikeRatio
+	}
+	return float64(entry.ViewsEnd)
+}
+
+// GrowthPercent returns the growth rate in percent.
+func (entry RankingEntry) GrowthPercent() float64 {
+	return entry.GrowthRate * 100
+}
+
+// Rank ranks the videos, or their channels or categories, by the metric within the range of Dates, the best entry first.
+// The gains of each video are the ones of videoRangeGain.
+// Videos whose stats cannot be resolved are left out, their errors are joined.
+func Rank(videos []peertubeApi.VideoData, Dates Timeframe, group, metric string) (ranking []RankingEntry, err error) {
+	metric, group = templates.ParseRanking(metric, group)
+	var errs []error
+	entries := make(map[string]*RankingEntry)
+	for _, video := range videos {
+		gain, gainErr := videoRangeGain(video.ID, Dates)
+		if gainErr != nil {
+			errs = append(errs, errors.Join(errors.New("cannot rank video "+strconv.FormatInt(video.ID, 10)), gainErr))
+			continue
+		}
+
+		key, name := rankingKey(video, group)
+		entry, found := entries[key]
+		if !found {
+			entry = &RankingEntry{Name: name}
+			switch group {
+			case templates.RankVideos:
+				entry.VideoID = video.ID
+			case templates.RankChannels:
+				entry.ChannelID = video.Channel.ID
+			}
+			entries[key] = entry
+		}
+		entry.Videos++
+		entry.ViewsStart += gain.start.Views.Data
+		entry.ViewsEnd += gain.end.Views.Data
+		entry.LikesStart += gain.start.Likes.Data
+		entry.LikesEnd += gain.end.Likes.Data
+		entry.ViewsGained += gain.viewsGained
+		entry.LikesGained += gain.likesGained
+		entry.Estimated = entry.Estimated || gain.start.Estimated || gain.end.Estimated
+	}
+
+	ranking = make([]RankingEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.GrowthRate = float64(entry.ViewsGained) / float64(max(1, entry.ViewsStart))
+		entry.LikeRatio = float64(entry.LikesEnd) / float64(max(1, entry.ViewsEnd))
+		ranking = append(ranking, *entry)
+	}
+	slices.SortFunc(ranking, func(a, b RankingEntry) int {
+		return cmp.Or(cmp.Compare(b.Value(metric), a.Value(metric)), cmp.Compare(a.Name, b.Name), cmp.Compare(a.VideoID, b.VideoID))
+	})
+	return ranking, errors.Join(errs...)
+}
+
+// rankingKey returns the key identifying the entry of a video in a ranking of group, and the name of the entry.
+func rankingKey(video peertubeApi.VideoData, group string) (key string, name string) {
+	switch group {
+	case templates.RankChannels:
+		return strconv.FormatInt(video.Channel.ID, 10), cmp.Or(video.Channel.DisplayName, video.Channel.Name)
+	case templates.RankCategories:
+		return video.Category.Label, video.Category.Label
+	}
+	return strconv.FormatInt(video.ID, 10), video.Name
+}
+
+// TopRanked returns the first n entries of a ranking.
+func TopRanked(ranking []RankingEntry, n int) []RankingEntry {
+	return ranking[:min(n, len(ranking))]
+}
@@ -0,0 +1,84 @@
+package StatsIO
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func TestRank(t *testing.T) {
+	videos := []peertubeApi.VideoData{
+		{ID: 1, Name: "first", Channel: peertubeApi.Channel{ID: 1, Name: "a"}, Category: peertubeApi.Metadata{Label: "Music"}},
+		{ID: 2, Name: "second", Channel: peertubeApi.Channel{ID: 1, Name: "a"}, Category: peertubeApi.Metadata{Label: "Film"}},
+		{ID: 3, Name: "third", Channel: peertubeApi.Channel{ID: 2, Name: "b"}, Category: peertubeApi.Metadata{Label: "Music"}},
+	}
+	// the third video was published on day 1, the range starts on day 1.
+	collected := map[int64]map[int]LikeView{
+		1: {0: {Views: 100}, 3: {Views: 150, Likes: 10}},
+		2: {0: {Views: 10, Likes: 5}, 3: {Views: 40, Likes: 8}},
+		3: {1: {Views: 20}, 3: {Views: 200, Likes: 2}},
+	}
+	series := &sync.Map{}
+	for id, days := range collected {
+		var videoSeries VideoTimeSeries
+		for day := range 4 {
+			if data, found := days[day]; found {
+				_ = videoSeries.insert(sampleDay(day), data)
+			}
+		}
+		series.Store(id, &videoSeries)
+	}
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{
+		Location:          time.UTC,
+		MissingDataPolicy: MissingDataCarryForward,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: series, Collections: []time.Time{sampleDay(0), sampleDay(1), sampleDay(3)}}}),
+	}
+	dates := templates.TwoDateForm{StartDate: sampleDay(1), EndDate: sampleDay(3)}
+
+	tests := []struct {
+		group     string
+		metric    string
+		wantNames []string
+	}{
+		{templates.RankVideos, templates.RankByViews, []string{"third", "first", "second"}},
+		{templates.RankVideos, templates.RankByViewsGained, []string{"third", "first", "second"}},
+		{templates.RankVideos, templates.RankByLikesGained, []string{"first", "second", "third"}},
+		{templates.RankVideos, templates.RankByGrowthRate, []string{"third", "second", "first"}},
+		{templates.RankVideos, templates.RankByLikeRatio, []string{"second", "first", "third"}},
+		{templates.RankChannels, templates.RankByViewsGained, []string{"b", "a"}},
+		{templates.RankCategories, templates.RankByViews, []string{"Music", "Film"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.group+" by "+tt.metric, func(t *testing.T) {
+			got, err := Rank(videos, dates, tt.group, tt.metric)
+			if err != nil {
+				t.Fatalf("Rank() error = %v", err)
+			}
+			var gotNames []string
+			for _, entry := range got {
+				gotNames = append(gotNames, entry.Name)
+			}
+			if len(gotNames) != len(tt.wantNames) {
+				t.Fatalf("Rank() = %v, want %v", gotNames, tt.wantNames)
+			}
+			for i := range gotNames {
+				if gotNames[i] != tt.wantNames[i] {
+					t.Fatalf("Rank() = %v, want %v", gotNames, tt.wantNames)
+				}
+			}
+		})
+	}
+
+	channels, _ := Rank(videos, dates, templates.RankChannels, templates.RankByViewsGained)
+	if a := channels[1]; a.Videos != 2 || a.ViewsGained != 80 || a.ViewsStart != 110 || a.LikesEnd != 18 {
+		t.Errorf("Rank() channel a = %+v, want 2 videos, 80 views gained from 110, 18 likes", a)
+	}
+	if b := channels[0]; b.ViewsGained != 200 || b.GrowthRate != 200 {
+		t.Errorf("Rank() channel b = %+v, want 200 views gained without views at the start", b)
+	}
+}
@@ -0,0 +1,311 @@
+package StatsIO
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The forms a raw file is stored in. The content of a compressed raw file is the one received from the server, byte by byte.
+// A raw file may be compressed next to its own name, e.g. 2025/01/03T0230.json.gz, or be part of the archive of its month
+// in the year folder, e.g. 2025/01.zip, which holds the files of 2025/01/ by their names.
+const (
+	rawFileSuffix    = ".json"
+	rawGzipSuffix    = ".json.gz"
+	rawArchiveSuffix = ".zip"
+)
+
+// RawRetention configures the compression of old raw files, see StatsIO.RetainRawFiles.
+type RawRetention struct {
+	// CompressAfterDays is the age in days from which raw files are compressed, zero disables the retention.
+	CompressAfterDays int
+	// ArchiveMonths rolls each month that ended CompressAfterDays ago into one archive, instead of compressing its files one by one.
+	ArchiveMonths bool
+}
+
+// rawFileCandidates returns the paths a raw file with the given name below the data folder may be stored at, in the order they are preferred.
+// The name is relative to the data folder, without suffix, e.g. 2025/01/03T0230.
+func rawFileCandidates(dataFolder string, name string) []string {
+	base := path.Join(dataFolder, filepath.FromSlash(name))
+	monthFolder, fileName := filepath.Split(base)
+	archivePath := filepath.Clean(monthFolder) + rawArchiveSuffix
+	return []string{base + rawFileSuffix, base + rawGzipSuffix, filepath.Join(archivePath, fileName+rawFileSuffix)}
+}
+
+// splitArchivePath splits the path of a raw file within a monthly archive into the path of the archive and the name of its entry.
+func splitArchivePath(p string) (archivePath string, entry string, found bool) {
+	folder, entry := filepath.Split(p)
+	archivePath = filepath.Clean(folder)
+	if !strings.HasSuffix(archivePath, rawArchiveSuffix) {
+		return "", "", false
+	}
+	return archivePath, entry, true
+}
+
+// rawFileExists reports whether a raw file exists in any of its forms.
+func rawFileExists(p string) bool {
+	if archivePath, entry, found := splitArchivePath(p); found {
+		return slices.Contains(archiveEntries(archivePath), entry)
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// archiveEntries returns the names of the files within an archive, none if it cannot be read.
+func archiveEntries(archivePath string) (entries []string) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		entries = append(entries, file.Name)
+	}
+	return entries
+}
+
+// readRawFile returns the content of a raw file, a compressed or archived raw file is decompressed.
+func readRawFile(p string) ([]byte, error) {
+	if archivePath, entry, found := splitArchivePath(p); found {
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		file, err := reader.Open(entry)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+	if !strings.HasSuffix(p, rawGzipSuffix) {
+		return os.ReadFile(p)
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+	return io.ReadAll(decompressor)
+}
+
+// RetainRawFiles compresses the raw files of the collections made CompressAfterDays before now, see RawRetention.
+// A raw file is only removed after its compressed form was read back with the same content.
+// It returns the number of raw files compressed and the number of months archived, the errors of the files that were kept are joined.
+func (statIO *StatsIO) RetainRawFiles(retention RawRetention, now time.Time) (compressed int, archived int, err error) {
+	if retention.CompressAfterDays <= 0 {
+		return 0, 0, nil
+	}
+	threshold := statIO.ReportingDay(now).AddDate(0, 0, -retention.CompressAfterDays)
+
+	var errs []error
+	var months []time.Time
+	for _, collectionTime := range listRawFiles() {
+		day := statIO.ReportingDay(collectionTime)
+		month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		if retention.ArchiveMonths {
+			// a month is archived once all of its days passed the threshold
+			if month.AddDate(0, 1, 0).After(threshold) {
+				break
+			}
+			if len(months) == 0 || !months[len(months)-1].Equal(month) {
+				months = append(months, month)
+			}
+			continue
+		}
+		if !day.Before(threshold) {
+			break
+		}
+		rawPath := getRawFilePath(collectionTime)
+		if !strings.HasSuffix(rawPath, rawFileSuffix) || !rawFileExists(rawPath) {
+			continue
+		}
+		if compressErr := compressRawFile(rawPath); compressErr != nil {
+			errs = append(errs, compressErr)
+			continue
+		}
+		compressed++
+	}
+
+	for _, month := range months {
+		monthFolder := path.Join(statIO.DataFolder, month.Format("2006"), month.Format("01"))
+		files, archiveErr := archiveRawMonth(monthFolder)
+		if archiveErr != nil {
+			errs = append(errs, archiveErr)
+			continue
+		}
+		if files > 0 {
+			archived++
+		}
+	}
+	return compressed, archived, errors.Join(errs...)
+}
+
+// compressRawFile replaces a raw file by its gzip compressed form.
+func compressRawFile(rawPath string) error {
+	content, err := os.ReadFile(rawPath)
+	if err != nil {
+		return errors.Join(errors.New("cannot read raw file "+rawPath), err)
+	}
+	compressedPath := strings.TrimSuffix(rawPath, rawFileSuffix) + rawGzipSuffix
+	var buffer bytes.Buffer
+	compressor := gzip.NewWriter(&buffer)
+	compressor.Name = filepath.Base(rawPath)
+	if stat, statErr := os.Stat(rawPath); statErr == nil {
+		compressor.ModTime = stat.ModTime()
+	}
+	_, err = compressor.Write(content)
+	err = errors.Join(err, compressor.Close())
+	if err == nil {
+		err = writeFileAtomically(compressedPath, buffer.Bytes())
+	}
+	if err != nil {
+		return errors.Join(errors.New("cannot compress raw file "+rawPath), err)
+	}
+
+	written, err := readRawFile(compressedPath)
+	if err != nil || !bytes.Equal(written, content) {
+		_ = os.Remove(compressedPath)
+		return errors.Join(errors.New("compressed raw file differs from "+rawPath), err)
+	}
+	return os.Remove(rawPath)
+}
+
+// archiveRawMonth rolls the raw files of a month folder into the archive of the month, the folder is removed once it is empty.
+// Files already archived are kept, a file of the folder replaces an archived file of the same name.
+// The archive is streamed to a file next to it, which replaces it once it was read back, see verifyRawArchive.
+// It returns the number of files moved into the archive.
+func archiveRawMonth(monthFolder string) (files int, err error) {
+	archivePath := filepath.Clean(monthFolder) + rawArchiveSuffix
+	entries, _ := os.ReadDir(monthFolder)
+	var moved []string
+	sources := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, rawFileSuffix) || strings.HasSuffix(name, rawGzipSuffix)) {
+			continue
+		}
+		entryName := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), rawFileSuffix) + rawFileSuffix
+		if previous, found := sources[entryName]; found && strings.HasSuffix(previous, rawFileSuffix) {
+			// the uncompressed file was written after the compressed one
+			moved = append(moved, filepath.Join(monthFolder, name))
+			continue
+		}
+		sources[entryName] = filepath.Join(monthFolder, name)
+		moved = append(moved, filepath.Join(monthFolder, name))
+	}
+	if len(sources) == 0 {
+		return 0, nil
+	}
+	for _, entry := range archiveEntries(archivePath) {
+		if _, found := sources[entry]; !found {
+			sources[entry] = filepath.Join(archivePath, entry)
+		}
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// the archive is streamed to a file next to it, it replaces the archive once it was read back with the same content
+	temporaryPath := archivePath + ".tmp"
+	checksums, err := writeRawArchive(temporaryPath, names, sources)
+	if err == nil {
+		err = verifyRawArchive(temporaryPath, checksums)
+	}
+	if err == nil {
+		err = os.Rename(temporaryPath, archivePath)
+	}
+	if err != nil {
+		_ = os.Remove(temporaryPath)
+		return 0, errors.Join(errors.New("cannot write raw archive "+archivePath+", the month folder is kept"), err)
+	}
+
+	for _, movedPath := range moved {
+		err = errors.Join(err, os.Remove(movedPath))
+	}
+	// the folder is kept if it holds anything else
+	_ = os.Remove(monthFolder)
+	return len(moved), err
+}
+
+// writeRawArchive writes the raw files of sources into a new archive at archivePath by their names, in the order of names.
+// It returns the SHA-256 checksum of the content of each file by its name.
+func writeRawArchive(archivePath string, names []string, sources map[string]string) (checksums map[string][sha256.Size]byte, err error) {
+	file, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, file.Close()) }()
+	writer := zip.NewWriter(file)
+	checksums = make(map[string][sha256.Size]byte, len(names))
+	for _, name := range names {
+		content, readErr := readRawFile(sources[name])
+		if readErr != nil {
+			return nil, errors.Join(errors.New("cannot read raw file "+sources[name]), readErr)
+		}
+		checksums[name] = sha256.Sum256(content)
+		entryWriter, createErr := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if createErr != nil {
+			return nil, createErr
+		}
+		if _, writeErr := entryWriter.Write(content); writeErr != nil {
+			return nil, writeErr
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return checksums, file.Sync()
+}
+
+// verifyRawArchive reads back every file of an archive, it must hold exactly the files of checksums with their content.
+func verifyRawArchive(archivePath string, checksums map[string][sha256.Size]byte) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if len(reader.File) != len(checksums) {
+		return errors.New("archived raw files differ in number")
+	}
+	for _, file := range reader.File {
+		entry, openErr := file.Open()
+		if openErr != nil {
+			return openErr
+		}
+		hash := sha256.New()
+		_, copyErr := io.Copy(hash, entry)
+		entry.Close()
+		if checksum, found := checksums[file.Name]; copyErr != nil || !found || !bytes.Equal(hash.Sum(nil), checksum[:]) {
+			return errors.Join(errors.New("archived raw file "+file.Name+" differs from its source"), copyErr)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomically writes the file next to its path and renames it, a reader never sees a partially written file.
+func writeFileAtomically(p string, content []byte) error {
+	temporaryPath := p + ".tmp"
+	if err := os.WriteFile(temporaryPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, p)
+}
@@ -0,0 +1,129 @@
+package StatsIO
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetainRawFiles(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+
+	names := []string{"2025/01/01.json", "2025/01/03T0230.json", "2025/02/10T1200.json", "2025/03/20T1200.json"}
+	now := time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		retention      RawRetention
+		wantCompressed int
+		wantArchived   int
+		// wantFiles lists the files below the data folder after the retention
+		wantFiles []string
+	}{
+		{"disabled", RawRetention{}, 0, 0, names},
+		{"compress files", RawRetention{CompressAfterDays: 30}, 3, 0, []string{"2025/01/01.json.gz", "2025/01/03T0230.json.gz", "2025/02/10T1200.json.gz", "2025/03/20T1200.json"}},
+		{"archive months", RawRetention{CompressAfterDays: 30, ArchiveMonths: true}, 0, 2, []string{"2025/01.zip", "2025/02.zip", "2025/03/20T1200.json"}},
+		{"archive a month that ended more than the days ago", RawRetention{CompressAfterDays: 10, ArchiveMonths: true}, 0, 3, []string{"2025/01.zip", "2025/02.zip", "2025/03.zip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+			for i, name := range names {
+				writeRawFile(t, Database.DataFolder, name, int64(i+1))
+			}
+			wantCollections := listRawFiles()
+
+			compressed, archived, err := Database.RetainRawFiles(tt.retention, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed != tt.wantCompressed || archived != tt.wantArchived {
+				t.Errorf("RetainRawFiles() = %d files, %d months, want %d, %d", compressed, archived, tt.wantCompressed, tt.wantArchived)
+			}
+
+			var files []string
+			_ = filepath.WalkDir(Database.DataFolder, func(p string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					relative, _ := filepath.Rel(Database.DataFolder, p)
+					files = append(files, filepath.ToSlash(relative))
+				}
+				return err
+			})
+			if !slices.Equal(files, tt.wantFiles) {
+				t.Errorf("files after the retention = %v, want %v", files, tt.wantFiles)
+			}
+
+			collections := listRawFiles()
+			if !slices.EqualFunc(collections, wantCollections, time.Time.Equal) {
+				t.Fatalf("listRawFiles() = %v, want %v", collections, wantCollections)
+			}
+			for i, collection := range collections {
+				videos, err := parseRawFile(getRawFilePath(collection))
+				if err != nil || len(videos) != 1 || videos[0].Views != int64(i+1) {
+					t.Errorf("raw file of %v = %+v, %v, want video 1 with %d views", collection, videos, err, i+1)
+				}
+			}
+		})
+	}
+
+	t.Run("a new raw file is preferred over its archived form", func(t *testing.T) {
+		Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+		writeRawFile(t, Database.DataFolder, "2025/01/03T0230.json", 1)
+		if _, _, err := Database.RetainRawFiles(RawRetention{CompressAfterDays: 30, ArchiveMonths: true}, now); err != nil {
+			t.Fatal(err)
+		}
+		collection := time.Date(2025, 1, 3, 2, 30, 0, 0, time.UTC)
+		if got, want := getRawFilePath(collection), filepath.Join(Database.DataFolder, "2025", "01.zip", "03T0230.json"); got != want {
+			t.Errorf("getRawFilePath() of an archived collection = %v, want %v", got, want)
+		}
+		writeRawFile(t, Database.DataFolder, "2025/01/03T0230.json", 2)
+		if got, want := getRawFilePath(collection), filepath.Join(Database.DataFolder, "2025", "01", "03T0230.json"); got != want {
+			t.Errorf("getRawFilePath() of a collection stored twice = %v, want %v", got, want)
+		}
+
+		// archiving again replaces the archived file and keeps the others
+		writeRawFile(t, Database.DataFolder, "2025/01/04T0230.json", 3)
+		if _, _, err := Database.RetainRawFiles(RawRetention{CompressAfterDays: 30, ArchiveMonths: true}, now); err != nil {
+			t.Fatal(err)
+		}
+		videos, err := parseRawFile(getRawFilePath(collection))
+		if err != nil || len(videos) != 1 || videos[0].Views != 2 {
+			t.Errorf("archived raw file = %+v, %v, want video 1 with 2 views", videos, err)
+		}
+		if entries := archiveEntries(filepath.Join(Database.DataFolder, "2025", "01.zip")); !slices.Equal(entries, []string{"03T0230.json", "04T0230.json"}) {
+			t.Errorf("archive entries = %v, want 03T0230.json and 04T0230.json", entries)
+		}
+	})
+	t.Run("an unreadable raw file keeps the archive and the month folder", func(t *testing.T) {
+		Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+		writeRawFile(t, Database.DataFolder, "2025/01/03T0230.json", 1)
+		if _, _, err := Database.RetainRawFiles(RawRetention{CompressAfterDays: 30, ArchiveMonths: true}, now); err != nil {
+			t.Fatal(err)
+		}
+		archivePath := filepath.Join(Database.DataFolder, "2025", "01.zip")
+		archived, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeRawFile(t, Database.DataFolder, "2025/01/04T0230.json", 2)
+		if err = os.WriteFile(filepath.Join(Database.DataFolder, "2025", "01", "05T0230.json.gz"), []byte("no gzip"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, archivedMonths, err := Database.RetainRawFiles(RawRetention{CompressAfterDays: 30, ArchiveMonths: true}, now); err == nil || archivedMonths != 0 {
+			t.Errorf("RetainRawFiles() = %d months, %v, want an error", archivedMonths, err)
+		}
+		if content, err := os.ReadFile(archivePath); err != nil || !slices.Equal(content, archived) {
+			t.Errorf("archive after the failed archiving changed: %v", err)
+		}
+		if _, err = os.Stat(archivePath + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("the partially written archive is left behind: %v", err)
+		}
+		if !rawFileExists(filepath.Join(Database.DataFolder, "2025", "01", "04T0230.json")) {
+			t.Errorf("the raw file of the month folder was removed")
+		}
+	})
+}
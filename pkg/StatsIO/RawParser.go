@@ -0,0 +1,331 @@
+package StatsIO
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// rawHeaderPrefix starts the first line of a raw file, the PeerTube version the collection was received from follows it.
+const rawHeaderPrefix = "# Peertube API Version: "
+
+// rawParser normalises the videos of raw files received from the PeerTube versions from `from` up to `until`, excluding `until`,
+// into today's peertubeApi.VideoData. An empty bound is open.
+type rawParser struct {
+	from, until string
+	description string
+	// normalize rewrites the fields of a video in place, before it is decoded.
+	normalize func(video map[string]json.RawMessage) error
+}
+
+// rawParsers holds the parsers of the PeerTube versions whose video schema differs from today's, oldest first.
+// The videos of a raw file are normalised by every parser whose range holds its version, in this order.
+// A raw file of any other version, or of an unknown one, is decoded as is.
+var rawParsers = []rawParser{
+	{"", "4.2.0", "accounts and channels have a single avatar instead of a list of avatars", normalizeAvatars},
+	{"", "6.0.0", "the video list holds the truncated description as description", normalizeDescription},
+}
+
+// normalizeAvatars turns the single avatar of the account and the channel into a list of avatars.
+func normalizeAvatars(video map[string]json.RawMessage) error {
+	for _, actor := range []string{"account", "channel"} {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(video[actor], &fields) != nil || fields == nil {
+			continue
+		}
+		avatar, found := fields["avatar"]
+		if _, listed := fields["avatars"]; !found || listed {
+			continue
+		}
+		fields["avatars"] = json.RawMessage("[]")
+		if string(avatar) != "null" {
+			fields["avatars"] = json.RawMessage("[" + string(avatar) + "]")
+		}
+		delete(fields, "avatar")
+		actorBytes, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		video[actor] = actorBytes
+	}
+	return nil
+}
+
+// normalizeDescription moves the description of a video list to the truncated description.
+func normalizeDescription(video map[string]json.RawMessage) error {
+	description, found := video["description"]
+	if _, truncated := video["truncatedDescription"]; found && !truncated {
+		video["truncatedDescription"] = description
+		delete(video, "description")
+	}
+	return nil
+}
+
+// rawParsersFor returns the parsers of a PeerTube version, see rawParsers.
+func rawParsersFor(version string) (parsers []rawParser) {
+	if _, known := parseVersion(version); !known {
+		return nil
+	}
+	for _, parser := range rawParsers {
+		if (parser.from == "" || compareVersions(version, parser.from) >= 0) && (parser.until == "" || compareVersions(version, parser.until) < 0) {
+			parsers = append(parsers, parser)
+		}
+	}
+	return parsers
+}
+
+// parseVersion returns the major, minor and patch number of a PeerTube version, e.g. 7.1.0 or 6.0.0-rc.1.
+// A missing minor or patch number is zero, a version that does not start with a number is unknown.
+func parseVersion(version string) (numbers [3]int, known bool) {
+	version, _, _ = strings.Cut(strings.TrimSpace(version), "-")
+	for i, part := range strings.SplitN(version, ".", 3) {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return numbers, i > 0
+		}
+		numbers[i] = number
+	}
+	return numbers, true
+}
+
+// compareVersions compares two PeerTube versions by their major, minor and patch number, see parseVersion.
+func compareVersions(a, b string) int {
+	first, _ := parseVersion(a)
+	second, _ := parseVersion(b)
+	for i := range first {
+		if first[i] != second[i] {
+			return first[i] - second[i]
+		}
+	}
+	return 0
+}
+
+// decodeRawPages decodes the pages of a raw file body received from a PeerTube version, see rawParsers.
+// On a parsing error the pages decoded up to that point are returned alongside the error.
+func decodeRawPages(version string, body []byte) (pages []peertubeApi.VideoResponse, err error) {
+	parsers := rawParsersFor(version)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var page peertubeApi.VideoResponse
+		if len(parsers) == 0 {
+			err = decoder.Decode(&page)
+		} else {
+			err = decodeLegacyPage(decoder, parsers, &page)
+		}
+		if errors.Is(err, io.EOF) {
+			return pages, nil
+		}
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, page)
+	}
+}
+
+// decodeLegacyPage decodes the next page of the decoder, normalising each video by the parsers.
+func decodeLegacyPage(decoder *json.Decoder, parsers []rawParser, page *peertubeApi.VideoResponse) error {
+	var legacyPage struct {
+		Total int64                        `json:"total"`
+		Data  []map[string]json.RawMessage `json:"data"`
+	}
+	if err := decoder.Decode(&legacyPage); err != nil {
+		return err
+	}
+	page.Total = legacyPage.Total
+	for _, video := range legacyPage.Data {
+		for _, parser := range parsers {
+			if err := parser.normalize(video); err != nil {
+				return errors.Join(errors.New("cannot normalise a video: "+parser.description), err)
+			}
+		}
+		videoBytes, err := json.Marshal(video)
+		if err != nil {
+			return err
+		}
+		var data peertubeApi.VideoData
+		if err = json.Unmarshal(videoBytes, &data); err != nil {
+			return err
+		}
+		page.Data = append(page.Data, data)
+	}
+	return nil
+}
+
+// splitRawHeader splits the content of a raw file into the version of its header and its body.
+// The flag of a backfilled or an imported collection is removed from the version.
+func splitRawHeader(content []byte) (version string, body []byte, found bool) {
+	header, body, found := bytes.Cut(content, []byte("\n"))
+	if !found {
+		return "", content, false
+	}
+	return rawHeaderVersion(string(header)), body, true
+}
+
+// rawHeaderVersion returns the version of the header line of a raw file, see splitRawHeader.
+func rawHeaderVersion(header string) string {
+	version := strings.TrimPrefix(strings.TrimSpace(header), strings.TrimSpace(rawHeaderPrefix))
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(version, backfillHeaderSuffix), importHeaderSuffix))
+}
+
+// rawFileVersion returns the API version from the header of a raw file, without the flag of a backfill or an import.
+func rawFileVersion(p string) string {
+	version, _ := readRawFileVersion(p, nil)
+	return version
+}
+
+// readRawFileVersion reads the header line of a raw file, see readRawFile for the forms it may be stored in, and returns its version.
+// archives caches the opened month archives, it may be nil.
+func readRawFileVersion(p string, archives map[string]*zip.ReadCloser) (string, error) {
+	var reader io.Reader
+	if archivePath, entry, found := splitArchivePath(p); found {
+		archive, opened := archives[archivePath]
+		if !opened {
+			var err error
+			if archive, err = zip.OpenReader(archivePath); err != nil {
+				return "", err
+			}
+			if archives == nil {
+				defer archive.Close()
+			} else {
+				archives[archivePath] = archive
+			}
+		}
+		file, err := archive.Open(entry)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		reader = file
+	} else {
+		file, err := os.Open(p)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		reader = file
+		if strings.HasSuffix(p, rawGzipSuffix) {
+			decompressor, err := gzip.NewReader(file)
+			if err != nil {
+				return "", err
+			}
+			defer decompressor.Close()
+			reader = decompressor
+		}
+	}
+	header, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return rawHeaderVersion(header), nil
+}
+
+// SnapshotVersion is the PeerTube version a collection was received from.
+type SnapshotVersion struct {
+	Collection time.Time `json:"collection"`
+	Version    string    `json:"version"`
+}
+
+// loadSnapshotVersions reads the version of every raw file of the data folder, oldest first.
+func loadSnapshotVersions() (versions []SnapshotVersion) {
+	archives := map[string]*zip.ReadCloser{}
+	defer func() {
+		for _, archive := range archives {
+			archive.Close()
+		}
+	}()
+	for _, collectionTime := range listRawFiles() {
+		version, err := readRawFileVersion(getRawFilePath(collectionTime), archives)
+		LogHelp.LogOnError("cannot read the version of a raw file", map[string]string{"collectionTime": collectionTime.Format("2006.01.02 15:04")}, err)
+		versions = append(versions, SnapshotVersion{Collection: collectionTime, Version: version})
+	}
+	return versions
+}
+
+// versionsMutex guards the loading of StatsIO.versions and StatsIO.upgrades, see loadVersions.
+var versionsMutex sync.Mutex
+
+// loadVersions reads the version of each collection and derives the upgrades on first use, as only the charts need them.
+// The caller holds versionsMutex.
+func loadVersions() {
+	if Database.versions == nil {
+		Database.versions = append([]SnapshotVersion{}, loadSnapshotVersions()...)
+		Database.upgrades = upgradesOf(Database.versions)
+	}
+}
+
+// snapshotVersions returns the version of each collection, see loadVersions.
+func snapshotVersions() []SnapshotVersion {
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	loadVersions()
+	return Database.versions
+}
+
+// SnapshotVersions returns the PeerTube version of each collection, oldest first.
+func SnapshotVersions() []SnapshotVersion {
+	return snapshotVersions()
+}
+
+// SnapshotVersionAt returns the PeerTube version of the last collection at or before t, empty before the first collection.
+func SnapshotVersionAt(t time.Time) string {
+	versions := snapshotVersions()
+	position := sort.Search(len(versions), func(i int) bool { return versions[i].Collection.After(t) })
+	if position == 0 {
+		return ""
+	}
+	return versions[position-1].Version
+}
+
+// Upgrades returns the first collection of each PeerTube version that follows the collections of another version, oldest first.
+// They are derived once per load of the data folder, see loadVersions, the returned slice must not be modified.
+func Upgrades() []SnapshotVersion {
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	loadVersions()
+	return Database.upgrades
+}
+
+// upgradesOf returns the upgrades among the versions of the collections, see Upgrades.
+// The first version of the data folder and the collections of an unknown version are no upgrade, a downgrade is listed as well.
+func upgradesOf(versions []SnapshotVersion) (upgrades []SnapshotVersion) {
+	var previous string
+	for _, snapshot := range versions {
+		if _, known := parseVersion(snapshot.Version); !known {
+			continue
+		}
+		if previous != "" && snapshot.Version != previous {
+			upgrades = append(upgrades, snapshot)
+		}
+		previous = snapshot.Version
+	}
+	return upgrades
+}
+
+// markUpgrades sets the version of the last PeerTube upgrade within each bucket, see VideoStat.Upgrade.
+// first is the start of the first bucket, a bucket holds the units after the last unit of the previous bucket up to its own last unit.
+func markUpgrades(bucket []VideoStat, first time.Time, Timeframe string) {
+	timeframe, _ := templates.ParseTimeframe(Timeframe)
+	for _, upgrade := range Upgrades() {
+		if upgrade.Collection.Before(first) {
+			continue
+		}
+		position := sort.Search(len(bucket), func(i int) bool { return !unitEnd(bucket[i].Time, timeframe).Before(upgrade.Collection) })
+		if position < len(bucket) {
+			bucket[position].Upgrade = upgrade.Version
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package StatsIO
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"4.1.1", "4.2.0", -1},
+		{"4.10.0", "4.2.0", 1},
+		{"6.0.0-rc.1", "6.0.0", 0},
+		{"7", "7.0.0", 0},
+		{"7.1.0", "7.0.3", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); (got > 0) != (tt.want > 0) || (got < 0) != (tt.want < 0) {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func Test_parseRawFile_legacyVersions(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+
+	const video = `{"total":1,"data":[{"id":1,"views":10,"description":"A description",` +
+		`"account":{"id":2,"name":"acc","avatar":{"path":"/a.png","width":48}},"channel":{"id":3,"name":"chan","avatar":null}}]}`
+	tests := []struct {
+		name            string
+		header          string
+		wantDescription string
+		wantAccount     []peertubeApi.Avatar
+		wantChannel     []peertubeApi.Avatar
+	}{
+		{"before 4.2", "# Peertube API Version: 4.1.1\r\n", "A description", []peertubeApi.Avatar{{Path: "/a.png", Width: 48}}, []peertubeApi.Avatar{}},
+		{"backfilled before 4.2", "# Peertube API Version: 3.4.0" + backfillHeaderSuffix + "\r\n", "A description", []peertubeApi.Avatar{{Path: "/a.png", Width: 48}}, []peertubeApi.Avatar{}},
+		{"before 6.0", "# Peertube API Version: 5.2.1\r\n", "A description", nil, nil},
+		{"current", "# Peertube API Version: 7.1.0\r\n", "", nil, nil},
+		{"unknown version", "# Peertube API Version: \r\n", "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawPath := filepath.Join(Database.DataFolder, "raw.json")
+			if err := os.WriteFile(rawPath, []byte(tt.header+video), 0600); err != nil {
+				t.Fatal(err)
+			}
+			videos, err := parseRawFile(rawPath)
+			if err != nil || len(videos) != 1 || videos[0].Views != 10 {
+				t.Fatalf("parseRawFile() = %+v, %v, want the video with 10 views", videos, err)
+			}
+			if videos[0].TruncatedDescription != tt.wantDescription || !reflect.DeepEqual(videos[0].Account.Avatars, tt.wantAccount) || !reflect.DeepEqual(videos[0].Channel.Avatars, tt.wantChannel) {
+				t.Errorf("parseRawFile() = description %q, avatars %+v and %+v, want %q, %+v and %+v", videos[0].TruncatedDescription,
+					videos[0].Account.Avatars, videos[0].Channel.Avatars, tt.wantDescription, tt.wantAccount, tt.wantChannel)
+			}
+		})
+	}
+}
+
+func TestUpgrades(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC}
+
+	for name, version := range map[string]string{"01T1200.json": "6.3.0", "02T1200.json": "6.3.0", "03T1200.json": "", "04T1200.json": "7.0.1", "06T1200.json": "7.0.1"} {
+		rawPath := filepath.Join(Database.DataFolder, "2025", "01", name)
+		if err := os.MkdirAll(filepath.Dir(rawPath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(rawPath, []byte("# Peertube API Version: "+version+"\r\n"+`{"total":0,"data":[]}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a compressed raw file is read as well
+	if err := compressRawFile(filepath.Join(Database.DataFolder, "2025", "01", "06T1200.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	wantUpgrades := []SnapshotVersion{{Collection: sampleDay(3).Add(12 * time.Hour), Version: "7.0.1"}}
+	if upgrades := Upgrades(); !reflect.DeepEqual(upgrades, wantUpgrades) {
+		t.Errorf("Upgrades() = %+v, want %+v", upgrades, wantUpgrades)
+	}
+	for day, want := range []string{"", "6.3.0", "6.3.0", "", "7.0.1", "7.0.1", "7.0.1"} {
+		if got := SnapshotVersionAt(sampleDay(day)); got != want {
+			t.Errorf("SnapshotVersionAt(day %d) = %q, want %q", day, got, want)
+		}
+	}
+
+	bucket := []VideoStat{{Time: sampleDay(2)}, {Time: sampleDay(3)}, {Time: sampleDay(4)}}
+	markUpgrades(bucket, sampleDay(2), templates.TimeframeDaily)
+	if bucket[0].Upgrade != "" || bucket[1].Upgrade != "7.0.1" || bucket[2].Upgrade != "" {
+		t.Errorf("markUpgrades() = %+v, want the upgrade marked on day 3", bucket)
+	}
+
+	// the upgrades are derived once per load, a collection of a newer version is listed after the next load
+	rawPath := filepath.Join(Database.DataFolder, "2025", "01", "07T1200.json")
+	if err := os.WriteFile(rawPath, []byte("# Peertube API Version: 7.1.0\r\n"+`{"total":0,"data":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if upgrades := Upgrades(); !reflect.DeepEqual(upgrades, wantUpgrades) {
+		t.Errorf("Upgrades() before the next load = %+v, want %+v", upgrades, wantUpgrades)
+	}
+	Database.versions, Database.upgrades = nil, nil
+	if upgrades := Upgrades(); len(upgrades) != 2 || upgrades[1].Version != "7.1.0" {
+		t.Errorf("Upgrades() after the next load = %+v, want the upgrade to 7.1.0 on day 6", upgrades)
+	}
+}
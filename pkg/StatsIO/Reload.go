@@ -0,0 +1,182 @@
+package StatsIO
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+)
+
+// reloadAttempts is how often Reload loads the data folder while a collection keeps changing it.
+const reloadAttempts = 3
+
+// ErrDataFolderChanging is returned by Reload if the data folder changed during every attempt to load it, e.g. by a running collection.
+var ErrDataFolderChanging = errors.New("the data folder changed while it was loaded")
+
+// loadedData is the in-memory data of the data folder, it is published as a whole and never changed afterward, see publish.
+type loadedData struct {
+	data               *sync.Map
+	timeSeries         *TimeSeriesDatabase
+	lifecycleDb        *sync.Map
+	firstDataAvailable time.Time
+	backfilled         []time.Time
+	imported           []time.Time
+	// modTimes are the modification times of the data folder before it was loaded, see dataFolderModTimes.
+	modTimes [2]time.Time
+	// loadedAt is the time the data folder was loaded.
+	loadedAt time.Time
+}
+
+// current returns the published data of the data folder, empty data before it was loaded.
+// A reader reads it once and keeps using it, so that a reload in between does not mix the data of two loads.
+func (statIO *StatsIO) current() *loadedData {
+	if statIO.loaded != nil {
+		if loaded := statIO.loaded.Load(); loaded != nil {
+			return loaded
+		}
+	}
+	return &loadedData{}
+}
+
+// publish replaces the data of the data folder for every following reader, readers of the previous data keep it.
+// The first publish must not run concurrently with readers, see Init.
+func (statIO *StatsIO) publish(loaded *loadedData) {
+	if statIO.loaded == nil {
+		statIO.loaded = &atomic.Pointer[loadedData]{}
+	}
+	statIO.loaded.Store(loaded)
+}
+
+// update publishes a copy of the data of the data folder that was changed by change, e.g. by a collection of this process.
+func (statIO *StatsIO) update(change func(loaded *loadedData)) {
+	for {
+		previous := statIO.current()
+		changed := *previous
+		change(&changed)
+		if statIO.loaded == nil {
+			statIO.publish(&changed)
+			return
+		}
+		if statIO.loaded.CompareAndSwap(previous, &changed) {
+			return
+		}
+	}
+}
+
+// load reads the data of the data folder without changing the published data.
+// A missing or unreadable lifecycle, backfill or import record is logged, their stats are not flagged in this case.
+func (statIO *StatsIO) load() (loaded *loadedData, err error) {
+	loaded = &loadedData{loadedAt: time.Now()}
+	wg := &sync.WaitGroup{}
+	var timeSeriesErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		loaded.timeSeries, timeSeriesErr = loadTimeSeries()
+	}()
+	loaded.data, err = loadVideoDB()
+	lifecycleDb, lifecycleErr := LoadLifecycleDBFromDisk()
+	LogHelp.LogOnError("cannot load lifecycle database", nil, lifecycleErr)
+	loaded.lifecycleDb = lifecycleDb
+	loaded.firstDataAvailable = findFirstDataAvailable()
+	backfill, backfillErr := ReadBackfillRecord(statIO.DataFolder)
+	LogHelp.LogOnError("cannot read the backfilled collections, their stats are not flagged", nil, backfillErr)
+	loaded.backfilled = backfill.Collections
+	imported, importErr := ReadImportRecord(statIO.DataFolder)
+	LogHelp.LogOnError("cannot read the imported collections, their stats are not flagged", nil, importErr)
+	loaded.imported = imported.Collections
+	wg.Wait()
+	return loaded, errors.Join(err, timeSeriesErr)
+}
+
+// loadUnchanged loads the data folder, see load, and reports whether it changed meanwhile.
+// The modification times before the load are recorded, so that a data folder that changed is loaded again by WatchDataFolder.
+func (statIO *StatsIO) loadUnchanged() (loaded *loadedData, unchanged bool, err error) {
+	modTimes := statIO.dataFolderModTimes()
+	loaded, err = statIO.load()
+	loaded.modTimes = modTimes
+	return loaded, sameModTimes(modTimes, statIO.dataFolderModTimes()), err
+}
+
+// LastReload returns the time the published data of the data folder was loaded, zero before Init.
+func LastReload() time.Time {
+	return Database.current().loadedAt
+}
+
+// Reload loads the data of the data folder again and publishes it, requests are served with the old data meanwhile.
+// The collector lock is not taken, a collection is not held up by a reload. Instead the data folder is loaded again
+// if it changed while it was loaded, ErrDataFolderChanging is returned if it still changes after reloadAttempts.
+// On any error the published data is kept.
+func (statIO *StatsIO) Reload() error {
+	for range reloadAttempts {
+		loaded, unchanged, err := statIO.loadUnchanged()
+		if err != nil {
+			return errors.Join(errors.New("cannot reload the data folder, keeping the loaded data"), err)
+		}
+		if !unchanged {
+			continue
+		}
+		versionsMutex.Lock()
+		// the versions and upgrades are read again on first use, see loadVersions.
+		statIO.versions, statIO.upgrades = nil, nil
+		statIO.publish(loaded)
+		versionsMutex.Unlock()
+		return nil
+	}
+	return ErrDataFolderChanging
+}
+
+// dataFolderModTimes returns the modification times of the files a collection writes last, videoDB.json and the TimeSeriesDatabaseFileName.
+// A missing file has the zero time.
+func (statIO *StatsIO) dataFolderModTimes() (modTimes [2]time.Time) {
+	for i, name := range []string{"videoDB.json", TimeSeriesDatabaseFileName} {
+		if info, err := os.Stat(path.Join(statIO.DataFolder, name)); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// sameModTimes reports whether both modification times of the data folder are equal, see dataFolderModTimes.
+func sameModTimes(a, b [2]time.Time) bool {
+	return a[0].Equal(b[0]) && a[1].Equal(b[1])
+}
+
+// WatchDataFolder polls the data folder every interval and reloads it, see Reload, if videoDB.json or the time series changed,
+// or if the loaded data is older than CacheInvalidationSeconds. A data folder that is being written is reloaded on a later poll.
+// It returns when ctx is done.
+func (statIO *StatsIO) WatchDataFolder(ctx context.Context, interval time.Duration) {
+	loadedModTimes := statIO.current().modTimes
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTimes := statIO.dataFolderModTimes()
+		expired := statIO.CacheInvalidationSeconds > 0 && time.Since(statIO.current().loadedAt) >= time.Duration(statIO.CacheInvalidationSeconds)*time.Second
+		if sameModTimes(modTimes, loadedModTimes) && !expired {
+			continue
+		}
+		err := statIO.Reload()
+		if errors.Is(err, ErrDataFolderChanging) {
+			LogHelp.NewLog(LogHelp.Debug, "data folder is being written, reloading it later", nil).Log()
+			continue
+		}
+		if err != nil {
+			LogHelp.LogOnError("cannot reload the data folder", map[string]string{"dataFolder": statIO.DataFolder}, err)
+			// the data folder is retried once it changes again or the loaded data expires.
+			loadedModTimes = modTimes
+			continue
+		}
+		loadedModTimes = statIO.current().modTimes
+		LogHelp.NewLog(LogHelp.Info, "reloaded the data folder", map[string]string{"dataFolder": statIO.DataFolder}).Log()
+	}
+}
@@ -0,0 +1,131 @@
+package StatsIO
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataUnknown}
+
+	writeRawFile(t, Database.DataFolder, "2025/01/01T1200.json", 10)
+	if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Database.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	loadedAt := LastReload()
+
+	// a collection of another process adds a day
+	writeRawFile(t, Database.DataFolder, "2025/01/02T1200.json", 20)
+	if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := requestTimestamp(sampleDay(1), 1); err != nil || !stat.Unknown {
+		t.Fatalf("requestTimestamp() before the reload = %+v, %v, want the day to be unknown", stat, err)
+	}
+
+	// a request reads the published data once, a reload does not change it
+	loaded := Database.current()
+	if err := Database.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := requestTimestamp(sampleDay(1), 1); err != nil || stat.Views.Data != 20 || !LastReload().After(loadedAt) {
+		t.Errorf("requestTimestamp() after the reload = %+v, %v, want 20 views", stat, err)
+	}
+	if len(loaded.timeSeries.Collections) != 1 {
+		t.Errorf("the data read before the reload holds %d collections, want 1", len(loaded.timeSeries.Collections))
+	}
+
+	// a collection of another process holds the collector lock, a reload does not wait for it
+	lockPath := filepath.Join(Database.DataFolder, CollectorLockFileName)
+	if err := os.WriteFile(lockPath, []byte(strconv.Itoa(os.Getpid()+1)+" "+time.Now().Format(time.RFC3339)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Database.Reload(); err != nil {
+		t.Errorf("Reload() during a collection = %v, want the data to be reloaded", err)
+	}
+
+	// a collection of another process is writing the time series, a reload keeps the published data and does not rebuild it
+	reloaded := Database.current()
+	seriesPath := filepath.Join(Database.DataFolder, "TimeSeries", "1.json")
+	if err := os.WriteFile(seriesPath, []byte(`{"items":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Database.Reload(); err == nil || Database.current() != reloaded {
+		t.Errorf("Reload() of a truncated time series = %v, want an error and the published data to be kept", err)
+	}
+	if content, err := os.ReadFile(seriesPath); err != nil || string(content) != `{"items":` {
+		t.Errorf("Reload() wrote the time series %q, %v, want the data folder to be left untouched", content, err)
+	}
+}
+
+func TestWatchDataFolder(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2, MissingDataPolicy: MissingDataUnknown}
+
+	writeRawFile(t, Database.DataFolder, "2025/01/01T1200.json", 10)
+	if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Database.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// change alters the data folder after the data was loaded
+		change                   func(t *testing.T)
+		cacheInvalidationSeconds int
+		wantReload               bool
+	}{
+		{"unchanged data folder", func(t *testing.T) {}, 0, false},
+		{"new collection", func(t *testing.T) {
+			writeRawFile(t, Database.DataFolder, "2025/01/02T1200.json", 20)
+			if _, err := Database.rebuildDerivedFiles(listRawFiles()); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, true},
+		{"expired data", func(t *testing.T) {}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Database.CacheInvalidationSeconds = tt.cacheInvalidationSeconds
+			loadedAt := LastReload()
+			ctx, cancel := context.WithCancel(context.Background())
+			watched := make(chan struct{})
+			go func() {
+				Database.WatchDataFolder(ctx, 20*time.Millisecond)
+				close(watched)
+			}()
+			// the modification times have a coarse resolution on some file systems
+			time.Sleep(50 * time.Millisecond)
+			tt.change(t)
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) && !LastReload().After(loadedAt) {
+				time.Sleep(20 * time.Millisecond)
+			}
+			cancel()
+			<-watched
+			if reloaded := LastReload().After(loadedAt); reloaded != tt.wantReload {
+				t.Errorf("WatchDataFolder() reloaded = %v, want %v", reloaded, tt.wantReload)
+			}
+		})
+	}
+}
+
+// publishedData returns an atomic pointer to loaded, to set the published data of a StatsIO literal.
+func publishedData(loaded *loadedData) *atomic.Pointer[loadedData] {
+	published := &atomic.Pointer[loadedData]{}
+	published.Store(loaded)
+	return published
+}
@@ -1,14 +1,9 @@
 package StatsIO
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"flag"
-	"io"
-	"os"
-	"path"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
@@ -19,107 +14,101 @@ var Database StatsIO
 
 type StatsIO struct {
 	// DataFolder is the path where the data is stored.
-	DataFolder         string
+	DataFolder string
+	// StatsMissTolerance is the number of days a collection may lie before a requested date, to still count as collected on that date.
 	StatsMissTolerance int
-	// data is a database mapping from id to video metadata.
-	data *sync.Map
-	// CacheInvalidationSeconds is used to invalidate the db in a long-running system such as the webserver, this enables us to never return outdated data
+	// MissingDataPolicy decides how stats that were not collected are estimated, see MissingDataCarryForward, MissingDataLinear and MissingDataUnknown.
+	MissingDataPolicy string
+	// Location is the reporting time zone, a collection belongs to the calendar day it was made on in this time zone.
+	Location *time.Location
+	// WeekStart is the first day of a week, weekly buckets are aligned to it.
+	WeekStart time.Weekday
+	// AnomalyThreshold is the robust z-score from which the views gained on a day are an anomaly, see DetectAnomalies.
+	AnomalyThreshold float64
+	// AnomalyMinimumViews is the number of views a day must gain above its baseline to be an anomaly.
+	AnomalyMinimumViews int64
+	// CacheInvalidationSeconds is used to invalidate the db in a long-running system such as the webserver, this enables us to never return outdated data.
+	// The data is reloaded once it is older, even if the data folder did not change, see WatchDataFolder.
 	CacheInvalidationSeconds int
 	Api                      *peertubeApi.ApiClient
-	// firstDataAvailable is the timestamp of the earliest video metadata available.
-	firstDataAvailable time.Time
-	TimeSeriesDB       *TimeSeriesDatabase
-	// deletedDb maps from video id to a time.Time
-	deletedDb        sync.Map
+	// loaded holds the data loaded from the data folder, see current and Reload.
+	loaded *atomic.Pointer[loadedData]
+	// versions holds the PeerTube version of each collection, oldest first, see SnapshotVersions.
+	versions []SnapshotVersion
+	// upgrades holds the upgrades among the versions, see Upgrades.
+	upgrades         []SnapshotVersion
 	StatIOMaxThreads int
 }
 
-func (statIO *StatsIO) Init(api *peertubeApi.ApiClient) {
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		var err error
-		statIO.TimeSeriesDB, err = loadTimeSeries()
-		LogHelp.FatalOnError("cannot load time series database", nil, err)
-
-	}()
-	db, err := loadVideoDB()
-	if err == nil {
-		Database.data = db
+// Init migrates the data folder to DataFolderVersion and loads it, see MigrateDataFolder.
+// A data folder of a newer version, one that cannot be migrated or loaded is refused with an error, the caller must not use it.
+func (statIO *StatsIO) Init(api *peertubeApi.ApiClient) error {
+	switch statIO.MissingDataPolicy {
+	case MissingDataCarryForward, MissingDataLinear, MissingDataUnknown:
+	default:
+		LogHelp.NewLog(LogHelp.Warn, "unknown missing data policy, carrying the last collection forward", map[string]string{"policy": statIO.MissingDataPolicy}).Log()
+		statIO.MissingDataPolicy = MissingDataCarryForward
+	}
+	applied, err := statIO.MigrateDataFolder(DefaultCollectorLockWait)
+	if err != nil {
+		return errors.Join(errors.New("cannot start on the data folder, it is of an unknown version or cannot be migrated"), err)
+	}
+	if len(applied) > 0 {
+		LogHelp.NewLog(LogHelp.Info, "migrated data folder", map[string]interface{}{"migrations": applied}).Log()
+	}
+	if err = statIO.rebuildOutdatedTimeSeries(DefaultCollectorLockWait); err != nil {
+		return errors.Join(errors.New("cannot rebuild the time series from the raw data"), err)
+	}
+	// a data folder that changed while it was loaded is loaded again by WatchDataFolder.
+	loaded, _, err := statIO.loadUnchanged()
+	if err != nil {
+		return errors.Join(errors.New("cannot load the data folder"), err)
 	}
-	Database.firstDataAvailable = findFirstDataAvailable()
+	statIO.publish(loaded)
 	if api != nil {
 		statIO.Api = api
 	}
-	wg.Wait()
+	return nil
 }
 
+// ReadRawResponsesByPath appends the pages of the raw file at p to i, normalised by the parsers of its PeerTube version, see rawParsers.
 func (statIO *StatsIO) ReadRawResponsesByPath(p string, i *[]peertubeApi.VideoResponse) (err error) {
 	if i == nil {
 		return errors.New("invalid input")
 	}
 	var FileBytes []byte
-	FileBytes, err = os.ReadFile(p)
+	FileBytes, err = readRawFile(p)
 	if err != nil {
 		return err
 	}
-	versionIndex := bytes.IndexByte(FileBytes, byte('\n'))
-	if versionIndex == -1 {
+	version, body, found := splitRawHeader(FileBytes)
+	if !found {
 		LogHelp.NewLog(LogHelp.Error, "cannot find version header of raw data", map[string]string{"Path": p}).Log()
-		versionIndex = 0
-	}
-	decoder := json.NewDecoder(bytes.NewReader(FileBytes[versionIndex+1:]))
-	for {
-		var video peertubeApi.VideoResponse
-		err = decoder.Decode(&video)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			LogHelp.LogOnError("error parsing imported data", nil, err)
-			return
-		}
-		*i = append(*i, video)
 	}
+	pages, err := decodeRawPages(version, body)
+	*i = append(*i, pages...)
+	LogHelp.LogOnError("error parsing imported data", nil, err)
 	return
 }
 
 func init() {
 	flag.IntVar(&Database.StatIOMaxThreads, "stat-io-max-threads", 10, "max number of threads to use")
 	flag.StringVar(&Database.DataFolder, "data-folder", "./Data", "Folder containing video stats")
-	flag.IntVar(&Database.StatsMissTolerance, "miss-tolerance", 0, "If a searched statistic is missing, this specifies the tolerance of days of a mismatch before an error.")
+	flag.IntVar(&Database.StatsMissTolerance, "miss-tolerance", 0, "If a searched statistic is missing, this specifies the tolerance of days of a mismatch before the statistic is estimated.")
+	flag.StringVar(&Database.MissingDataPolicy, "missing-data-policy", MissingDataCarryForward, "How statistics of days without a collection are estimated: carry-forward, linear or unknown")
+	Database.WeekStart = time.Monday
+	flag.Func("time-zone", "The reporting time zone as IANA name such as Europe/Berlin, the local time zone of the server by default", parseLocation(&Database.Location))
+	flag.Func("week-start", "The first day of a week used by weekly buckets, monday by default as in ISO weeks", parseWeekday(&Database.WeekStart))
+	flag.Float64Var(&Database.AnomalyThreshold, "anomaly-threshold", 3.5, "The robust z-score from which the views gained on a day are reported as anomaly")
+	flag.Int64Var(&Database.AnomalyMinimumViews, "anomaly-min-views", 20, "The number of views a day must gain above its baseline to be reported as anomaly")
 	flag.IntVar(&Database.CacheInvalidationSeconds, "cache-valid-seconds", 1*60*60*25, "The number of seconds the video database cache is valid, By default a bit more than a day")
 }
 
+// findFirstDataAvailable returns the reporting day of the first collection, today if nothing was collected yet.
 func findFirstDataAvailable() time.Time {
-	currentDate := time.Now()
-	// Find the oldest year
-	for {
-		if _, err := os.Stat(path.Join(Database.DataFolder, currentDate.Format("2006"))); os.IsNotExist(err) {
-			break
-		}
-		currentDate = currentDate.AddDate(-1, 0, 0)
-	}
-	currentDate = currentDate.AddDate(1, 0, 0)
-
-	// find the oldest month
-	for {
-		if _, err := os.Stat(path.Join(Database.DataFolder, currentDate.Format("2006"), currentDate.Format("01"))); os.IsNotExist(err) {
-			break
-		}
-		currentDate = currentDate.AddDate(0, -1, 0)
-	}
-	currentDate = currentDate.AddDate(0, 1, 0)
-
-	// find the oldest day
-	for {
-		stat, _ := os.Stat(path.Join(Database.DataFolder, currentDate.Format("2006"), currentDate.Format("01"), currentDate.Format("02")+".json"))
-		if stat == nil {
-			break
-		}
-		currentDate = currentDate.AddDate(0, 0, -1)
+	collectionTimes := listRawFiles()
+	if len(collectionTimes) == 0 {
+		return Database.ReportingDay(time.Now())
 	}
-	currentDate = currentDate.AddDate(0, 0, 1)
-	return currentDate
+	return Database.ReportingDay(collectionTimes[0])
 }
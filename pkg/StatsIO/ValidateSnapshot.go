@@ -0,0 +1,179 @@
+package StatsIO
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+// QuarantineFolder is the folder within the data folder that holds the collections that did not match the PeerTube API schema.
+// Its raw files are stored below it like within the data folder, each next to a validation report, see quarantineSnapshot.
+const QuarantineFolder = "quarantine"
+
+// quarantineReportSuffix replaces the raw file suffix for the validation report of a quarantined collection.
+const quarantineReportSuffix = ".validation.json"
+
+// ErrInvalidSnapshot is returned by ImportFromRaw for a collection that does not match the PeerTube API schema, it was quarantined instead of imported.
+var ErrInvalidSnapshot = errors.New("the collection does not match the PeerTube API schema")
+
+// rawStatsFields are the fields of a video the statistics are read from, a video without one of them makes the snapshot invalid.
+var rawStatsFields = []string{"id", "views", "likes"}
+
+// decodedFields are the fields of a page of a collection that are decoded into a peertubeApi.VideoResponse, see decodedFieldPaths.
+// A value whose type changed fails to decode only within them.
+var decodedFields = decodedFieldPaths(reflect.TypeFor[peertubeApi.VideoResponse](), "", map[string]bool{})
+
+// decodedFieldPaths adds the path of each field of typ a JSON value is decoded into to fields, in the format of peertubeApi.SchemaDrift.Field.
+// A field of an interface type takes a value of any type, it is left out.
+func decodedFieldPaths(typ reflect.Type, field string, fields map[string]bool) map[string]bool {
+	switch typ.Kind() {
+	case reflect.Interface:
+		return fields
+	case reflect.Pointer:
+		return decodedFieldPaths(typ.Elem(), field, fields)
+	}
+	fields[field] = true
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		decodedFieldPaths(typ.Elem(), field+"[]", fields)
+	case reflect.Struct:
+		for i := range typ.NumField() {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" || !typ.Field(i).IsExported() {
+				continue
+			}
+			if field == "" {
+				decodedFieldPaths(typ.Field(i).Type, name, fields)
+			} else {
+				decodedFieldPaths(typ.Field(i).Type, field+"."+name, fields)
+			}
+		}
+	}
+	return fields
+}
+
+// FieldDrift is the drift of a field of a collection from the PeerTube API schema, see peertubeApi.SchemaDrift.
+// Found is the first value found, Occurrences counts the values of the field that drift, e.g. one per video.
+type FieldDrift struct {
+	peertubeApi.SchemaDrift
+	Occurrences int `json:"occurrences"`
+	// Invalid is set if the drift corrupts the statistics.
+	Invalid bool `json:"invalid"`
+}
+
+// SnapshotValidation is the result of ValidateSnapshot.
+type SnapshotValidation struct {
+	Valid  bool         `json:"valid"`
+	Pages  int          `json:"pages"`
+	Videos int          `json:"videos"`
+	Drift  []FieldDrift `json:"drift"`
+}
+
+// ValidateSnapshot validates the pages of a collection against the VideoListResponse schema of the bundled PeerTube API description.
+// The drift is reported per field. A page that is not a video list, a value of one of the decodedFields whose type changed and
+// a video without one of rawStatsFields make the snapshot invalid. Other drift, e.g. a field added by a newer PeerTube version,
+// an unknown state or a changed type of a field that is not decoded, does not corrupt the statistics and is only reported.
+func ValidateSnapshot(rawResponses [][]byte) (validation SnapshotValidation, err error) {
+	schema, err := peertubeApi.ComponentSchema("VideoListResponse")
+	if err != nil {
+		return validation, err
+	}
+	validation = SnapshotValidation{Valid: true, Pages: len(rawResponses), Drift: []FieldDrift{}}
+	drifts := make(map[[3]string]*FieldDrift)
+	add := func(drift peertubeApi.SchemaDrift) {
+		key := [3]string{drift.Field, drift.Kind, drift.Expected}
+		if _, found := drifts[key]; !found {
+			drifts[key] = &FieldDrift{SchemaDrift: drift}
+		}
+		drifts[key].Occurrences++
+	}
+
+	for _, response := range rawResponses {
+		decoder := json.NewDecoder(bytes.NewReader(response))
+		decoder.UseNumber()
+		var page interface{}
+		if decodeErr := decoder.Decode(&page); decodeErr != nil {
+			add(peertubeApi.SchemaDrift{Kind: peertubeApi.SchemaDriftType, Expected: "object", Found: "invalid JSON"})
+			continue
+		}
+		for _, drift := range schema.Validate(page, "") {
+			add(drift)
+		}
+		pageObject, _ := page.(map[string]interface{})
+		videos, _ := pageObject["data"].([]interface{})
+		if _, present := pageObject["data"]; pageObject != nil && !present {
+			add(peertubeApi.SchemaDrift{Field: "data", Kind: peertubeApi.SchemaDriftMissing, Expected: "array", Found: "absent"})
+		}
+		validation.Videos += len(videos)
+		for _, video := range videos {
+			videoObject, _ := video.(map[string]interface{})
+			for _, field := range rawStatsFields {
+				if _, present := videoObject[field]; videoObject != nil && !present {
+					add(peertubeApi.SchemaDrift{Field: "data[]." + field, Kind: peertubeApi.SchemaDriftMissing, Expected: "integer", Found: "absent"})
+				}
+			}
+		}
+	}
+
+	for _, drift := range drifts {
+		drift.Invalid = drift.Kind == peertubeApi.SchemaDriftType && decodedFields[drift.Field] || drift.Field == "data" ||
+			(drift.Kind == peertubeApi.SchemaDriftNull || drift.Kind == peertubeApi.SchemaDriftMissing) && slices.ContainsFunc(rawStatsFields, func(field string) bool { return drift.Field == "data[]."+field })
+		validation.Valid = validation.Valid && !drift.Invalid
+		validation.Drift = append(validation.Drift, *drift)
+	}
+	slices.SortFunc(validation.Drift, func(a, b FieldDrift) int {
+		return cmp.Or(cmp.Compare(a.Field, b.Field), cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Expected, b.Expected))
+	})
+	return validation, nil
+}
+
+// logSnapshotDrift logs each drift of a collection from the PeerTube API schema.
+// A null value carries no data, PeerTube sends it e.g. for an unset language, it is logged at the info level.
+func logSnapshotDrift(validation SnapshotValidation, collectionTime time.Time) {
+	for _, drift := range validation.Drift {
+		level := LogHelp.Warn
+		if drift.Invalid {
+			level = LogHelp.Error
+		} else if drift.Kind == peertubeApi.SchemaDriftNull {
+			level = LogHelp.Info
+		}
+		LogHelp.NewLog(level, "raw stats drift from the PeerTube API schema", map[string]string{
+			"field":          drift.Field,
+			"kind":           drift.Kind,
+			"expected":       drift.Expected,
+			"found":          drift.Found,
+			"occurrences":    strconv.Itoa(drift.Occurrences),
+			"invalid":        strconv.FormatBool(drift.Invalid),
+			"collectionTime": collectionTime.Format("2006.01.02 15:04"),
+		}).Log()
+	}
+}
+
+// quarantineSnapshot writes the raw file of an invalid collection to the QuarantineFolder, next to its validation report, and returns its path.
+func (statIO *StatsIO) quarantineSnapshot(rawFile []byte, validation SnapshotValidation, collectionTime time.Time) (string, error) {
+	rawPath := path.Join(statIO.DataFolder, QuarantineFolder, rawFileName(collectionTime)+rawFileSuffix)
+	err := os.MkdirAll(path.Dir(rawPath), 0700)
+	if err != nil {
+		return rawPath, err
+	}
+	err = writeFileAtomically(rawPath, rawFile)
+	if err != nil {
+		return rawPath, err
+	}
+	reportBytes, err := json.MarshalIndent(validation, "", "  ")
+	if err != nil {
+		return rawPath, err
+	}
+	return rawPath, writeFileAtomically(strings.TrimSuffix(rawPath, rawFileSuffix)+quarantineReportSuffix, reportBytes)
+}
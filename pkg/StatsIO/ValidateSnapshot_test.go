@@ -0,0 +1,73 @@
+package StatsIO
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateSnapshot(t *testing.T) {
+	const video = `"id":1,"uuid":"9c9de5e8-0a1e-484a-b099-e80766180a6d","name":"First","likes":2`
+	tests := []struct {
+		name        string
+		pages       []string
+		wantValid   bool
+		wantVideos  int
+		wantDrift   int
+		wantInvalid string
+	}{
+		{"valid", []string{`{"total":2,"data":[{` + video + `,"views":10}]}`, `{"total":2,"data":[{` + video + `,"views":11}]}`}, true, 2, 0, ""},
+		// PeerTube sends null for an unset language, the drift is reported once for the field
+		{"reported drift", []string{`{"total":2,"data":[{` + video + `,"views":10,"language":{"id":null}},{` + video + `,"views":3,"language":{"id":null}}]}`}, true, 2, 1, ""},
+		{"type changed", []string{`{"total":1,"data":[{` + video + `,"views":"10"}]}`}, false, 1, 1, "data[].views"},
+		// the id of a category is decoded as any value, its changed type does not corrupt the statistics
+		{"type changed of an undecoded field", []string{`{"total":1,"data":[{` + video + `,"views":10,"category":{"id":"music","label":"Music"}}]}`}, true, 1, 1, ""},
+		{"views missing", []string{`{"total":1,"data":[{` + video + `}]}`}, false, 1, 1, "data[].views"},
+		{"error response", []string{`{"total":1,"data":[{` + video + `,"views":10}]}`, `{"error":"rate limited"}`}, false, 1, 2, "data"},
+		{"truncated page", []string{`{"total":1,"data":[{` + video}, false, 0, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := make([][]byte, len(tt.pages))
+			for i, page := range tt.pages {
+				pages[i] = []byte(page)
+			}
+			got, err := ValidateSnapshot(pages)
+			if err != nil || got.Valid != tt.wantValid || got.Videos != tt.wantVideos || len(got.Drift) != tt.wantDrift {
+				t.Fatalf("ValidateSnapshot() = %+v, %v, want valid %v, %d videos and %d drifts", got, err, tt.wantValid, tt.wantVideos, tt.wantDrift)
+			}
+			for _, drift := range got.Drift {
+				if drift.Invalid && tt.wantInvalid != "" && drift.Field != tt.wantInvalid {
+					t.Errorf("ValidateSnapshot() invalid drift of %q, want of %q", drift.Field, tt.wantInvalid)
+				}
+			}
+		})
+	}
+}
+
+func TestImportFromRaw_quarantine(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: t.TempDir(), Location: time.UTC, StatIOMaxThreads: 2}
+	collectionTime := sampleDay(0).Add(12 * time.Hour)
+
+	err := Database.ImportFromRaw([][]byte{[]byte(`{"total":1,"data":[{"id":1,"views":"10","likes":2}]}`)}, "8.0.0", collectionTime)
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("ImportFromRaw() = %v, want ErrInvalidSnapshot", err)
+	}
+	if collections := listRawFiles(); len(collections) != 0 {
+		t.Errorf("ImportFromRaw() imported the invalid collections %v", collections)
+	}
+	for _, name := range []string{"01T1200.json", "01T1200" + quarantineReportSuffix} {
+		if _, err := os.Stat(filepath.Join(Database.DataFolder, QuarantineFolder, "2025", "01", name)); err != nil {
+			t.Errorf("quarantined file %s: %v", name, err)
+		}
+	}
+
+	err = Database.ImportFromRaw([][]byte{[]byte(`{"total":1,"data":[{"id":1,"views":10,"likes":2}]}`)}, "8.0.0", collectionTime)
+	if err != nil || len(listRawFiles()) != 1 {
+		t.Errorf("ImportFromRaw() of a valid collection = %v, imported %v", err, listRawFiles())
+	}
+}
@@ -37,53 +37,45 @@ func loadVideoDB() (result *sync.Map, err error) {
 	return result, err
 }
 
-// mergeVideoDB adds the inputDatabase to the currentData, while adding removed entries to the deletedDb.
+// mergeVideoDB adds the inputDatabase to the currentData, while recording the visibility of every video in the lifecycleDb.
 // mergeVideoDB does not remove entries from the currentData as it is still used for metadata lookup.
-// CATION: Call Load AND Save the Deleted db before operating on it using the LoadDeletedDBFromDisk and SaveDeletedDBToDisk functions respectively
-func mergeVideoDB(currentData *sync.Map, inputDatabase *sync.Map, deletedDb *sync.Map, recordedTs time.Time) (err error) {
-	// Check for deleted or modified videos
+// mergeVideoDB keeps only the newest metadata of each video, see updateVideoHistory for the change log.
+// A partial collection, a backfilled or imported one, holds only some of the videos, a video missing from it is not observed as missing.
+// CATION: Call Load AND Save the lifecycle db before operating on it using the LoadLifecycleDBFromDisk and SaveLifecycleDBToDisk functions respectively
+func mergeVideoDB(currentData *sync.Map, inputDatabase *sync.Map, lifecycleDb *sync.Map, recordedTs time.Time, partial bool) (err error) {
+	var errs []error
+	// Check for missing videos, they are deleted, private or blacklisted.
 	currentData.Range(func(key, value interface{}) bool {
-		// TODO: Swap the entries if the thumbnail path changes.
-		// Why? because they are regenerated from time to time, and this results in broken thumbnail requests.
-
-		// if the key from the input is not found, it is either deleted or new
-		if _, found := inputDatabase.Load(key); !found {
-			videoFromDB := value.(peertubeApi.VideoData)
-
-			// Retrieve deletion time for the video
-			deletedValue, foundInDeletedDB := deletedDb.Load(videoFromDB.ID)
-
-			if foundInDeletedDB {
-				deletionTs := deletedValue.(time.Time)
-
-				// If video was foundInDeletedDB before the recorded state, ignore
-				if deletionTs.Before(recordedTs) {
-					return true
-				}
-
-				// If video is foundInDeletedDB in the future, log a warning
-				if deletionTs.After(recordedTs) {
-					LogHelp.NewLog(LogHelp.Warn, "Writing video data in the past.", map[string]string{
-						"VideoID":      strconv.FormatInt(videoFromDB.ID, 10),
-						"DataRecorded": recordedTs.Format(time.RFC3339),
-						"VideoDeleted": deletionTs.Format(time.RFC3339),
-					}).Log()
-
-					// Update deletion timestamp
-					deletedDb.Store(videoFromDB.ID, recordedTs)
-				}
+		if _, found := inputDatabase.Load(key); found || partial {
+			return true
+		}
+		videoFromDB := value.(peertubeApi.VideoData)
+		lifecycle, found := lifecycleDb.Load(videoFromDB.ID)
+		if found {
+			if _, known := lifecycle.(*VideoLifecycle).StateAt(recordedTs); !known {
+				// the recorded state is before the video was seen for the first time, it did not exist yet.
 				return true
 			}
-			if !foundInDeletedDB {
-				// video is not found in the new data, and it is not in the foundInDeletedDB
-				VideoDelete(videoFromDB.ID, recordedTs, deletedDb)
-			}
 		}
+		observeErr := observeLifecycle(lifecycleDb, videoFromDB.ID, recordedTs, false)
+		if observeErr != nil {
+			errs = append(errs, errors.Join(errors.New("video "+strconv.FormatInt(videoFromDB.ID, 10)+" is missing on "+recordedTs.Format(time.RFC3339)), observeErr))
+		}
+		return true
+	})
 
+	// Every video of the input is visible, a video that was missing before reappeared (e.g. it was made public again).
+	inputDatabase.Range(func(key, value interface{}) bool {
+		observeErr := observeLifecycle(lifecycleDb, key.(int64), recordedTs, true)
+		if observeErr != nil {
+			errs = append(errs, errors.Join(errors.New("video "+strconv.FormatInt(key.(int64), 10)+" is visible on "+recordedTs.Format(time.RFC3339)), observeErr))
+		}
 		return true
 	})
 
 	// Merge input database into current data
+	// Changed metadata (e.g. a regenerated thumbnail path) is overwritten, the previous versions are kept by the video history.
+	// Use GetVideoAt to obtain the metadata that was valid at a given time.
 	inputDatabase.Range(func(key, value interface{}) bool {
 		keyint, ok1 := key.(int64)
 		LogHelp.ErrorOnNotOK("cannot cast inputdatabase index to int64 (mergeVideoDB)", nil, ok1)
@@ -93,35 +85,65 @@ func mergeVideoDB(currentData *sync.Map, inputDatabase *sync.Map, deletedDb *syn
 		return ok1 && ok2
 	})
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func saveVideoDB(Db *sync.Map, ts time.Time) error {
+// replayRawFiles merges the given raw files in order, like processRawImport does, and returns the resulting video and lifecycle databases.
+// The valid part of a damaged raw file is used regardless, the error is passed to onParseError if it is set.
+func replayRawFiles(collectionTimes []time.Time, onParseError func(rawPath string, err error)) (videoDb *sync.Map, lifecycleDb *sync.Map) {
+	videoDb = &sync.Map{}
+	lifecycleDb = &sync.Map{}
+	partial := partialCollections(Database.DataFolder)
+	for _, collectionTime := range collectionTimes {
+		rawPath := getRawFilePath(collectionTime)
+		videos, parseErr := parseRawFile(rawPath)
+		if parseErr != nil && onParseError != nil {
+			onParseError(rawPath, parseErr)
+		}
+		if len(videos) == 0 {
+			continue
+		}
+		inputDB := &sync.Map{}
+		for _, video := range videos {
+			inputDB.Store(video.ID, video)
+		}
+		LogHelp.LogOnError("cannot replay raw file", map[string]string{"path": rawPath}, mergeVideoDB(videoDb, inputDB, lifecycleDb, collectionTime, isCollection(partial, collectionTime)))
+	}
+	return videoDb, lifecycleDb
+}
+
+// encodeVideoDB marshals the video database into the format used by videoDB.json and its monthly and yearly copies.
+func encodeVideoDB(Db *sync.Map) ([]byte, error) {
 	var fileDB = make(map[int64]peertubeApi.VideoData)
 	Db.Range(func(k, v interface{}) (ok bool) {
 		fileDB[k.(int64)], ok = v.(peertubeApi.VideoData)
 		LogHelp.ErrorOnNotOK("cannot add key value pair to map", nil, ok)
 		return ok
 	})
+	return json.Marshal(fileDB)
+}
+
+func saveVideoDB(Db *sync.Map, ts time.Time) error {
+	ts = Database.ReportingDay(ts)
 	monthHandle, err := os.OpenFile(Database.DataFolder+string(os.PathSeparator)+ts.Format("2006")+string(os.PathSeparator)+ts.Format("1")+".json", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer monthHandle.Close()
 
-	yearHandle, err := os.OpenFile(Database.DataFolder+string(os.PathSeparator)+ts.Format("2006")+".json", os.O_CREATE|os.O_RDWR, 0600)
+	yearHandle, err := os.OpenFile(Database.DataFolder+string(os.PathSeparator)+ts.Format("2006")+".json", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer yearHandle.Close()
 
-	fullHandle, err := os.OpenFile(Database.DataFolder+string(os.PathSeparator)+"videoDB.json", os.O_CREATE|os.O_RDWR, 0600)
+	fullHandle, err := os.OpenFile(Database.DataFolder+string(os.PathSeparator)+"videoDB.json", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer fullHandle.Close()
 
-	byts, err := json.Marshal(fileDB)
+	byts, err := encodeVideoDB(Db)
 	if err != nil {
 		return err
 	}
@@ -150,10 +172,8 @@ func saveVideoDB(Db *sync.Map, ts time.Time) error {
 }
 
 func GetAllVideos() (Videos []peertubeApi.VideoData, err error) {
-	var VideoDB *sync.Map
-	if Database.data != nil {
-		VideoDB = Database.data
-	} else {
+	VideoDB := Database.current().data
+	if VideoDB == nil {
 		VideoDB, err = loadVideoDB()
 		if err != nil {
 			return nil, err
@@ -168,10 +188,8 @@ func GetAllVideos() (Videos []peertubeApi.VideoData, err error) {
 }
 
 func GetVideo(id int64) (video peertubeApi.VideoData, err error) {
-	var VideoDB *sync.Map
-	if Database.data != nil {
-		VideoDB = Database.data
-	} else {
+	VideoDB := Database.current().data
+	if VideoDB == nil {
 		VideoDB, err = loadVideoDB()
 		if err != nil {
 			return video, err
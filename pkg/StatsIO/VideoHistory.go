@@ -0,0 +1,254 @@
+package StatsIO
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+const VideoHistoryFolderName = "History"
+
+// MetadataChange is a snapshot of the metadata of a video, it is recorded whenever a tracked field changes.
+type MetadataChange struct {
+	CollectedAt time.Time `json:"collected_at"`
+	// Fields holds the json names of the fields that changed compared to the previous snapshot, it is empty for the first snapshot.
+	Fields []string              `json:"fields"`
+	Video  peertubeApi.VideoData `json:"video"`
+}
+
+// VideoHistory is the metadata change log of one video, sorted by collection time.
+type VideoHistory []MetadataChange
+
+// untrackedVideoFields are the json names of the VideoData fields that change without an edit of the video.
+// The counters are tracked by the time series instead.
+var untrackedVideoFields = map[string]bool{
+	"views":       true,
+	"likes":       true,
+	"dislikes":    true,
+	"comments":    true,
+	"updatedAt":   true,
+	"userHistory": true,
+}
+
+// videoFieldLabels are the labels of the tracked VideoData fields by their json name, the labels are translated by the web templates.
+var videoFieldLabels = map[string]string{
+	"id":                    "ID",
+	"uuid":                  "UUID",
+	"shortUUID":             "Short UUID",
+	"isLive":                "Live stream",
+	"liveSchedules":         "Live schedule",
+	"createdAt":             "Created",
+	"publishedAt":           "Published",
+	"originallyPublishedAt": "Originally published",
+	"category":              "Category",
+	"licence":               "Licence",
+	"language":              "Language",
+	"privacy":               "Privacy",
+	"truncatedDescription":  "Description",
+	"tags":                  "Tags",
+	"duration":              "Duration",
+	"aspectRatio":           "Aspect ratio",
+	"isLocal":               "Local video",
+	"name":                  "Name",
+	"thumbnailPath":         "Thumbnail",
+	"previewPath":           "Preview",
+	"embedPath":             "Embed link",
+	"nsfw":                  "Sensitive content",
+	"nsfwFlags":             "Sensitive content warnings",
+	"nsfwSummary":           "Sensitive content summary",
+	"waitTranscoding":       "Waits for transcoding",
+	"state":                 "State",
+	"scheduledUpdate":       "Scheduled update",
+	"blacklisted":           "Blocked",
+	"blacklistedReason":     "Reason for blocking",
+	"account":               "Account",
+	"channel":               "Channel",
+}
+
+// VideoFieldLabel returns the label of a field of MetadataChange.Fields, the json name of a field without a label.
+func VideoFieldLabel(field string) string {
+	if label, found := videoFieldLabels[field]; found {
+		return label
+	}
+	return field
+}
+
+// changedVideoFields returns the json names of the tracked fields that differ between both versions of the video.
+func changedVideoFields(previous, current peertubeApi.VideoData) (fields []string) {
+	previousValue := reflect.ValueOf(previous)
+	currentValue := reflect.ValueOf(current)
+	for i := 0; i < previousValue.NumField(); i++ {
+		name, _, _ := strings.Cut(previousValue.Type().Field(i).Tag.Get("json"), ",")
+		if untrackedVideoFields[name] {
+			continue
+		}
+		if !reflect.DeepEqual(previousValue.Field(i).Interface(), currentValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// insert records the video as collected at collectedAt. It reports whether the history was modified.
+// Snapshots may be inserted out of order, the changed fields of the following snapshot are recalculated.
+func (history *VideoHistory) insert(video peertubeApi.VideoData, collectedAt time.Time) (modified bool) {
+	entries := *history
+	position := sort.Search(len(entries), func(i int) bool { return !entries[i].CollectedAt.Before(collectedAt) })
+
+	if position < len(entries) && entries[position].CollectedAt.Equal(collectedAt) {
+		// the same collection was imported again, replace it.
+		entries = append(entries[:position], entries[position+1:]...)
+		modified = true
+	}
+
+	change := MetadataChange{CollectedAt: collectedAt, Video: video}
+	if position > 0 {
+		change.Fields = changedVideoFields(entries[position-1].Video, video)
+		if len(change.Fields) == 0 {
+			*history = entries
+			return modified || history.dropRedundant(position)
+		}
+	}
+	entries = append(entries[:position], append(VideoHistory{change}, entries[position:]...)...)
+	*history = entries
+	history.dropRedundant(position + 1)
+	return true
+}
+
+// dropRedundant recalculates the changed fields of the entry at position, and removes it if nothing changed.
+func (history *VideoHistory) dropRedundant(position int) (modified bool) {
+	entries := *history
+	if position <= 0 || position >= len(entries) {
+		return false
+	}
+	fields := changedVideoFields(entries[position-1].Video, entries[position].Video)
+	if len(fields) == 0 {
+		*history = append(entries[:position], entries[position+1:]...)
+		return true
+	}
+	modified = !reflect.DeepEqual(fields, entries[position].Fields)
+	entries[position].Fields = fields
+	return modified
+}
+
+// At returns the snapshot that was valid at the given time.
+// If the time is before the first snapshot, the first snapshot is returned, as it is the best knowledge available.
+func (history VideoHistory) At(ts time.Time) (change MetadataChange, found bool) {
+	if len(history) == 0 {
+		return MetadataChange{}, false
+	}
+	position := sort.Search(len(history), func(i int) bool { return history[i].CollectedAt.After(ts) })
+	return history[max(0, position-1)], true
+}
+
+func videoHistoryPath(id int64) string {
+	return path.Join(Database.DataFolder, VideoHistoryFolderName, strconv.FormatInt(id, 10)+".json")
+}
+
+// loadVideoHistory reads the metadata change log of a video, a missing log results in an empty history.
+func loadVideoHistory(id int64) (history VideoHistory, err error) {
+	historyBytes, err := os.ReadFile(videoHistoryPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return VideoHistory{}, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(historyBytes, &history)
+	return history, err
+}
+
+func saveVideoHistory(id int64, history VideoHistory) error {
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(videoHistoryPath(id), historyBytes, 0600)
+}
+
+// updateVideoHistory records the metadata of every video of a collection in the change log of the respective video.
+// If no change log exists yet, it is rebuilt from every raw file, so installations that predate the change log get their full history.
+func updateVideoHistory(videos []peertubeApi.VideoData, collectionTime time.Time) error {
+	if _, err := os.Stat(path.Join(Database.DataFolder, VideoHistoryFolderName)); os.IsNotExist(err) {
+		return rebuildVideoHistory(listRawFiles())
+	}
+
+	var errs = make([]error, len(videos))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(1, Database.StatIOMaxThreads))
+	for i, video := range videos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			history, err := loadVideoHistory(video.ID)
+			if err != nil {
+				errs[i] = errors.Join(errors.New("cannot load history of video "+strconv.FormatInt(video.ID, 10)), err)
+				return
+			}
+			if history.insert(video, collectionTime) {
+				errs[i] = saveVideoHistory(video.ID, history)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rebuildVideoHistory replays the given raw files and writes the change log of every video found in them.
+func rebuildVideoHistory(collectionTimes []time.Time) error {
+	err := os.MkdirAll(path.Join(Database.DataFolder, VideoHistoryFolderName), 0700)
+	if err != nil {
+		return err
+	}
+	histories := make(map[int64]VideoHistory)
+	for _, collectionTime := range collectionTimes {
+		for _, video := range readRawResponses(collectionTime) {
+			history := histories[video.ID]
+			history.insert(video, collectionTime)
+			histories[video.ID] = history
+		}
+	}
+	var errs []error
+	for id, history := range histories {
+		errs = append(errs, saveVideoHistory(id, history))
+	}
+	LogHelp.NewLog(LogHelp.Info, "rebuilt video history from raw data", map[string]int{"videos": len(histories), "rawFiles": len(collectionTimes)}).Log()
+	return errors.Join(errs...)
+}
+
+// GetVideoHistory returns the metadata change log of a video, oldest first.
+func GetVideoHistory(id int64) (VideoHistory, error) {
+	return loadVideoHistory(id)
+}
+
+// GetVideoAt returns the metadata of a video as it was at the given time.
+// The views and likes are taken from the time series, if it is loaded.
+// Videos without a recorded history fall back to the current metadata.
+func GetVideoAt(id int64, ts time.Time) (video peertubeApi.VideoData, err error) {
+	history, err := loadVideoHistory(id)
+	LogHelp.LogOnError("cannot load video history", map[string]interface{}{"videoID": id}, err)
+	change, found := history.At(ts)
+	if !found {
+		return GetVideo(id)
+	}
+	video = change.Video
+
+	if series := getVideoTimeSeries(id); series != nil {
+		lookupResult := series.At(ts)
+		video.Views = lookupResult.Views
+		video.Likes = lookupResult.Likes
+	}
+	return video, nil
+}
@@ -0,0 +1,108 @@
+package StatsIO
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+func TestVideoHistory_insert(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	named := func(name string, views int64) peertubeApi.VideoData {
+		return peertubeApi.VideoData{ID: 1, Name: name, Views: views, ThumbnailPath: "/lazy-static/thumbnails/" + name + ".jpg"}
+	}
+	type snapshot struct {
+		day   int
+		video peertubeApi.VideoData
+	}
+	tests := []struct {
+		name       string
+		snapshots  []snapshot
+		wantDays   []int
+		wantFields [][]string
+	}{
+		{
+			name:       "counters are not tracked",
+			snapshots:  []snapshot{{1, named("a", 1)}, {2, named("a", 5)}, {3, named("a", 9)}},
+			wantDays:   []int{1},
+			wantFields: [][]string{nil},
+		},
+		{
+			name:       "rename is recorded",
+			snapshots:  []snapshot{{1, named("a", 1)}, {2, named("a", 5)}, {3, named("b", 9)}},
+			wantDays:   []int{1, 3},
+			wantFields: [][]string{nil, {"name", "thumbnailPath"}},
+		},
+		{
+			name:       "out of order insertion moves the change",
+			snapshots:  []snapshot{{1, named("a", 1)}, {3, named("b", 9)}, {2, named("b", 5)}},
+			wantDays:   []int{1, 2},
+			wantFields: [][]string{nil, {"name", "thumbnailPath"}},
+		},
+		{
+			name:       "insertion before the first snapshot",
+			snapshots:  []snapshot{{2, named("b", 5)}, {1, named("a", 1)}},
+			wantDays:   []int{1, 2},
+			wantFields: [][]string{nil, {"name", "thumbnailPath"}},
+		},
+		{
+			name:       "reimport replaces the snapshot",
+			snapshots:  []snapshot{{1, named("a", 1)}, {2, named("b", 5)}, {2, named("a", 5)}},
+			wantDays:   []int{1},
+			wantFields: [][]string{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var history VideoHistory
+			for _, s := range tt.snapshots {
+				history.insert(s.video, day(s.day))
+			}
+			var gotDays []int
+			var gotFields [][]string
+			for _, change := range history {
+				gotDays = append(gotDays, change.CollectedAt.Day())
+				gotFields = append(gotFields, change.Fields)
+			}
+			if !reflect.DeepEqual(gotDays, tt.wantDays) {
+				t.Errorf("insert() days = %v, want %v", gotDays, tt.wantDays)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Errorf("insert() fields = %v, want %v", gotFields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestVideoHistory_At(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	var history VideoHistory
+	history.insert(peertubeApi.VideoData{ID: 1, Name: "first"}, day(2))
+	history.insert(peertubeApi.VideoData{ID: 1, Name: "second"}, day(5))
+
+	for ts, want := range map[time.Time]string{day(1): "first", day(2): "first", day(4): "first", day(5): "second", day(9): "second"} {
+		if got, _ := history.At(ts); got.Video.Name != want {
+			t.Errorf("At(%v) = %v, want %v", ts.Format(time.DateOnly), got.Video.Name, want)
+		}
+	}
+}
+
+func TestVideoFieldLabel(t *testing.T) {
+	// every tracked field is shown in the changes of a video, it needs a label to be translated.
+	videoType := reflect.TypeFor[peertubeApi.VideoData]()
+	for i := range videoType.NumField() {
+		name, _, _ := strings.Cut(videoType.Field(i).Tag.Get("json"), ",")
+		if untrackedVideoFields[name] {
+			continue
+		}
+		if _, found := videoFieldLabels[name]; !found {
+			t.Errorf("the tracked field %q has no label", name)
+		}
+	}
+	if got := VideoFieldLabel("unknownField"); got != "unknownField" {
+		t.Errorf("VideoFieldLabel() of a field without a label = %q, want its name", got)
+	}
+}
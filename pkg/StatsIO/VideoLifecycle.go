@@ -0,0 +1,162 @@
+package StatsIO
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+)
+
+const LifecycleDatabaseFileName = "lifecycle.json"
+
+// errLifecycleConflict is returned if an observation contradicts a run of collections that is already recorded.
+// This only happens if collections are imported out of order, rebuild the lifecycle from the raw data in this case.
+var errLifecycleConflict = errors.New("observation contradicts the recorded lifecycle")
+
+// LifecycleInterval is a run of collections in which a video was either visible or missing.
+// From and Until are the first and the last collection of the run, the state changed at an unknown time between two runs.
+type LifecycleInterval struct {
+	Visible bool      `json:"visible"`
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until"`
+}
+
+func (interval LifecycleInterval) equal(other LifecycleInterval) bool {
+	return interval.Visible == other.Visible && interval.From.Equal(other.From) && interval.Until.Equal(other.Until)
+}
+
+func (interval LifecycleInterval) String() string {
+	state := "missing"
+	if interval.Visible {
+		state = "visible"
+	}
+	return state + " " + interval.From.Format(time.DateOnly) + ".." + interval.Until.Format(time.DateOnly)
+}
+
+// VideoLifecycle records in which collections a video was visible, and in which it was missing.
+// A video goes missing when it is deleted, made private or blacklisted, it may reappear later on.
+// Consecutive intervals always alternate between visible and missing.
+type VideoLifecycle struct {
+	Id        int64               `json:"id"`
+	Intervals []LifecycleInterval `json:"intervals"`
+}
+
+func (lifecycle *VideoLifecycle) String() string {
+	var runs []string
+	for _, interval := range lifecycle.Intervals {
+		runs = append(runs, interval.String())
+	}
+	return "[" + strings.Join(runs, ", ") + "]"
+}
+
+// observe records the state of the video in the collection at ts.
+// Observations may arrive in any order, as long as they do not fall into a run of the opposite state.
+func (lifecycle *VideoLifecycle) observe(ts time.Time, visible bool) error {
+	intervals := lifecycle.Intervals
+	// position is the first interval starting after ts
+	position := sort.Search(len(intervals), func(i int) bool { return intervals[i].From.After(ts) })
+
+	if position > 0 && !ts.After(intervals[position-1].Until) {
+		// ts is inside the run position-1
+		if intervals[position-1].Visible != visible {
+			return errLifecycleConflict
+		}
+		return nil
+	}
+	switch {
+	case position > 0 && intervals[position-1].Visible == visible:
+		// extend the previous run up to ts
+		intervals[position-1].Until = ts
+	case position < len(intervals) && intervals[position].Visible == visible:
+		// the next run already started earlier than recorded
+		intervals[position].From = ts
+	default:
+		intervals = append(intervals[:position], append([]LifecycleInterval{{Visible: visible, From: ts, Until: ts}}, intervals[position:]...)...)
+	}
+	lifecycle.Intervals = intervals
+	return nil
+}
+
+// StateAt reports whether the video was visible at ts.
+// Between two runs the state of the earlier run is assumed, known is false before the video was collected for the first time.
+func (lifecycle *VideoLifecycle) StateAt(ts time.Time) (visible bool, known bool) {
+	if lifecycle == nil {
+		return false, false
+	}
+	position := sort.Search(len(lifecycle.Intervals), func(i int) bool { return lifecycle.Intervals[i].From.After(ts) })
+	if position == 0 {
+		return false, false
+	}
+	return lifecycle.Intervals[position-1].Visible, true
+}
+
+// MissingAt reports whether the video was already collected, but not visible at ts.
+func (lifecycle *VideoLifecycle) MissingAt(ts time.Time) bool {
+	visible, known := lifecycle.StateAt(ts)
+	return known && !visible
+}
+
+// observeLifecycle records the state of a video in the lifecycle database, it creates the lifecycle if required.
+func observeLifecycle(lifecycleDb *sync.Map, id int64, ts time.Time, visible bool) error {
+	value, _ := lifecycleDb.LoadOrStore(id, &VideoLifecycle{Id: id})
+	return value.(*VideoLifecycle).observe(ts, visible)
+}
+
+// LoadLifecycleDBFromDisk loads the lifecycle of every video, the result maps from video id to *VideoLifecycle.
+// If the lifecycle database does not exist yet, it is rebuilt from the raw data.
+func LoadLifecycleDBFromDisk() (lifecycleDb *sync.Map, err error) {
+	lifecycleBytes, err := os.ReadFile(path.Join(Database.DataFolder, LifecycleDatabaseFileName))
+	if os.IsNotExist(err) {
+		LogHelp.NewLog(LogHelp.Info, "cannot find lifecycle database, rebuilding it from raw", nil).Log()
+		_, lifecycleDb = replayRawFiles(listRawFiles(), nil)
+		return lifecycleDb, nil
+	}
+	if err != nil {
+		return &sync.Map{}, err
+	}
+	var lifecycles = make(map[int64]*VideoLifecycle)
+	err = json.Unmarshal(lifecycleBytes, &lifecycles)
+	lifecycleDb = &sync.Map{}
+	collections := listRawFiles()
+	for id, lifecycle := range lifecycles {
+		if len(lifecycle.Intervals) > 0 && !isCollection(collections, lifecycle.Intervals[0].From) {
+			LogHelp.NewLog(LogHelp.Info, "lifecycle database was recorded in another time zone, rebuilding it from raw", nil).Log()
+			_, lifecycleDb = replayRawFiles(listRawFiles(), nil)
+			return lifecycleDb, nil
+		}
+		lifecycleDb.Store(id, lifecycle)
+	}
+	return lifecycleDb, err
+}
+
+func SaveLifecycleDBToDisk(lifecycleDb *sync.Map) error {
+	var lifecycles = make(map[int64]*VideoLifecycle)
+	lifecycleDb.Range(func(k, v interface{}) bool {
+		lifecycles[k.(int64)] = v.(*VideoLifecycle)
+		return true
+	})
+	lifecycleBytes, err := json.Marshal(lifecycles)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(Database.DataFolder, LifecycleDatabaseFileName), lifecycleBytes, 0600)
+}
+
+// GetVideoLifecycle returns the recorded lifecycle of a video, nil if the video was never collected.
+func GetVideoLifecycle(id int64) *VideoLifecycle {
+	lifecycleDb := Database.current().lifecycleDb
+	if lifecycleDb == nil {
+		return nil
+	}
+	value, found := lifecycleDb.Load(id)
+	if !found {
+		return nil
+	}
+	return value.(*VideoLifecycle)
+}
@@ -0,0 +1,162 @@
+package StatsIO
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+)
+
+func TestVideoLifecycle_observe(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	type observation struct {
+		day     int
+		visible bool
+	}
+	tests := []struct {
+		name         string
+		observations []observation
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "visible runs are merged",
+			observations: []observation{{1, true}, {2, true}, {3, true}},
+			want:         "[visible 2025-03-01..2025-03-03]",
+		},
+		{
+			name:         "deleted video",
+			observations: []observation{{1, true}, {2, true}, {3, false}, {4, false}},
+			want:         "[visible 2025-03-01..2025-03-02, missing 2025-03-03..2025-03-04]",
+		},
+		{
+			name:         "visible, missing, visible",
+			observations: []observation{{1, true}, {2, false}, {3, false}, {4, true}},
+			want:         "[visible 2025-03-01..2025-03-01, missing 2025-03-02..2025-03-03, visible 2025-03-04..2025-03-04]",
+		},
+		{
+			name:         "missing, visible, missing",
+			observations: []observation{{1, false}, {2, true}, {3, false}},
+			want:         "[missing 2025-03-01..2025-03-01, visible 2025-03-02..2025-03-02, missing 2025-03-03..2025-03-03]",
+		},
+		{
+			name:         "out of order observations fill the gap",
+			observations: []observation{{1, true}, {4, false}, {3, false}, {2, true}},
+			want:         "[visible 2025-03-01..2025-03-02, missing 2025-03-03..2025-03-04]",
+		},
+		{
+			name:         "out of order observation splits a gap",
+			observations: []observation{{1, true}, {3, true}, {5, true}, {7, false}, {6, true}},
+			want:         "[visible 2025-03-01..2025-03-06, missing 2025-03-07..2025-03-07]",
+		},
+		{
+			name:         "observation inside a run of the opposite state",
+			observations: []observation{{1, true}, {3, true}, {2, false}},
+			want:         "[visible 2025-03-01..2025-03-03]",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := &VideoLifecycle{Id: 1}
+			var err error
+			for _, o := range tt.observations {
+				err = errors.Join(err, lifecycle.observe(day(o.day), o.visible))
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("observe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := lifecycle.String(); got != tt.want {
+				t.Errorf("observe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideoLifecycle_StateAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	lifecycle := &VideoLifecycle{Id: 1}
+	for _, d := range []int{2, 3, 5, 7} {
+		_ = lifecycle.observe(day(d), d != 5)
+	}
+	tests := []struct {
+		day         int
+		wantVisible bool
+		wantKnown   bool
+	}{
+		{1, false, false},
+		{2, true, true},
+		{4, true, true},
+		{5, false, true},
+		{6, false, true},
+		{7, true, true},
+		{9, true, true},
+	}
+	for _, tt := range tests {
+		visible, known := lifecycle.StateAt(day(tt.day))
+		if visible != tt.wantVisible || known != tt.wantKnown {
+			t.Errorf("StateAt(%v) = %v, %v, want %v, %v", tt.day, visible, known, tt.wantVisible, tt.wantKnown)
+		}
+	}
+	if (*VideoLifecycle)(nil).MissingAt(day(1)) {
+		t.Errorf("MissingAt() of an unknown video = true, want false")
+	}
+}
+
+func Test_mergeVideoDB_lifecycle(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	video := peertubeApi.VideoData{ID: 1, Name: "flipping video"}
+	tests := []struct {
+		name        string
+		collections []bool
+		want        string
+	}{
+		{
+			name:        "public, private, public",
+			collections: []bool{true, false, false, true},
+			want:        "[visible 2025-03-01..2025-03-01, missing 2025-03-02..2025-03-03, visible 2025-03-04..2025-03-04]",
+		},
+		{
+			name:        "reappearing video is missing again",
+			collections: []bool{true, true, false, true, false},
+			want:        "[visible 2025-03-01..2025-03-02, missing 2025-03-03..2025-03-03, visible 2025-03-04..2025-03-04, missing 2025-03-05..2025-03-05]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentData := &sync.Map{}
+			lifecycleDb := &sync.Map{}
+			for i, visible := range tt.collections {
+				input := &sync.Map{}
+				if visible {
+					input.Store(video.ID, video)
+				}
+				if err := mergeVideoDB(currentData, input, lifecycleDb, day(i+1), false); err != nil {
+					t.Fatalf("mergeVideoDB() error = %v", err)
+				}
+			}
+			lifecycle, found := lifecycleDb.Load(video.ID)
+			if !found {
+				t.Fatalf("mergeVideoDB() did not record a lifecycle")
+			}
+			if got := lifecycle.(*VideoLifecycle).String(); got != tt.want {
+				t.Errorf("mergeVideoDB() lifecycle = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("collection before the first appearance", func(t *testing.T) {
+		currentData := &sync.Map{}
+		lifecycleDb := &sync.Map{}
+		input := &sync.Map{}
+		input.Store(video.ID, video)
+		_ = mergeVideoDB(currentData, input, lifecycleDb, day(3), false)
+		_ = mergeVideoDB(currentData, &sync.Map{}, lifecycleDb, day(1), false)
+		lifecycle, _ := lifecycleDb.Load(video.ID)
+		if got, want := lifecycle.(*VideoLifecycle).String(), "[visible 2025-03-03..2025-03-03]"; got != want {
+			t.Errorf("mergeVideoDB() lifecycle = %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,312 @@
+package StatsIO
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchField is a field of a video held by the search index, a match in the field scores its weight.
+type searchField struct {
+	weight float64
+	values func(video peertubeApi.VideoData) []string
+}
+
+// searchFields are the fields of a video held by the search index, a match in the name weighs most.
+// The video list of PeerTube holds the truncated description only and no tags, the tags are indexed if the metadata holds them.
+var searchFields = []searchField{
+	{8, func(video peertubeApi.VideoData) []string { return []string{video.Name} }},
+	{6, func(video peertubeApi.VideoData) []string { return video.Tags }},
+	{4, func(video peertubeApi.VideoData) []string {
+		return []string{video.Channel.DisplayName, video.Channel.Name}
+	}},
+	{3, func(video peertubeApi.VideoData) []string {
+		return []string{video.Account.DisplayName, video.Account.Name}
+	}},
+	{2, func(video peertubeApi.VideoData) []string { return []string{video.Category.Label} }},
+	{2, func(video peertubeApi.VideoData) []string { return []string{video.Language.Label} }},
+	{1, func(video peertubeApi.VideoData) []string { return []string{video.Licence.Label} }},
+	{1, func(video peertubeApi.VideoData) []string { return []string{video.TruncatedDescription} }},
+}
+
+// The quality of the match of a query term with a term of the index, it scales the weight of the field, see matchQuality.
+const (
+	matchExact  = 1.0
+	matchPrefix = 0.6
+	matchInfix  = 0.4
+	matchFuzzy  = 0.3
+)
+
+// SearchIndex is an in-memory full-text index over the fields of the videos, see searchFields.
+type SearchIndex struct {
+	videos []peertubeApi.VideoData
+	// postings maps from a term to the summed weight of the fields holding it, by the position of the video in videos.
+	postings map[string]map[int]float64
+}
+
+// SearchResult is a video found by SearchIndex.Search, Score is the sum of the best match of each query term.
+type SearchResult struct {
+	Video peertubeApi.VideoData
+	Score float64
+}
+
+// NewSearchIndex indexes the terms of the videos, see searchTerms.
+func NewSearchIndex(videos []peertubeApi.VideoData) *SearchIndex {
+	index := &SearchIndex{videos: videos, postings: make(map[string]map[int]float64)}
+	for position, video := range videos {
+		for _, field := range searchFields {
+			// a term repeated within a field counts once
+			fieldTerms := make(map[string]bool)
+			for _, value := range field.values(video) {
+				for _, term := range searchTerms(value) {
+					fieldTerms[term] = true
+				}
+			}
+			for term := range fieldTerms {
+				if index.postings[term] == nil {
+					index.postings[term] = make(map[int]float64)
+				}
+				index.postings[term][position] += field.weight
+			}
+		}
+	}
+	return index
+}
+
+// Search returns the videos that match every term of the query, ordered by their relevance, then by their name.
+// A query term matches a term of the index exactly, as its prefix, within it, or with a typo, see matchQuality.
+func (index *SearchIndex) Search(query string) (results []SearchResult) {
+	queryTerms := searchTerms(query)
+	slices.Sort(queryTerms)
+	queryTerms = slices.Compact(queryTerms)
+	if len(queryTerms) == 0 {
+		return nil
+	}
+	var scores map[int]float64
+	for i, queryTerm := range queryTerms {
+		termScores := index.match(queryTerm)
+		if i == 0 {
+			scores = termScores
+			continue
+		}
+		for position := range scores {
+			score, found := termScores[position]
+			if !found {
+				delete(scores, position)
+				continue
+			}
+			scores[position] += score
+		}
+	}
+	for position, score := range scores {
+		results = append(results, SearchResult{Video: index.videos[position], Score: score})
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(strings.ToLower(a.Video.Name), strings.ToLower(b.Video.Name)), cmp.Compare(a.Video.ID, b.Video.ID))
+	})
+	return results
+}
+
+// match returns the score of the best match of a query term in each video, by the position of the video.
+func (index *SearchIndex) match(queryTerm string) map[int]float64 {
+	best := make(map[int]float64)
+	for term, postings := range index.postings {
+		quality := matchQuality(queryTerm, term)
+		if quality == 0 {
+			continue
+		}
+		for position, weight := range postings {
+			best[position] = max(best[position], quality*weight)
+		}
+	}
+	return best
+}
+
+// matchQuality rates how well a term of the index matches a query term, zero if it does not match.
+// A query term of 3 characters and more matches within a term, one of 4 characters and more tolerates a typo, see fuzzyDistance.
+func matchQuality(queryTerm, term string) float64 {
+	switch {
+	case term == queryTerm:
+		return matchExact
+	case strings.HasPrefix(term, queryTerm):
+		return matchPrefix
+	case len([]rune(queryTerm)) >= 3 && strings.Contains(term, queryTerm):
+		return matchInfix
+	}
+	allowed := fuzzyDistance(queryTerm)
+	if allowed > 0 && editDistance(queryTerm, term, allowed) <= allowed {
+		return matchFuzzy
+	}
+	return 0
+}
+
+// fuzzyDistance returns the number of typos tolerated in a query term, one from 4 characters and two from 8 characters on.
+func fuzzyDistance(queryTerm string) int {
+	switch length := len([]rune(queryTerm)); {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	}
+	return 0
+}
+
+// editDistance returns the Levenshtein distance of two terms, a distance above limit is returned as limit+1.
+func editDistance(a, b string, limit int) int {
+	first, second := []rune(a), []rune(b)
+	if len(first)-len(second) > limit || len(second)-len(first) > limit {
+		return limit + 1
+	}
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		rowMinimum := current[0]
+		for j := 1; j <= len(second); j++ {
+			substitution := previous[j-1]
+			if first[i-1] != second[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+			rowMinimum = min(rowMinimum, current[j])
+		}
+		if rowMinimum > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return min(previous[len(second)], limit+1)
+}
+
+// searchTerms splits a text into lower case terms of letters and digits, without diacritics, so that "Café" matches "cafe".
+func searchTerms(text string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), strings.ToLower(text))
+	if err != nil {
+		folded = strings.ToLower(text)
+	}
+	return strings.FieldsFunc(folded, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// searchIndexCache holds the search index of the loaded video database, it is built on first use and again once the data was reloaded.
+var searchIndexCache struct {
+	sync.Mutex
+	data  *sync.Map
+	index *SearchIndex
+}
+
+// loadedSearchIndex returns the search index of the loaded video database, see searchIndexCache.
+func loadedSearchIndex() (*SearchIndex, error) {
+	searchIndexCache.Lock()
+	defer searchIndexCache.Unlock()
+	data := Database.current().data
+	if searchIndexCache.index != nil && searchIndexCache.data == data && data != nil {
+		return searchIndexCache.index, nil
+	}
+	if data == nil {
+		videos, err := GetAllVideos()
+		return NewSearchIndex(videos), err
+	}
+	var videos []peertubeApi.VideoData
+	data.Range(func(_, value any) bool {
+		videos = append(videos, value.(peertubeApi.VideoData))
+		return true
+	})
+	searchIndexCache.data, searchIndexCache.index = data, NewSearchIndex(videos)
+	return searchIndexCache.index, nil
+}
+
+// SearchVideos returns the videos that match the query and the filter, see SearchIndex.Search and MatchesFilter.
+// Without a query every video that matches the filter is returned, unordered.
+func SearchVideos(query string, filter templates.VideoFilter) (videos []peertubeApi.VideoData, err error) {
+	if strings.TrimSpace(query) == "" {
+		allVideos, err := GetAllVideos()
+		if err != nil {
+			return nil, err
+		}
+		for _, video := range allVideos {
+			if MatchesFilter(video, filter) {
+				videos = append(videos, video)
+			}
+		}
+		return videos, nil
+	}
+	index, err := loadedSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range index.Search(query) {
+		if MatchesFilter(result.Video, filter) {
+			videos = append(videos, result.Video)
+		}
+	}
+	return videos, nil
+}
+
+// MatchesFilter reports whether a video matches every field of the filter that is set.
+// The publication is compared by its calendar day in the reporting time zone, a video without a valid publication date does not match a date.
+func MatchesFilter(video peertubeApi.VideoData, filter templates.VideoFilter) bool {
+	if !filter.PublishedFrom.IsZero() || !filter.PublishedUntil.IsZero() {
+		published, err := video.GetPublishedAt()
+		if err != nil {
+			return false
+		}
+		day := Database.ReportingDay(published)
+		if day.Before(filter.PublishedFrom) || !filter.PublishedUntil.IsZero() && day.After(filter.PublishedUntil) {
+			return false
+		}
+	}
+	if video.Duration < int64(filter.MinDurationMinutes)*60 || filter.MaxDurationMinutes > 0 && video.Duration > int64(filter.MaxDurationMinutes)*60 {
+		return false
+	}
+	if filter.Category != "" && !strings.EqualFold(video.Category.Label, filter.Category) {
+		return false
+	}
+	if filter.Privacy != "" && !strings.EqualFold(video.Privacy.Label, filter.Privacy) {
+		return false
+	}
+	if filter.Live == templates.LiveOnly && !video.IsLive || filter.Live == templates.LiveExcluded && video.IsLive {
+		return false
+	}
+	return filter.Channel == 0 || video.Channel.ID == filter.Channel
+}
+
+// FilterOptions are the values of the videos a VideoFilter can select, sorted.
+type FilterOptions struct {
+	Categories []string
+	Privacies  []string
+	Channels   []peertubeApi.Channel
+}
+
+// VideoFilterOptions collects the categories, privacies and channels of the videos.
+func VideoFilterOptions(videos []peertubeApi.VideoData) (options FilterOptions) {
+	knownChannels := make(map[int64]bool)
+	for _, video := range videos {
+		if video.Category.Label != "" && !slices.Contains(options.Categories, video.Category.Label) {
+			options.Categories = append(options.Categories, video.Category.Label)
+		}
+		if video.Privacy.Label != "" && !slices.Contains(options.Privacies, video.Privacy.Label) {
+			options.Privacies = append(options.Privacies, video.Privacy.Label)
+		}
+		if !knownChannels[video.Channel.ID] {
+			knownChannels[video.Channel.ID] = true
+			options.Channels = append(options.Channels, video.Channel)
+		}
+	}
+	slices.Sort(options.Categories)
+	slices.Sort(options.Privacies)
+	slices.SortFunc(options.Channels, func(a, b peertubeApi.Channel) int {
+		return cmp.Compare(strings.ToLower(cmp.Or(a.DisplayName, a.Name)), strings.ToLower(cmp.Or(b.DisplayName, b.Name)))
+	})
+	return options
+}
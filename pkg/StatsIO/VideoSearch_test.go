@@ -0,0 +1,159 @@
+package StatsIO
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// searchSampleVideos are the videos searched by the tests, in the order of their ids.
+var searchSampleVideos = []peertubeApi.VideoData{
+	{ID: 1, Name: "Installing Linux on a Laptop", TruncatedDescription: "A guide for beginners", Tags: []string{"tutorial", "linux"},
+		Category: peertubeApi.Metadata{Label: "Science & Technology"}, Language: peertubeApi.Metadata{Label: "English"},
+		Privacy: peertubeApi.Metadata{Label: "Public"}, Duration: 20 * 60, PublishedAt: "2025-01-10T09:00:00Z",
+		Channel: peertubeApi.Channel{ID: 10, Name: "tech", DisplayName: "Tech Talks"}},
+	{ID: 2, Name: "Weekly news", TruncatedDescription: "What happened on Linux this week", Tags: []string{"news"},
+		Category: peertubeApi.Metadata{Label: "News & Politics"}, Language: peertubeApi.Metadata{Label: "English"},
+		Privacy: peertubeApi.Metadata{Label: "Unlisted"}, Duration: 5 * 60, PublishedAt: "2025-02-01T23:30:00Z",
+		Channel: peertubeApi.Channel{ID: 20, Name: "news", DisplayName: "Newsroom"}},
+	{ID: 3, Name: "Café Konzert", TruncatedDescription: "Live aus dem Café", IsLive: true,
+		Category: peertubeApi.Metadata{Label: "Music"}, Language: peertubeApi.Metadata{Label: "Deutsch"},
+		Licence: peertubeApi.Metadata{Label: "Attribution"}, Privacy: peertubeApi.Metadata{Label: "Public"}, Duration: 90 * 60,
+		PublishedAt: "2025-03-05T18:00:00Z", Channel: peertubeApi.Channel{ID: 10, Name: "tech", DisplayName: "Tech Talks"}},
+	{ID: 4, Name: "PeerTube federation explained", TruncatedDescription: "How instances follow each other",
+		Category: peertubeApi.Metadata{Label: "Science & Technology"}, Privacy: peertubeApi.Metadata{Label: "Public"}, Duration: 45 * 60,
+		Channel: peertubeApi.Channel{ID: 20, Name: "news", DisplayName: "Newsroom"}},
+}
+
+func TestSearchIndex_Search(t *testing.T) {
+	index := NewSearchIndex(searchSampleVideos)
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []int64
+	}{
+		{"empty query", "  ", nil},
+		// the name weighs more than the description
+		{"exact term ranked by field", "linux", []int64{1, 2}},
+		{"prefix", "feder", []int64{4}},
+		{"within a term", "tube", []int64{4}},
+		{"typo", "federatoin", []int64{4}},
+		{"short terms tolerate no typo", "nws", nil},
+		{"diacritics are ignored", "cafe", []int64{3}},
+		{"every term has to match", "linux guide", []int64{1}},
+		{"tag", "tutorial", []int64{1}},
+		// equally relevant videos are ordered by their name
+		{"channel", "newsroom", []int64{4, 2}},
+		{"category", "music", []int64{3}},
+		{"language", "deutsch", []int64{3}},
+		{"licence", "attribution", []int64{3}},
+		// the match in the name and the tags outranks the match in the channel
+		{"name before channel", "news", []int64{2, 4}},
+		{"no match", "kubernetes", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int64
+			for _, result := range index.Search(tt.query) {
+				ids = append(ids, result.Video.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"peertube", "peertube", 2, 0},
+		{"pertube", "peertube", 2, 1},
+		{"federatoin", "federation", 2, 2},
+		{"linux", "news", 1, 2},
+		{"café", "cafe", 1, 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Database = StatsIO{Location: berlin}
+	day := func(month time.Month, day int) time.Time { return time.Date(2025, month, day, 0, 0, 0, 0, berlin) }
+
+	tests := []struct {
+		name    string
+		filter  templates.VideoFilter
+		wantIDs []int64
+	}{
+		{"no filter", templates.VideoFilter{}, []int64{1, 2, 3, 4}},
+		// video 2 was published on February 2 in Berlin, video 4 has no publication date
+		{"published from", templates.VideoFilter{PublishedFrom: day(time.February, 2)}, []int64{2, 3}},
+		{"published between", templates.VideoFilter{PublishedFrom: day(time.January, 1), PublishedUntil: day(time.February, 1)}, []int64{1}},
+		{"duration range", templates.VideoFilter{MinDurationMinutes: 10, MaxDurationMinutes: 60}, []int64{1, 4}},
+		{"category", templates.VideoFilter{Category: "science & technology"}, []int64{1, 4}},
+		{"privacy", templates.VideoFilter{Privacy: "Unlisted"}, []int64{2}},
+		{"live streams", templates.VideoFilter{Live: templates.LiveOnly}, []int64{3}},
+		{"no live streams", templates.VideoFilter{Live: templates.LiveExcluded}, []int64{1, 2, 4}},
+		{"channel and privacy", templates.VideoFilter{Channel: 10, Privacy: "Public"}, []int64{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int64
+			for _, video := range searchSampleVideos {
+				if MatchesFilter(video, tt.filter) {
+					ids = append(ids, video.ID)
+				}
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("MatchesFilter(%+v) selects %v, want %v", tt.filter, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchVideos(t *testing.T) {
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	data := &sync.Map{}
+	for _, video := range searchSampleVideos {
+		data.Store(video.ID, video)
+	}
+	Database = StatsIO{Location: time.UTC, loaded: publishedData(&loadedData{data: data})}
+
+	videos, err := SearchVideos("linux", templates.VideoFilter{Privacy: "Public"})
+	if err != nil || len(videos) != 1 || videos[0].ID != 1 {
+		t.Fatalf("SearchVideos() = %v, %v, want video 1", videos, err)
+	}
+	videos, err = SearchVideos("", templates.VideoFilter{Channel: 20})
+	if err != nil || len(videos) != 2 {
+		t.Fatalf("SearchVideos() without a query = %v, %v, want the 2 videos of the channel", videos, err)
+	}
+
+	// a reload swaps the video database, the index is built again
+	reloaded := &sync.Map{}
+	renamed := searchSampleVideos[1]
+	renamed.Name = "Linux news"
+	reloaded.Store(renamed.ID, renamed)
+	Database.publish(&loadedData{data: reloaded})
+	videos, err = SearchVideos("linux news", templates.VideoFilter{})
+	if err != nil || len(videos) != 1 || videos[0].Name != renamed.Name {
+		t.Errorf("SearchVideos() after a reload = %v, %v, want the renamed video", videos, err)
+	}
+}
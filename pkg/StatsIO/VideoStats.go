@@ -4,19 +4,46 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"time"
 
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
 	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
+	"github.com/sa-kemper/peertubestats/web/templates"
 )
 
 type VideoStat struct {
 	Time  time.Time `json:"time"`
 	Likes Stat      `json:"likes"`
 	Views Stat      `json:"views"`
+	// Missing is set if the video was deleted, private or blacklisted at Time, the stats are the last ones recorded before.
+	Missing bool `json:"missing"`
+	// Estimated is set if the video was not collected within the miss tolerance of Time, the stats follow the missing data policy.
+	Estimated bool `json:"estimated"`
+	// Unknown is set for estimated stats, if the missing data policy forbids an estimation. The likes and views are zero.
+	Unknown bool `json:"unknown"`
+	// Backfilled is set if the stats were read from a collection backfilled from the viewers statistics of PeerTube, see Backfill.
+	Backfilled bool `json:"backfilled"`
+	// Imported is set if the stats were read from a collection imported from a CSV file, see ImportCsv.
+	Imported bool `json:"imported"`
+	// Anomaly is the severity of the strongest view spike within the bucket of the stat, empty without one. See DetectAnomalies.
+	Anomaly string `json:"anomaly,omitempty"`
+	// Upgrade is the PeerTube version the instance was upgraded to within the bucket of the stat, empty without one. See Upgrades.
+	Upgrade string `json:"upgrade,omitempty"`
+	// Forecast is set for projected stats following the collected range, it holds their confidence interval. See ForecastVideos.
+	Forecast *ForecastInterval `json:"forecast,omitempty"`
 }
 
+// The policies for stats that were not collected, see StatsIO.MissingDataPolicy.
+const (
+	// MissingDataCarryForward uses the last collected stats.
+	MissingDataCarryForward = "carry-forward"
+	// MissingDataLinear interpolates between the surrounding collections.
+	MissingDataLinear = "linear"
+	// MissingDataUnknown marks the stats as unknown.
+	MissingDataUnknown = "unknown"
+)
+
 type Stat struct {
 	StartPercentage float64 `json:"start_percentage"`
 	EndPercentage   float64 `json:"end_percentage"`
@@ -24,30 +51,56 @@ type Stat struct {
 }
 
 // requestTimestamp will resolve a reasonable VideoStat for the given available ones and the requested one
+// The stat of a day is the last collection made on the reporting day of ts.
 // It throws an error on critical issues e.g. the whole year not being available or the years object is invalid
 func requestTimestamp(ts time.Time, id int64) (result VideoStat, err error) {
-	var lookupResult LikeView
-	dll, found := Database.TimeSeriesDB.Video.Load(id)
-	if !found {
+	return requestInterval(ts, unitEnd(Database.ReportingDay(ts), templates.TimeframeDaily), id)
+}
+
+// requestInterval resolves the stat of the last collection made between ts and until, the stat is labeled with ts.
+// Without a collection in this interval, or within the miss tolerance before it, the stat is estimated.
+func requestInterval(ts, until time.Time, id int64) (result VideoStat, err error) {
+	series := getVideoTimeSeries(id)
+	if series == nil {
 		return fallbackRequestTimestamp(ts, id)
 	}
-	doubleLinkedListValue, ok := dll.(*DoubleLinkedList)
-	if !ok {
-		LogHelp.NewLog(LogHelp.Fatal, "cannot load double linked list from time series database", map[string]string{"id": strconv.FormatInt(id, 10), "timestamp": ts.Format(time.RFC3339)}).Log()
-		// return will not be reached.
-		return fallbackRequestTimestamp(ts, id)
+
+	loaded := Database.current()
+	result = VideoStat{Time: ts, Missing: GetVideoLifecycle(id).MissingAt(until), Backfilled: readFromCollections(id, until, loaded.backfilled), Imported: readFromCollections(id, until, loaded.imported)}
+	lookupResult := series.At(until)
+	if !result.Missing && !until.Before(series.Earliest) && !loaded.timeSeries.collectedNear(id, ts, until) {
+		result.Estimated = true
+		switch Database.MissingDataPolicy {
+		case MissingDataLinear:
+			lookupResult = series.interpolate(ts)
+		case MissingDataUnknown:
+			result.Unknown = true
+			lookupResult = LikeView{}
+		}
 	}
+	result.Likes.Data = lookupResult.Likes
+	result.Views.Data = lookupResult.Views
+	return result, nil
+}
 
-	lookupResult = lookupTimeSeriesSingle(doubleLinkedListValue, ts)
-	return VideoStat{
-		Time: ts,
-		Likes: Stat{
-			Data: lookupResult.Likes,
-		},
-		Views: Stat{
-			Data: lookupResult.Views,
-		},
-	}, nil
+// collectedNear reports whether the last collection until the end of the interval was made at most StatsMissTolerance days before it started.
+func (TSDB *TimeSeriesDatabase) collectedNear(id int64, ts, until time.Time) bool {
+	position := sort.Search(len(TSDB.Collections), func(i int) bool { return TSDB.Collections[i].After(until) })
+	if position == 0 {
+		return false
+	}
+	collection := TSDB.Collections[position-1]
+	if collection.Before(ts.AddDate(0, 0, -Database.StatsMissTolerance)) {
+		return false
+	}
+	series := getVideoTimeSeries(id)
+	return series != nil && !collection.Before(series.Earliest) && !collection.After(series.Latest) && !GetVideoLifecycle(id).MissingAt(collection)
+}
+
+// calendarDay returns the number of the reporting day of t, days are counted from the unix epoch.
+func calendarDay(t time.Time) int64 {
+	t = t.In(Database.ReportingLocation())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
 }
 
 func fallbackRequestTimestamp(ts time.Time, id int64) (result VideoStat, err error) {
@@ -55,8 +108,9 @@ func fallbackRequestTimestamp(ts time.Time, id int64) (result VideoStat, err err
 	if ts.IsZero() {
 		return VideoStat{}, errors.New("requestTimestamp called, but no timestamp provided")
 	}
+	loaded := Database.current()
 	// handle pre-recording date
-	if ts.Before(Database.firstDataAvailable) {
+	if ts.Before(loaded.firstDataAvailable) {
 		return VideoStat{
 			Time:  ts,
 			Likes: Stat{Data: 0},
@@ -64,7 +118,7 @@ func fallbackRequestTimestamp(ts time.Time, id int64) (result VideoStat, err err
 		}, nil
 	}
 	// handle pre video creation and post video deletion
-	val, _ := Database.data.Load(id)
+	val, _ := loaded.data.Load(id)
 	metadata := val.(peertubeApi.VideoData)
 
 	result, err = preCreationPostDeletionShortcut(ts, metadata)
@@ -78,7 +132,7 @@ func fallbackRequestTimestamp(ts time.Time, id int64) (result VideoStat, err err
 		return result, nil
 	}
 
-	if _, err := os.Stat(filepath.Join(Database.DataFolder, ts.Format("2006"))); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(Database.DataFolder, Database.ReportingDay(ts).Format("2006"))); os.IsNotExist(err) {
 		return VideoStat{}, errors.New("the requested year is not available")
 	}
 
@@ -105,30 +159,28 @@ func preCreationPostDeletionShortcut(ts time.Time, metadata peertubeApi.VideoDat
 		}, err
 	}
 
-	deletedVal, inDeletedDB := Database.deletedDb.Load(metadata.ID)
-	if !inDeletedDB {
+	if !GetVideoLifecycle(metadata.ID).MissingAt(ts) {
 		return VideoStat{}, nil
 	}
-	if deletedVal.(time.Time).Before(ts) && !deletedVal.(time.Time).IsZero() {
-		return VideoStat{
-			Time: ts,
-			Likes: Stat{
-				StartPercentage: 0,
-				EndPercentage:   0,
-				Data:            metadata.Likes,
-			},
-			Views: Stat{
-				StartPercentage: 0,
-				EndPercentage:   0,
-				Data:            metadata.Views,
-			},
-		}, nil
-	}
-	return VideoStat{}, nil
+	// the video database keeps the metadata of the last collection the video was visible in.
+	return VideoStat{
+		Time: ts,
+		Likes: Stat{
+			StartPercentage: 0,
+			EndPercentage:   0,
+			Data:            metadata.Likes,
+		},
+		Views: Stat{
+			StartPercentage: 0,
+			EndPercentage:   0,
+			Data:            metadata.Views,
+		},
+		Missing: true,
+	}, nil
 }
 
 func getStatOfDate(ts time.Time, id int64) (result VideoStat, found bool) {
-	if _, err := os.Stat(getRawFilePath(ts)); !os.IsNotExist(err) {
+	if rawFileExists(getRawFilePath(ts)) {
 		videos := readRawResponses(ts)
 		if len(videos) < 1 {
 			// cannot read data
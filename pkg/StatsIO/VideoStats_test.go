@@ -0,0 +1,53 @@
+package StatsIO
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_requestTimestamp_missingDataPolicy(t *testing.T) {
+	// the video is collected on day 1, 2 and 5, the cron job missed day 3 and 4.
+	var series VideoTimeSeries
+	_ = series.insert(sampleDay(1), LikeView{Views: 10})
+	_ = series.insert(sampleDay(2), LikeView{Views: 10})
+	_ = series.insert(sampleDay(5), LikeView{Views: 40, Likes: 3})
+	videos := &sync.Map{}
+	videos.Store(int64(1), &series)
+
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{Location: time.UTC, loaded: publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: []time.Time{sampleDay(1), sampleDay(2), sampleDay(5)}}})}
+
+	tests := []struct {
+		policy        string
+		tolerance     int
+		day           int
+		wantViews     int64
+		wantEstimated bool
+		wantUnknown   bool
+	}{
+		{MissingDataCarryForward, 0, 2, 10, false, false},
+		{MissingDataCarryForward, 0, 3, 10, true, false},
+		{MissingDataCarryForward, 1, 3, 10, false, false},
+		{MissingDataCarryForward, 1, 4, 10, true, false},
+		{MissingDataLinear, 0, 3, 20, true, false},
+		{MissingDataLinear, 0, 4, 30, true, false},
+		{MissingDataLinear, 0, 5, 40, false, false},
+		{MissingDataUnknown, 0, 4, 0, true, true},
+		{MissingDataUnknown, 0, 6, 0, true, true},
+		{MissingDataUnknown, 0, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		Database.MissingDataPolicy = tt.policy
+		Database.StatsMissTolerance = tt.tolerance
+		got, err := requestTimestamp(sampleDay(tt.day), 1)
+		if err != nil {
+			t.Fatalf("requestTimestamp() error = %v", err)
+		}
+		if got.Views.Data != tt.wantViews || got.Estimated != tt.wantEstimated || got.Unknown != tt.wantUnknown {
+			t.Errorf("requestTimestamp(day %v) with %v and tolerance %v = %v views, estimated %v, unknown %v, want %v, %v, %v",
+				tt.day, tt.policy, tt.tolerance, got.Views.Data, got.Estimated, got.Unknown, tt.wantViews, tt.wantEstimated, tt.wantUnknown)
+		}
+	}
+}
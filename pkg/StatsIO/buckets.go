@@ -0,0 +1,140 @@
+package StatsIO
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// defaultBucketCount is the number of buckets shown if the request does not contain a usable start date.
+const defaultBucketCount = 5
+
+// bucketTimestamps returns the last unit of each bucket in the requested range, oldest first.
+// A unit is an hour in the Hourly timeframe and a day in all others, the stat of a bucket is the last collection within its last unit.
+// Buckets are aligned to calendar boundaries: weeks start on Database.WeekStart, quarters start in January, April, July and October.
+// Custom intervals of N days are aligned to the start date of the range.
+// The last bucket is clamped to the end date of the range, before is the last unit of the bucket preceding the first one.
+func bucketTimestamps(Dates Timeframe, Timeframe string) (timestamps []time.Time, before time.Time) {
+	timeframe, intervalDays := templates.ParseTimeframe(Timeframe)
+	endDate := Database.ReportingDay(Dates.GetEndDate())
+	startDate := Database.ReportingDay(Dates.GetStartDate())
+
+	if Dates.GetEndDate().IsZero() {
+		endDate = Database.ReportingDay(time.Now())
+	}
+	if timeframe == templates.TimeframeHourly {
+		// the end date is a day, its hours end with the current hour.
+		endDate = minTime(endDate.AddDate(0, 0, 1).Add(-time.Hour), reportingHour(time.Now()))
+	}
+	if Dates.GetStartDate().IsZero() || endDate.Before(startDate) {
+		startDate = endDate
+		for range defaultBucketCount {
+			startDate = periodStart(previousUnit(startDate, timeframe), timeframe, intervalDays, time.Time{}, Database.WeekStart)
+		}
+	}
+
+	origin := startDate
+	first := periodStart(startDate, timeframe, intervalDays, origin, Database.WeekStart)
+	before = previousUnit(first, timeframe)
+
+	timestamps = make([]time.Time, 0)
+	for current := first; !current.After(endDate); current = nextPeriodStart(current, timeframe, intervalDays) {
+		timestamps = append(timestamps, minTime(previousUnit(nextPeriodStart(current, timeframe, intervalDays), timeframe), endDate))
+	}
+	return timestamps, before
+}
+
+// previousUnit returns the start of the unit before the unit starting at start.
+func previousUnit(start time.Time, timeframe string) time.Time {
+	if timeframe == templates.TimeframeHourly {
+		return start.Add(-time.Hour)
+	}
+	return start.AddDate(0, 0, -1)
+}
+
+// unitEnd returns the last instant of the unit starting at start.
+func unitEnd(start time.Time, timeframe string) time.Time {
+	if timeframe == templates.TimeframeHourly {
+		return start.Add(time.Hour - time.Nanosecond)
+	}
+	return start.AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
+
+// reportingHour returns the start of the hour of t on the clock of the reporting time zone.
+func reportingHour(t time.Time) time.Time {
+	local := t.In(Database.ReportingLocation())
+	return local.Add(-time.Duration(local.Minute())*time.Minute - time.Duration(local.Second())*time.Second - time.Duration(local.Nanosecond()))
+}
+
+// periodStart returns the first day of the period containing day, or the first hour in the Hourly timeframe.
+// origin is the first day of a custom interval, it is ignored by the calendar timeframes.
+func periodStart(day time.Time, timeframe string, intervalDays int, origin time.Time, weekStart time.Weekday) time.Time {
+	if timeframe == templates.TimeframeHourly {
+		return reportingHour(day)
+	}
+	day = Database.ReportingDay(day)
+	switch timeframe {
+	case templates.TimeframeWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) - int(weekStart) + 7) % 7))
+	case templates.TimeframeMonthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	case templates.TimeframeQuarterly:
+		return time.Date(day.Year(), (day.Month()-1)/3*3+1, 1, 0, 0, 0, 0, day.Location())
+	case templates.TimeframeYearly:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, day.Location())
+	case templates.TimeframeCustom:
+		if origin.IsZero() {
+			return day.AddDate(0, 0, -(intervalDays - 1))
+		}
+		origin = Database.ReportingDay(origin)
+		offset := int(calendarDay(day) - calendarDay(origin))
+		// floor division, days before the origin belong to earlier intervals
+		periods := offset / intervalDays
+		if offset < 0 && offset%intervalDays != 0 {
+			periods--
+		}
+		return origin.AddDate(0, 0, periods*intervalDays)
+	}
+	return day
+}
+
+// nextPeriodStart returns the first day of the period following the period starting on start.
+func nextPeriodStart(start time.Time, timeframe string, intervalDays int) time.Time {
+	switch timeframe {
+	case templates.TimeframeHourly:
+		return start.Add(time.Hour)
+	case templates.TimeframeWeekly:
+		return start.AddDate(0, 0, 7)
+	case templates.TimeframeMonthly:
+		return start.AddDate(0, 1, 0)
+	case templates.TimeframeQuarterly:
+		return start.AddDate(0, 3, 0)
+	case templates.TimeframeYearly:
+		return start.AddDate(1, 0, 0)
+	case templates.TimeframeCustom:
+		return start.AddDate(0, 0, intervalDays)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// parseWeekday parses the english name of a weekday, it is used by the -week-start flag.
+func parseWeekday(weekStart *time.Weekday) func(string) error {
+	return func(value string) error {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.EqualFold(value, day.String()) {
+				*weekStart = day
+				return nil
+			}
+		}
+		return errors.New("unknown weekday " + value + ", expected monday to sunday")
+	}
+}
@@ -0,0 +1,57 @@
+package StatsIO
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_bucketTimestamps(t *testing.T) {
+	date := func(value string) time.Time {
+		parsed, _ := time.Parse(time.DateOnly, value)
+		return parsed
+	}
+	tests := []struct {
+		name       string
+		timeframe  string
+		weekStart  time.Weekday
+		start, end string
+		want       []string
+		wantBefore string
+	}{
+		{"daily", "Daily", time.Monday, "2025-01-30", "2025-02-01", []string{"2025-01-30", "2025-01-31", "2025-02-01"}, "2025-01-29"},
+		{"iso weeks", "Weekly", time.Monday, "2025-01-01", "2025-01-20", []string{"2025-01-05", "2025-01-12", "2025-01-19", "2025-01-20"}, "2024-12-29"},
+		{"weeks starting on sunday", "Weekly", time.Sunday, "2025-01-05", "2025-01-18", []string{"2025-01-11", "2025-01-18"}, "2025-01-04"},
+		{"months end on the last day", "Monthly", time.Monday, "2024-01-15", "2024-03-10", []string{"2024-01-31", "2024-02-29", "2024-03-10"}, "2023-12-31"},
+		{"quarters", "Quarterly", time.Monday, "2024-11-02", "2025-06-30", []string{"2024-12-31", "2025-03-31", "2025-06-30"}, "2024-09-30"},
+		{"years", "Yearly", time.Monday, "2023-06-01", "2024-06-01", []string{"2023-12-31", "2024-06-01"}, "2022-12-31"},
+		{"custom interval aligned to the start", "10d", time.Monday, "2025-01-03", "2025-01-25", []string{"2025-01-12", "2025-01-22", "2025-01-25"}, "2025-01-02"},
+		{"unknown timeframe is daily", "Minutely", time.Monday, "2025-01-01", "2025-01-02", []string{"2025-01-01", "2025-01-02"}, "2024-12-31"},
+	}
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Database.WeekStart = tt.weekStart
+			Database.Location = time.UTC
+			got, before := bucketTimestamps(templates.TwoDateForm{StartDate: date(tt.start), EndDate: date(tt.end)}, tt.timeframe)
+			var gotDates []string
+			for _, timestamp := range got {
+				gotDates = append(gotDates, timestamp.Format(time.DateOnly))
+			}
+			if len(gotDates) != len(tt.want) {
+				t.Fatalf("bucketTimestamps() = %v, want %v", gotDates, tt.want)
+			}
+			for i := range gotDates {
+				if gotDates[i] != tt.want[i] {
+					t.Errorf("bucketTimestamps() = %v, want %v", gotDates, tt.want)
+					break
+				}
+			}
+			if before.Format(time.DateOnly) != tt.wantBefore {
+				t.Errorf("bucketTimestamps() before = %v, want %v", before.Format(time.DateOnly), tt.wantBefore)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package StatsIO
+
+import (
+	"slices"
+	"time"
+	// embed the time zone database, the reporting time zone must be available on hosts without zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+// ReportingLocation returns the reporting time zone, the local time zone of the server if none is configured.
+func (statIO *StatsIO) ReportingLocation() *time.Location {
+	if statIO.Location == nil {
+		return time.Local
+	}
+	return statIO.Location
+}
+
+// ReportingDay returns the midnight starting the calendar day of t in the reporting time zone.
+// Collections, raw files and buckets all belong to the reporting day of their timestamp.
+func (statIO *StatsIO) ReportingDay(t time.Time) time.Time {
+	location := statIO.ReportingLocation()
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
+
+// CollectionTimestamp returns the timestamp a collection made at t is recorded with, the minute of t in the reporting time zone.
+// Collections made in the same minute share their raw file. The minute keeps the UTC offset of t, the collections in the
+// hour repeated at the end of daylight saving time are told apart, see rawFileName.
+func (statIO *StatsIO) CollectionTimestamp(t time.Time) time.Time {
+	return t.Truncate(time.Minute).In(statIO.ReportingLocation())
+}
+
+// FormatStatTime formats the time of a stat in the reporting time zone, the hour is included in the Hourly timeframe.
+func FormatStatTime(t time.Time, timeframe string) string {
+	if timeframe == templates.TimeframeHourly {
+		return t.In(Database.ReportingLocation()).Format("2006-01-02 15:04")
+	}
+	return t.In(Database.ReportingLocation()).Format("2006-01-02")
+}
+
+// isCollection reports whether ts is one of the sorted collections.
+// Derived data recorded in another time zone fails this check and is rebuilt from raw.
+func isCollection(collections []time.Time, ts time.Time) bool {
+	_, found := slices.BinarySearchFunc(collections, ts, func(collection, target time.Time) int { return collection.Compare(target) })
+	return found
+}
+
+// parseLocation parses the IANA name of a time zone, it is used by the -time-zone flag.
+func parseLocation(location **time.Location) func(string) error {
+	return func(value string) (err error) {
+		*location, err = time.LoadLocation(value)
+		return err
+	}
+}
@@ -0,0 +1,138 @@
+package StatsIO
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sa-kemper/peertubestats/web/templates"
+)
+
+func Test_getRawFilePath_timeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{DataFolder: "/data", Location: berlin}
+
+	tests := []struct {
+		name           string
+		collectionTime string
+		want           string
+	}{
+		{"before midnight in winter time", "2025-03-29T22:30:00Z", "/data/2025/03/29T2330.json"},
+		{"after midnight in winter time", "2025-03-29T23:30:00Z", "/data/2025/03/30T0030.json"},
+		{"after midnight in summer time", "2025-03-30T22:30:00Z", "/data/2025/03/31T0030.json"},
+		{"after midnight on the day summer time ends", "2025-10-25T22:30:00Z", "/data/2025/10/26T0030.json"},
+		{"before midnight after summer time ended", "2025-10-26T22:30:00Z", "/data/2025/10/26T2330.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collectionTime, _ := time.Parse(time.RFC3339, tt.collectionTime)
+			if got := getRawFilePath(collectionTime); got != filepath.FromSlash(tt.want) {
+				t.Errorf("getRawFilePath(%v) = %v, want %v", tt.collectionTime, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bucketTimestamps_dst(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{Location: berlin, WeekStart: time.Monday}
+
+	tests := []struct {
+		name       string
+		timeframe  string
+		start, end string
+		want       []string
+	}{
+		{"days around spring forward", "Daily", "2025-03-29", "2025-04-01", []string{"2025-03-29", "2025-03-30", "2025-03-31", "2025-04-01"}},
+		{"days around fall back", "Daily", "2025-10-25", "2025-10-27", []string{"2025-10-25", "2025-10-26", "2025-10-27"}},
+		{"weeks across fall back", "Weekly", "2025-10-20", "2025-11-09", []string{"2025-10-26", "2025-11-02", "2025-11-09"}},
+	}
+	// the day summer time starts has 23 hours, the day it ends has 25.
+	for day, hours := range map[string]int{"2025-03-30": 23, "2025-10-26": 25} {
+		parsed, _ := time.Parse(time.DateOnly, day)
+		got, _ := bucketTimestamps(templates.TwoDateForm{StartDate: parsed, EndDate: parsed}, templates.TimeframeHourly)
+		if len(got) != hours {
+			t.Errorf("bucketTimestamps() on %v returned %v hours, want %v", day, len(got), hours)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].Sub(got[i-1]) != time.Hour || got[i].In(berlin).Minute() != 0 {
+				t.Errorf("bucketTimestamps() on %v has hour %v after %v", day, got[i].In(berlin), got[i-1].In(berlin))
+			}
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// form dates are parsed in UTC
+			request := templates.FrontPageRequest{Timeframe: tt.timeframe}
+			request.Dates.StartDate, _ = time.Parse(time.DateOnly, tt.start)
+			request.Dates.EndDate, _ = time.Parse(time.DateOnly, tt.end)
+			request.HandleZeroDate(berlin)
+
+			got, _ := bucketTimestamps(request.Dates, request.Interval())
+			if len(got) != len(tt.want) {
+				t.Fatalf("bucketTimestamps() returned %v buckets, want %v", len(got), len(tt.want))
+			}
+			for i, timestamp := range got {
+				local := timestamp.In(berlin)
+				if local.Format(time.DateOnly) != tt.want[i] || local.Hour() != 0 || local.Minute() != 0 {
+					t.Errorf("bucket %v = %v, want midnight of %v", i, local, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExportStats_dst(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// collections were made shortly after midnight, the time series records them on their reporting day.
+	var series VideoTimeSeries
+	var collections []time.Time
+	for day, collectionTime := range []string{"2025-03-29T23:05:00Z", "2025-03-30T22:05:00Z", "2025-03-31T22:05:00Z"} {
+		parsed, _ := time.Parse(time.RFC3339, collectionTime)
+		reportingDay := time.Date(parsed.In(berlin).Year(), parsed.In(berlin).Month(), parsed.In(berlin).Day(), 0, 0, 0, 0, berlin)
+		_ = series.insert(reportingDay, LikeView{Views: int64(10 * (day + 1))})
+		collections = append(collections, reportingDay)
+	}
+	videos := &sync.Map{}
+	videos.Store(int64(1), &series)
+
+	previous := Database
+	t.Cleanup(func() { Database = previous })
+	Database = StatsIO{
+		Location:          berlin,
+		MissingDataPolicy: MissingDataUnknown,
+		loaded:            publishedData(&loadedData{timeSeries: &TimeSeriesDatabase{Video: videos, Collections: collections}}),
+	}
+
+	request := templates.FrontPageRequest{Timeframe: templates.TimeframeDaily}
+	request.Dates.StartDate, _ = time.Parse(time.DateOnly, "2025-03-30")
+	request.Dates.EndDate, _ = time.Parse(time.DateOnly, "2025-04-01")
+	request.HandleZeroDate(berlin)
+	got, err := ExportStatsForRequest(1, request)
+	if err != nil {
+		t.Fatalf("ExportStatsForRequest() error = %v", err)
+	}
+	wantViews := []int64{10, 20, 30}
+	if len(got) != len(wantViews) {
+		t.Fatalf("ExportStatsForRequest() returned %v buckets, want %v", len(got), len(wantViews))
+	}
+	for i, stat := range got {
+		if stat.Views.Data != wantViews[i] || stat.Estimated || stat.Unknown {
+			t.Errorf("bucket %v = %v views, estimated %v, unknown %v, want %v collected views", i, stat.Views.Data, stat.Estimated, stat.Unknown, wantViews[i])
+		}
+	}
+}
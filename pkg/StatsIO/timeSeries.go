@@ -3,14 +3,17 @@ package StatsIO
 import (
 	"encoding/json"
 	"errors"
-	"io"
+	"math"
 	"os"
 	"path"
+	"slices"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
 )
 
 type LikeView struct {
@@ -28,170 +31,192 @@ func (lv *LikeView) Equal(second *LikeView) bool {
 	return true
 }
 
+// TimeSeriesDataEntry is a run of collections in which the likes and views of a video did not change.
+// Date is the first collection of the run, Until the last one.
 type TimeSeriesDataEntry struct {
-	Date time.Time            `json:"date"`
-	Data LikeView             `json:"data"`
-	Next *TimeSeriesDataEntry `json:"next"`
-	Prev *TimeSeriesDataEntry `json:"prev"`
+	Date  time.Time `json:"date"`
+	Until time.Time `json:"until"`
+	Data  LikeView  `json:"data"`
 }
 
-type DoubleLinkedList struct {
-	Head     *TimeSeriesDataEntry `json:"head"`
-	Tail     *TimeSeriesDataEntry `json:"tail"`
-	Earliest time.Time            `json:"earliest"`
-	Latest   time.Time            `json:"latest"`
+// VideoTimeSeries holds the likes and views of a video, sorted by date.
+// There is no duplicate data in the time series, a new entry is only added if the data changed.
+type VideoTimeSeries struct {
+	Entries []TimeSeriesDataEntry
+	// Earliest and Latest are the first and the last collection of the video.
+	Earliest time.Time
+	Latest   time.Time
 }
 
 type TimeSeriesDatabase struct {
-	// Video is a map[int64]*DoubleLinkedList
+	// Video is a map[int64]*VideoTimeSeries
 	Video          *sync.Map
 	FirstTimestamp time.Time
 	LastTimestamp  time.Time
+	// Collections holds the time of every collection, sorted. It is derived from the raw files and not serialized.
+	Collections []time.Time
 }
 
 const TimeSeriesDatabaseFileName = "TimeSeriesDB.json"
 
-// appendHeadTimeSeries inserts an item into the front of the Double linked list IF:
-// - The provided timestamp is newer then the earliest in the Double linked list
-// --- If the data is a duplicate the earliest is replaced with the provided value
-func appendHeadTimeSeries(list *DoubleLinkedList, timestamp time.Time, value *TimeSeriesDataEntry) {
-	if list == nil || timestamp.IsZero() || value == nil {
-		return
-	}
-	if !timestamp.Before(list.Earliest) {
-		return
-	}
-	if list.Head.Data.Equal(&value.Data) {
-		// If the data is a duplicate only allow the earliest data sample.
-		list.Head.Next.Prev = value
-		value.Next = list.Head
-		list.Head = value
-		list.Earliest = timestamp
-		return
-	}
-
-	list.Head.Prev = value
-	value.Next = list.Head
-	list.Head = value
-	list.Earliest = timestamp
+// search returns the position of the first entry that starts after timestamp.
+func (series *VideoTimeSeries) search(timestamp time.Time) int {
+	return sort.Search(len(series.Entries), func(i int) bool { return series.Entries[i].Date.After(timestamp) })
 }
 
-// appendTailTimeSeries inserts an item into the end of the Double linked list IF:
-// - The data is not a duplicate
-// - The data is newer then the last entry ( Tail of the Double linked list )
-func appendTailTimeSeries(list *DoubleLinkedList, timestamp time.Time, value *TimeSeriesDataEntry) {
-	if list == nil || timestamp.IsZero() || value == nil {
-		return
-	}
-	if !list.Tail.Date.Before(timestamp) {
-		return
-	}
-	if list.Tail.Data.Equal(&value.Data) {
-		return
-	}
-
-	list.Tail.Next = value
-	value.Prev = list.Tail
-
-	list.Tail = value
-	list.Latest = value.Date
+// insert records the data collected at timestamp without knowing the other collections, see insertAmong.
+func (series *VideoTimeSeries) insert(timestamp time.Time, data LikeView) error {
+	return series.insertAmong(timestamp, data, nil)
 }
 
-// insertTimeSeries
-func insertTimeSeries(list *DoubleLinkedList, timestamp time.Time, value *TimeSeriesDataEntry) {
-	if list == nil || timestamp.IsZero() || value == nil {
-		LogHelp.NewLog(LogHelp.Warn, "invalid input for insertTimeSeries", map[string]interface{}{"list: ": list, "time": timestamp, "value": value}).Log()
-		return
-	}
-	if list.Tail == nil || list.Head == nil || list.Earliest.IsZero() || list.Latest.IsZero() {
-		// We are the first entry.
-		list.Head = value
-		list.Tail = value
-		list.Earliest = timestamp
-		list.Latest = timestamp
-		return
-	}
-
-	if timestamp.Before(list.Earliest) {
-		appendHeadTimeSeries(list, timestamp, value)
-		return
-	}
-	if timestamp.After(list.Latest) {
-		appendTailTimeSeries(list, timestamp, value)
-		return
-	}
-	var current, previous *TimeSeriesDataEntry
-	current = list.Head
-
-	for current.Date.Before(timestamp) && current.Next != nil {
-		if current.Next.Date.After(timestamp) {
-			if !current.Data.Equal(&value.Data) {
-				if previous != nil {
-					previous.Next = value
-				}
-				current.Prev = value
-				return
+// insertAmong records the data collected at timestamp. Samples may be inserted in any order.
+// A sample within a run of different data splits the run: its part before the sample ends at the last of the sorted collections
+// before the sample, its part after the sample resumes at the first collection after it. Without such a collection within the run,
+// the part ends or resumes at the end of the run it is part of.
+func (series *VideoTimeSeries) insertAmong(timestamp time.Time, data LikeView, collections []time.Time) error {
+	if timestamp.IsZero() {
+		return errors.New("cannot insert a sample without a timestamp")
+	}
+	entries := series.Entries
+	position := series.search(timestamp)
+
+	if position > 0 && !timestamp.After(entries[position-1].Until) {
+		// the timestamp lies within the run position-1
+		run := entries[position-1]
+		if run.Data.Equal(&data) {
+			return nil
+		}
+		// previous and next are the positions of the collections before and after the sample
+		next, found := slices.BinarySearchFunc(collections, timestamp, time.Time.Compare)
+		previous := next - 1
+		if found {
+			next++
+		}
+		var parts []TimeSeriesDataEntry
+		if timestamp.After(run.Date) {
+			before := run
+			before.Until = run.Date
+			if previous >= 0 && collections[previous].After(run.Date) {
+				before.Until = collections[previous]
+			}
+			parts = append(parts, before)
+		}
+		if timestamp.Before(run.Until) {
+			after := run
+			after.Date = run.Until
+			if next < len(collections) && collections[next].Before(run.Until) {
+				after.Date = collections[next]
 			}
-			// skip the value as it is a duplicate
+			parts = append(parts, after)
+		}
+		// the run is replaced by its parts, the sample is inserted between them and merged with its neighbours.
+		entries = slices.Replace(entries, position-1, position, parts...)
+		if !timestamp.After(run.Date) {
+			position--
 		}
-		// we have not found the most current data point that could need updating
-		current = current.Next
-		previous = current
 	}
 
+	joinsPrevious := position > 0 && entries[position-1].Data.Equal(&data)
+	joinsNext := position < len(entries) && entries[position].Data.Equal(&data)
+	switch {
+	case joinsPrevious && joinsNext:
+		entries[position-1].Until = entries[position].Until
+		entries = append(entries[:position], entries[position+1:]...)
+	case joinsPrevious:
+		entries[position-1].Until = timestamp
+	case joinsNext:
+		entries[position].Date = timestamp
+	default:
+		entries = slices.Insert(entries, position, TimeSeriesDataEntry{Date: timestamp, Until: timestamp, Data: data})
+	}
+	series.Entries = entries
+	series.Earliest = entries[0].Date
+	series.Latest = entries[len(entries)-1].Until
+	return nil
 }
 
-func lookupTimeSeriesSingle(list *DoubleLinkedList, timestamp time.Time) LikeView {
-	if list == nil || timestamp.Before(list.Earliest) {
+// At returns the likes and views at timestamp, the data of the latest run that started before it.
+// Before the first collection no likes or views are recorded.
+func (series *VideoTimeSeries) At(timestamp time.Time) LikeView {
+	if series == nil {
 		return LikeView{}
 	}
-	if list.Tail == nil {
+	position := series.search(timestamp)
+	if position == 0 {
 		return LikeView{}
-	} // there is no likes or views recorded.
-	if timestamp.After(list.Latest) {
-		return list.Tail.Data
 	}
+	return series.Entries[position-1].Data
+}
 
-	distanceHead := timestamp.Sub(list.Earliest)
-	distanceTail := timestamp.Sub(list.Latest)
+// interpolate returns the likes and views at timestamp, linearly interpolated between the surrounding collections.
+// Outside the collected range, and within a run, it is equal to At.
+func (series *VideoTimeSeries) interpolate(timestamp time.Time) LikeView {
+	position := series.search(timestamp)
+	if position == 0 || position == len(series.Entries) || !timestamp.After(series.Entries[position-1].Until) {
+		return series.At(timestamp)
+	}
+	previous, next := series.Entries[position-1], series.Entries[position]
+	ratio := float64(timestamp.Sub(previous.Until)) / float64(next.Date.Sub(previous.Until))
+	return LikeView{
+		Likes: previous.Data.Likes + int64(math.Round(ratio*float64(next.Data.Likes-previous.Data.Likes))),
+		Views: previous.Data.Views + int64(math.Round(ratio*float64(next.Data.Views-previous.Data.Views))),
+	}
+}
 
-	if distanceHead > distanceTail {
-		return findFromTail(list, timestamp)
+// Range returns the entries that start within [from, to], oldest first.
+func (series *VideoTimeSeries) Range(from, to time.Time) []TimeSeriesDataEntry {
+	if series == nil || to.Before(from) {
+		return []TimeSeriesDataEntry{}
 	}
-	return findFromHead(list, timestamp)
+	first := sort.Search(len(series.Entries), func(i int) bool { return !series.Entries[i].Date.Before(from) })
+	return append([]TimeSeriesDataEntry{}, series.Entries[first:max(first, series.search(to))]...)
 }
 
-func findFromTail(list *DoubleLinkedList, timestamp time.Time) LikeView {
-	current := list.Tail
-	for current.Date.After(timestamp) {
-		if current.Prev == nil {
-			return LikeView{}
-		}
-		if current.Prev.Date.Before(timestamp) {
-			return current.Prev.Data
-		}
-		current = current.Prev
+// RangeQuery returns every change of the likes and views of a video between from and to (inclusive), oldest first.
+// Use it together with the data before from, see VideoTimeSeries.At, to obtain the full picture of the range.
+func RangeQuery(id int64, from, to time.Time) []TimeSeriesDataEntry {
+	return getVideoTimeSeries(id).Range(from, to)
+}
+
+// getVideoTimeSeries returns the loaded time series of a video, nil if it has none.
+func getVideoTimeSeries(id int64) *VideoTimeSeries {
+	timeSeries := Database.current().timeSeries
+	if timeSeries == nil || timeSeries.Video == nil {
+		return nil
 	}
-	if current == list.Head {
-		LogHelp.NewLog(LogHelp.Error, "Cannot find suitable datapoint for timestamp", map[string]string{"Timestamp:": timestamp.Format(time.RFC3339)}).Log()
+	value, found := timeSeries.Video.Load(id)
+	if !found {
+		return nil
 	}
-	return LikeView{}
+	series, ok := value.(*VideoTimeSeries)
+	LogHelp.ErrorOnNotOK("cannot cast time series value", map[string]int64{"id": id}, ok)
+	return series
 }
 
-func findFromHead(list *DoubleLinkedList, timestamp time.Time) LikeView {
-	current := list.Head
-	for current.Date.Before(timestamp) {
-		if current.Next == nil || current.Next.Date.After(timestamp) {
-			return current.Data
-		}
-		current = current.Next
+// insertCollection adds every video of a collection to the time series database.
+// A run the collection falls into is split at it, the collections of the database bound its parts, see VideoTimeSeries.insertAmong.
+func (TSDB *TimeSeriesDatabase) insertCollection(videos []peertubeApi.VideoData, collectionTime time.Time) {
+	if len(videos) == 0 {
+		return
+	}
+	if TSDB.FirstTimestamp.IsZero() || collectionTime.Before(TSDB.FirstTimestamp) {
+		TSDB.FirstTimestamp = collectionTime
 	}
-	if current == list.Tail {
-		LogHelp.NewLog(LogHelp.Error, "Cannot find suitable datapoint for timestamp", map[string]string{"Timestamp:": timestamp.Format(time.RFC3339)}).Log()
+	if collectionTime.After(TSDB.LastTimestamp) {
+		TSDB.LastTimestamp = collectionTime
+	}
+	if position, found := slices.BinarySearchFunc(TSDB.Collections, collectionTime, time.Time.Compare); !found {
+		TSDB.Collections = slices.Insert(TSDB.Collections, position, collectionTime)
+	}
+	for _, video := range videos {
+		value, _ := TSDB.Video.LoadOrStore(video.ID, &VideoTimeSeries{})
+		err := value.(*VideoTimeSeries).insertAmong(collectionTime, LikeView{Likes: video.Likes, Views: video.Views}, TSDB.Collections)
+		LogHelp.LogOnError("cannot insert the video into the time series", map[string]interface{}{"videoID": video.ID}, err)
 	}
-	return LikeView{}
 }
 
+// serializeTimeSeries writes the time series of every video, then the TimeSeriesDatabaseFileName listing them.
+// Every file is replaced atomically, a reader sees either the previous or the new version of a file.
 func serializeTimeSeries(list *TimeSeriesDatabase) error {
 	var serialData = struct {
 		VideosSaved []int64
@@ -208,10 +233,11 @@ func serializeTimeSeries(list *TimeSeriesDatabase) error {
 		return err
 	}
 
-	sem := make(chan struct{}, Database.StatIOMaxThreads)
+	sem := make(chan struct{}, max(1, Database.StatIOMaxThreads))
+	errsMutex := sync.Mutex{}
+	var errs []error
 	list.Video.Range(func(key, value interface{}) bool {
-		waitGroup.Add(1)
-		dllVal, ok := value.(*DoubleLinkedList)
+		seriesVal, ok := value.(*VideoTimeSeries)
 		if !ok {
 			LogHelp.NewLog(LogHelp.Fatal, "cannot cast time series value", list).Log()
 		}
@@ -222,198 +248,192 @@ func serializeTimeSeries(list *TimeSeriesDatabase) error {
 
 		serialData.VideosSaved = append(serialData.VideosSaved, vidIDVal)
 
+		waitGroup.Add(1)
 		sem <- struct{}{}
 		go func() {
-			LogHelp.LogOnError("cannot serialize double linked list", nil, serializeDoubleLinkedList(vidIDVal, dllVal, &waitGroup))
+			defer waitGroup.Done()
+			if serializeErr := serializeVideoTimeSeries(vidIDVal, seriesVal); serializeErr != nil {
+				errsMutex.Lock()
+				errs = append(errs, serializeErr)
+				errsMutex.Unlock()
+			}
 			<-sem
 		}()
 		return true
 	})
-
-	handle, err := os.OpenFile(path.Join(Database.DataFolder, TimeSeriesDatabaseFileName), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+	waitGroup.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return errors.Join(errors.New("cannot serialize video time series"), err)
 	}
-	defer handle.Close()
-	err = json.NewEncoder(handle).Encode(serialData)
+
+	indexBytes, err := json.Marshal(serialData)
 	if err != nil {
 		return err
 	}
-	waitGroup.Wait()
-	return nil
+	return writeFileAtomically(path.Join(Database.DataFolder, TimeSeriesDatabaseFileName), indexBytes)
 }
 
-type serializedDoubleLinkedListProxyStruct struct {
-	Items map[int64]struct {
-		Date time.Time `json:"date"`
-		Data LikeView  `json:"data"`
-	} `json:"items"`
-	Earliest time.Time `json:"earliest"`
-	Latest   time.Time `json:"last"`
+// serializedTimeSeriesProxyStruct is the file format of a single video time series, the items are numbered from 1.
+type serializedTimeSeriesProxyStruct struct {
+	Items    map[int64]TimeSeriesDataEntry `json:"items"`
+	Earliest time.Time                     `json:"earliest"`
+	Latest   time.Time                     `json:"last"`
 }
 
-func serializeDoubleLinkedList(id int64, list *DoubleLinkedList, group *sync.WaitGroup) error {
-	defer group.Done()
-
-	proxy := serializedDoubleLinkedListProxyStruct{
-		Earliest: list.Earliest,
-		Latest:   list.Latest,
-		Items: make(map[int64]struct {
-			Date time.Time `json:"date"`
-			Data LikeView  `json:"data"`
-		}),
+func serializeVideoTimeSeries(id int64, series *VideoTimeSeries) error {
+	proxy := serializedTimeSeriesProxyStruct{
+		Earliest: series.Earliest,
+		Latest:   series.Latest,
+		Items:    make(map[int64]TimeSeriesDataEntry, len(series.Entries)),
 	}
-	current := list.Head
-	var counter int64 = 1
-	handle, err := os.OpenFile(path.Join(Database.DataFolder, "TimeSeries", strconv.FormatInt(id, 10))+".json", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+	for i, entry := range series.Entries {
+		proxy.Items[int64(i+1)] = entry
 	}
-	defer handle.Close()
-	for current != nil {
-		proxy.Items[counter] = struct {
-			Date time.Time `json:"date"`
-			Data LikeView  `json:"data"`
-		}{Date: current.Date, Data: current.Data}
-		current = current.Next
-		counter++
-	}
-	err = json.NewEncoder(handle).Encode(proxy)
+	proxyBytes, err := json.Marshal(proxy)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return writeFileAtomically(path.Join(Database.DataFolder, "TimeSeries", strconv.FormatInt(id, 10))+".json", proxyBytes)
 }
 
-func loadDoubleLinkedList(id int64, group *sync.WaitGroup, store *sync.Map) error {
-	defer group.Done()
-	var list serializedDoubleLinkedListProxyStruct
+func loadVideoTimeSeries(id int64, store *sync.Map) error {
+	var proxy serializedTimeSeriesProxyStruct
 	handle, err := os.OpenFile(path.Join(Database.DataFolder, "TimeSeries", strconv.FormatInt(id, 10))+".json", os.O_RDONLY, 0600)
 	if err != nil {
 		return err
 	}
 	defer handle.Close()
 
-	err = json.NewDecoder(handle).Decode(&list)
+	err = json.NewDecoder(handle).Decode(&proxy)
 	if err != nil {
 		return err
 	}
-	if len(list.Items) == 0 {
-		return nil // no views or likes recorded.
+	series := VideoTimeSeries{
+		Entries:  make([]TimeSeriesDataEntry, 0, len(proxy.Items)),
+		Earliest: proxy.Earliest,
+		Latest:   proxy.Latest,
 	}
-	var current = &TimeSeriesDataEntry{
-		Date: list.Items[1].Date,
-		Data: list.Items[1].Data,
-		Next: nil,
-		Prev: nil,
-	}
-	dll := DoubleLinkedList{
-		Head:     current,
-		Tail:     current,
-		Earliest: list.Earliest,
-		Latest:   list.Latest,
-	}
-
-	for i := 2; i <= len(list.Items); i++ {
-		current.Next = &TimeSeriesDataEntry{
-			Date: list.Items[int64(i)].Date,
-			Data: list.Items[int64(i)].Data,
-			Next: nil,
-			Prev: current,
+	for i := 1; i <= len(proxy.Items); i++ {
+		entry, found := proxy.Items[int64(i)]
+		if !found {
+			return errors.New("time series item " + strconv.Itoa(i) + " is missing")
 		}
-		current = current.Next
-		dll.Tail = current
+		if entry.Until.IsZero() {
+			// files written before runs were recorded only hold the first collection of each run, they have to be rebuilt from raw.
+			return errors.New("time series item " + strconv.Itoa(i) + " has no end of its run")
+		}
+		series.Entries = append(series.Entries, entry)
 	}
-	store.Swap(id, &dll)
+	store.Store(id, &series)
 	return nil
 }
 
+// errTimeSeriesOutdated is returned by loadTimeSeries for a time series that is missing, unreadable or recorded in another time zone.
+// It has to be rebuilt from the raw data by a writer of the data folder, see loadTimeSeriesForWriting.
+var errTimeSeriesOutdated = errors.New("the time series has to be rebuilt from the raw data")
+
+// loadTimeSeries reads the time series database, it never writes to the data folder.
+// A data folder without collections has an empty time series.
 func loadTimeSeries() (*TimeSeriesDatabase, error) {
-	var TSDB TimeSeriesDatabase
 	var serialData struct {
 		VideosSaved []int64
-		FistItem    time.Time
+		FirstItem   time.Time
 		LastItem    time.Time
 	}
-	waitGroup := sync.WaitGroup{}
-	err := os.MkdirAll(path.Join(Database.DataFolder, "TimeSeries"), 0700)
-	if err != nil {
-		return nil, err
+	collections := listRawFiles()
+	indexBytes, err := os.ReadFile(path.Join(Database.DataFolder, TimeSeriesDatabaseFileName))
+	if os.IsNotExist(err) && len(collections) == 0 {
+		return &TimeSeriesDatabase{Video: &sync.Map{}}, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(indexBytes, &serialData)
 	}
-
-	handle, err := os.OpenFile(path.Join(Database.DataFolder, TimeSeriesDatabaseFileName), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		LogHelp.NewLog(LogHelp.Warn, "cannot read time series data, importing from raw", nil).Log()
-		return importTimeSeriesFromRawData()
+		return nil, errors.Join(errTimeSeriesOutdated, err)
 	}
-	defer handle.Close()
-	err = json.NewDecoder(handle).Decode(&serialData)
-	if errors.Is(err, io.EOF) {
-		LogHelp.NewLog(LogHelp.Warn, "cannot read time series data, importing from raw", nil).Log()
-		return importTimeSeriesFromRawData()
+	if !serialData.FirstItem.IsZero() && !isCollection(collections, serialData.FirstItem) {
+		return nil, errors.Join(errTimeSeriesOutdated, errors.New("the time series was recorded in another time zone, its first item "+serialData.FirstItem.String()+" is no collection"))
 	}
-	TSDB.Video = &sync.Map{}
-	if err != nil {
-		return nil, err
+	TSDB := TimeSeriesDatabase{
+		Video:          &sync.Map{},
+		FirstTimestamp: serialData.FirstItem,
+		LastTimestamp:  serialData.LastItem,
+		Collections:    collections,
 	}
-	sem := make(chan struct{}, Database.StatIOMaxThreads)
-	waitGroup.Add(len(serialData.VideosSaved))
-	for _, id := range serialData.VideosSaved {
-		TSDB.Video.Store(id, &DoubleLinkedList{})
+	waitGroup := sync.WaitGroup{}
+	sem := make(chan struct{}, max(1, Database.StatIOMaxThreads))
+	errs := make([]error, len(serialData.VideosSaved))
+	for i, id := range serialData.VideosSaved {
+		waitGroup.Add(1)
 		sem <- struct{}{}
 		go func() {
-
-			LogHelp.FatalOnError("cannot load double linked list", nil, loadDoubleLinkedList(id, &waitGroup, TSDB.Video))
+			defer waitGroup.Done()
+			errs[i] = loadVideoTimeSeries(id, TSDB.Video)
 			<-sem
 		}()
 	}
-
 	waitGroup.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return nil, errors.Join(errTimeSeriesOutdated, err)
+	}
 	return &TSDB, nil
 }
 
-func importTimeSeriesFromRawData() (*TimeSeriesDatabase, error) {
+// loadTimeSeriesForWriting reads the time series database, an outdated one is rebuilt from the raw data, see errTimeSeriesOutdated.
+// The caller holds the collector lock and writes the time series afterward.
+func loadTimeSeriesForWriting() (*TimeSeriesDatabase, error) {
+	TSDB, err := loadTimeSeries()
+	if errors.Is(err, errTimeSeriesOutdated) {
+		LogHelp.NewLog(LogHelp.Warn, "cannot read time series data, importing from raw", map[string]string{"reason": err.Error()}).Log()
+		return buildTimeSeriesFromRaw(listRawFiles()), nil
+	}
+	return TSDB, err
+}
+
+// rebuildOutdatedTimeSeries rebuilds the time series from the raw data if it is outdated, holding the collector lock, see errTimeSeriesOutdated.
+func (statIO *StatsIO) rebuildOutdatedTimeSeries(lockWait time.Duration) error {
+	if _, err := loadTimeSeries(); !errors.Is(err, errTimeSeriesOutdated) {
+		return nil
+	}
+	unlock, err := statIO.LockCollector(lockWait)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		LogHelp.LogOnError("cannot release collector lock", map[string]string{"dataFolder": statIO.DataFolder}, unlock())
+	}()
+	TSDB, err := loadTimeSeriesForWriting()
+	if err != nil {
+		return err
+	}
+	return serializeTimeSeries(TSDB)
+}
+
+// updateTimeSeries adds a collection to the loaded time series database and writes it to disk.
+func (statIO *StatsIO) updateTimeSeries(videos []peertubeApi.VideoData, collectionTime time.Time) error {
+	timeSeries := statIO.current().timeSeries
+	if timeSeries == nil || timeSeries.Video == nil {
+		var err error
+		timeSeries, err = loadTimeSeriesForWriting()
+		if err != nil {
+			return err
+		}
+	}
+	timeSeries.insertCollection(videos, collectionTime)
+	statIO.update(func(loaded *loadedData) { loaded.timeSeries = timeSeries })
+	return serializeTimeSeries(timeSeries)
+}
+
+// buildTimeSeriesFromRaw reads the raw files of the given collection times in order and builds a time series database from them.
+func buildTimeSeriesFromRaw(collectionTimes []time.Time) *TimeSeriesDatabase {
 	TsDB := TimeSeriesDatabase{
 		Video:          &sync.Map{},
 		FirstTimestamp: time.Time{},
 		LastTimestamp:  time.Time{},
 	}
-	var firstDate = Database.firstDataAvailable
-	if firstDate.IsZero() {
-		firstDate = findFirstDataAvailable()
-	}
-	var currentDate = firstDate
-	for currentDate.Before(time.Now()) {
-		Videos := readRawResponses(currentDate)
-		if len(Videos) < 1 {
-			currentDate = currentDate.AddDate(0, 0, 1)
-			continue
-		}
-		for _, video := range Videos {
-			doubleLinkedListVal, found := TsDB.Video.Load(video.ID)
-			var doubleLinkedList *DoubleLinkedList
-			if found {
-				doubleLinkedList = doubleLinkedListVal.(*DoubleLinkedList)
-			} else {
-				doubleLinkedList = &DoubleLinkedList{}
-			}
-			insertTimeSeries(doubleLinkedList, currentDate, &TimeSeriesDataEntry{
-				Date: currentDate,
-				Data: LikeView{
-					Likes: video.Likes,
-					Views: video.Views,
-				},
-				Next: nil,
-				Prev: nil,
-			})
-			if !found {
-				TsDB.Video.Store(video.ID, doubleLinkedList)
-			}
-		}
-		currentDate = currentDate.AddDate(0, 0, 1)
+	for _, currentDate := range collectionTimes {
+		// the raw files are replayed in order, no run is split.
+		TsDB.insertCollection(readRawResponses(currentDate), currentDate)
 	}
-	err := serializeTimeSeries(&TsDB)
-	LogHelp.FatalOnError("cannot serialize time series database", nil, err)
-	return &TsDB, nil
+	return &TsDB
 }
@@ -0,0 +1,195 @@
+package StatsIO
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+type timeSeriesSample struct {
+	Day  int
+	Data LikeView
+}
+
+// timeSeriesSamples are samples of distinct days in random order, the small value range produces many unchanged samples.
+type timeSeriesSamples []timeSeriesSample
+
+func (timeSeriesSamples) Generate(rand *rand.Rand, size int) reflect.Value {
+	var samples timeSeriesSamples
+	for _, day := range rand.Perm(2 * size)[:rand.Intn(2*size)] {
+		samples = append(samples, timeSeriesSample{Day: day, Data: LikeView{Likes: rand.Int63n(2), Views: rand.Int63n(3)}})
+	}
+	return reflect.ValueOf(samples)
+}
+
+func sampleDay(day int) time.Time {
+	return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, day)
+}
+
+func (samples timeSeriesSamples) sorted() timeSeriesSamples {
+	sorted := slices.Clone(samples)
+	slices.SortFunc(sorted, func(a, b timeSeriesSample) int { return a.Day - b.Day })
+	return sorted
+}
+
+// build inserts the samples in their order, the days of the samples inserted so far are the collections, see insertAmong.
+func (samples timeSeriesSamples) build() (series VideoTimeSeries, err error) {
+	var collections []time.Time
+	for _, sample := range samples {
+		day := sampleDay(sample.Day)
+		if position, found := slices.BinarySearchFunc(collections, day, time.Time.Compare); !found {
+			collections = slices.Insert(collections, position, day)
+		}
+		err = errors.Join(err, series.insertAmong(day, sample.Data, collections))
+	}
+	return series, err
+}
+
+func TestVideoTimeSeries_insertSorted(t *testing.T) {
+	property := func(samples timeSeriesSamples) bool {
+		sorted := samples.sorted()
+		series, err := sorted.build()
+		if err != nil {
+			t.Logf("insert() error = %v", err)
+			return false
+		}
+		for i, entry := range series.Entries {
+			if entry.Until.Before(entry.Date) {
+				t.Logf("entry %v ends before it starts", entry)
+				return false
+			}
+			if i > 0 && (!series.Entries[i-1].Until.Before(entry.Date) || series.Entries[i-1].Data.Equal(&entry.Data)) {
+				t.Logf("entries %v and %v overlap or are duplicates", series.Entries[i-1], entry)
+				return false
+			}
+		}
+		// At must return the latest sample at or before the requested day.
+		for day := -1; day <= 2*len(samples)+1; day++ {
+			var want LikeView
+			for _, sample := range sorted {
+				if sample.Day <= day {
+					want = sample.Data
+				}
+			}
+			if got := series.At(sampleDay(day)); got != want {
+				t.Logf("At(%v) = %v, want %v", day, got, want)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVideoTimeSeries_insertOutOfOrder(t *testing.T) {
+	// A sample within a run splits it, the series must be the one a sorted import of the samples builds.
+	property := func(samples timeSeriesSamples) bool {
+		series, err := samples.build()
+		want, _ := samples.sorted().build()
+		if err != nil || !reflect.DeepEqual(series, want) {
+			t.Logf("insert() = %v, %v, want %v", series.Entries, err, want.Entries)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVideoTimeSeries_Range(t *testing.T) {
+	property := func(samples timeSeriesSamples, from, to uint8) bool {
+		series, _ := samples.sorted().build()
+		fromTs, toTs := sampleDay(int(from%64)), sampleDay(int(to%64))
+		want := []TimeSeriesDataEntry{}
+		for _, entry := range series.Entries {
+			if !entry.Date.Before(fromTs) && !entry.Date.After(toTs) {
+				want = append(want, entry)
+			}
+		}
+		if got := series.Range(fromTs, toTs); !reflect.DeepEqual(got, want) {
+			t.Logf("Range(%v, %v) = %v, want %v", from%64, to%64, got, want)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVideoTimeSeries_insert(t *testing.T) {
+	views := func(v int64) LikeView { return LikeView{Views: v} }
+	tests := []struct {
+		name    string
+		samples timeSeriesSamples
+		want    []TimeSeriesDataEntry
+		wantErr bool
+	}{
+		{
+			name:    "insertion into the middle",
+			samples: timeSeriesSamples{{1, views(1)}, {5, views(3)}, {3, views(2)}},
+			want: []TimeSeriesDataEntry{
+				{Date: sampleDay(1), Until: sampleDay(1), Data: views(1)},
+				{Date: sampleDay(3), Until: sampleDay(3), Data: views(2)},
+				{Date: sampleDay(5), Until: sampleDay(5), Data: views(3)},
+			},
+		},
+		{
+			name:    "insertion joins both neighbours",
+			samples: timeSeriesSamples{{1, views(1)}, {2, views(2)}, {5, views(1)}, {2, views(1)}},
+			want:    []TimeSeriesDataEntry{{Date: sampleDay(1), Until: sampleDay(5), Data: views(1)}},
+		},
+		{
+			name:    "insertion before the first sample",
+			samples: timeSeriesSamples{{4, views(2)}, {2, views(2)}, {1, views(1)}},
+			want: []TimeSeriesDataEntry{
+				{Date: sampleDay(1), Until: sampleDay(1), Data: views(1)},
+				{Date: sampleDay(2), Until: sampleDay(4), Data: views(2)},
+			},
+		},
+		{
+			name:    "insertion into the middle of a run",
+			samples: timeSeriesSamples{{1, views(1)}, {2, views(1)}, {4, views(1)}, {5, views(1)}, {3, views(2)}},
+			want: []TimeSeriesDataEntry{
+				{Date: sampleDay(1), Until: sampleDay(2), Data: views(1)},
+				{Date: sampleDay(3), Until: sampleDay(3), Data: views(2)},
+				{Date: sampleDay(4), Until: sampleDay(5), Data: views(1)},
+			},
+		},
+		{
+			name:    "insertion at the start of a run",
+			samples: timeSeriesSamples{{0, views(2)}, {2, views(1)}, {3, views(1)}, {1, views(1)}, {1, views(2)}},
+			want: []TimeSeriesDataEntry{
+				{Date: sampleDay(0), Until: sampleDay(1), Data: views(2)},
+				{Date: sampleDay(2), Until: sampleDay(3), Data: views(1)},
+			},
+		},
+		{
+			name:    "insertion into a run without known collections",
+			samples: timeSeriesSamples{{1, views(1)}, {5, views(1)}, {3, views(2)}},
+			want: []TimeSeriesDataEntry{
+				{Date: sampleDay(1), Until: sampleDay(1), Data: views(1)},
+				{Date: sampleDay(3), Until: sampleDay(3), Data: views(2)},
+				{Date: sampleDay(5), Until: sampleDay(5), Data: views(1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := tt.samples.build()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("insert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(series.Entries, tt.want) {
+				t.Errorf("insert() = %v, want %v", series.Entries, tt.want)
+			}
+		})
+	}
+}
@@ -6,3 +6,11 @@ type Timeframe interface {
 	GetStartDate() time.Time
 	GetEndDate() time.Time
 }
+
+// lastReportingDay returns the last reporting day of the range of Dates, an open end is today.
+func lastReportingDay(Dates Timeframe) time.Time {
+	if Dates.GetEndDate().IsZero() {
+		return Database.ReportingDay(time.Now())
+	}
+	return Database.ReportingDay(Dates.GetEndDate())
+}
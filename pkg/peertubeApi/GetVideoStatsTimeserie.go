@@ -0,0 +1,67 @@
+package peertubeApi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The metrics of the timeserie stats of a video.
+const (
+	// VideoStatsMetricViewers is the number of viewers that started watching the video within each interval.
+	VideoStatsMetricViewers = "viewers"
+	// VideoStatsMetricAggregateWatchTime is the watch time in seconds within each interval.
+	VideoStatsMetricAggregateWatchTime = "aggregateWatchTime"
+)
+
+// VideoStatsTimeserie is the response of the timeserie stats of a video, PeerTube groups the values by an interval depending on the requested range.
+type VideoStatsTimeserie struct {
+	GroupInterval string                     `json:"groupInterval"`
+	Data          []VideoStatsTimeserieValue `json:"data"`
+}
+
+type VideoStatsTimeserieValue struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+}
+
+func (v *VideoStatsTimeserieValue) GetDate() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, v.Date)
+}
+
+// GetVideoStatsTimeserie requests a metric of the video between start and end, see VideoStatsMetricViewers.
+// The stats are only available to the owner of the video and to administrators, they are kept by PeerTube since version 4.2.
+func (api *ApiClient) GetVideoStatsTimeserie(id int64, metric string, start, end time.Time) (data VideoStatsTimeserie, err error) {
+	const endpoint = "videos/{{id}}/stats/timeseries/{{metric}}"
+	query := url.Values{}
+	query.Set("startDate", start.UTC().Format(time.RFC3339))
+	query.Set("endDate", end.UTC().Format(time.RFC3339))
+	endpointUrl := url.URL{
+		Scheme:   api.Protocol,
+		Host:     api.Host,
+		Path:     apiPrefix + strings.NewReplacer("{{id}}", strconv.FormatInt(id, 10), "{{metric}}", metric).Replace(endpoint),
+		RawQuery: query.Encode(),
+	}
+
+	resp, err := api.doRequest(&http.Request{
+		Method: http.MethodGet,
+		URL:    &endpointUrl,
+		Header: api.headers,
+		Host:   api.Host,
+	})
+	if err != nil {
+		return data, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return data, errors.New("http status: " + resp.Status + "\nresponse body: " + string(responseBody))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	return data, err
+}
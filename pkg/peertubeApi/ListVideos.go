@@ -160,6 +160,7 @@ type VideoData struct {
 	Language              Metadata        `json:"language"`
 	Privacy               Metadata        `json:"privacy"`
 	TruncatedDescription  string          `json:"truncatedDescription"`
+	Tags                  []string        `json:"tags,omitempty"`
 	Duration              int64           `json:"duration"`
 	AspectRatio           float64         `json:"aspectRatio"`
 	IsLocal               bool            `json:"isLocal"`
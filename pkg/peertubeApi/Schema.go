@@ -0,0 +1,231 @@
+package peertubeApi
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openApiSpec is the JSON form of peertube.yaml, the OpenAPI description of the PeerTube version the client is written against.
+//
+//go:embed peertubeapi.json
+var openApiSpec []byte
+
+// The kinds of schema drift, see SchemaDrift.
+const (
+	// SchemaDriftType is a value of another type than the schema declares, e.g. a number sent as a string.
+	SchemaDriftType = "type"
+	// SchemaDriftNull is a null value of a field the schema does not declare nullable.
+	SchemaDriftNull = "null"
+	// SchemaDriftMissing is an absent field the schema requires.
+	SchemaDriftMissing = "missing"
+	// SchemaDriftUnknown is a field the schema does not declare, e.g. one added by a newer PeerTube version.
+	SchemaDriftUnknown = "unknown"
+	// SchemaDriftEnum is a value the schema does not list.
+	SchemaDriftEnum = "enum"
+	// SchemaDriftFormat is a string that does not match the format of the schema, e.g. date-time.
+	SchemaDriftFormat = "format"
+)
+
+// SchemaDrift is a value of a response that does not match the OpenAPI schema.
+// Field is the path of the value within the response without the array indices, e.g. data[].channel.name.
+type SchemaDrift struct {
+	Field    string `json:"field"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected"`
+	Found    string `json:"found"`
+}
+
+// Schema is the part of an OpenAPI schema object that describes the shape of a value.
+// Constraints of the values, like lengths, patterns and bounds, are not validated.
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	AllOf      []*Schema          `json:"allOf"`
+	Type       string             `json:"type"`
+	Nullable   bool               `json:"nullable"`
+	Format     string             `json:"format"`
+	Enum       []json.RawMessage  `json:"enum"`
+	Properties map[string]*Schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *Schema            `json:"items"`
+}
+
+const componentSchemaPrefix = "#/components/schemas/"
+
+var loadComponentSchemas = sync.OnceValues(func() (map[string]*Schema, error) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]*Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(openApiSpec, &spec)
+	return spec.Components.Schemas, err
+})
+
+// ComponentSchema returns a schema of the bundled OpenAPI description by its name, e.g. VideoListResponse.
+func ComponentSchema(name string) (*Schema, error) {
+	schemas, err := loadComponentSchemas()
+	if err != nil {
+		return nil, errors.Join(errors.New("cannot read the bundled OpenAPI description"), err)
+	}
+	schema, found := schemas[name]
+	if !found {
+		return nil, errors.New("the bundled OpenAPI description has no schema " + name)
+	}
+	return schema, nil
+}
+
+// Validate compares a value, decoded by a json.Decoder using UseNumber, with the schema and returns the drift.
+// field is the path of the value, it is empty for a whole response.
+func (s *Schema) Validate(value interface{}, field string) (drift []SchemaDrift) {
+	schemas, _ := loadComponentSchemas()
+	s.validate(schemas, value, field, &drift)
+	return drift
+}
+
+func (s *Schema) validate(schemas map[string]*Schema, value interface{}, field string, drift *[]SchemaDrift) {
+	s = s.flatten(schemas, 0)
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			*drift = append(*drift, SchemaDrift{Field: field, Kind: SchemaDriftNull, Expected: s.Type, Found: "null"})
+		}
+		return
+	}
+	found := jsonType(value)
+	if s.Type != "" && s.Type != found && !(s.Type == "number" && found == "integer") {
+		*drift = append(*drift, SchemaDrift{Field: field, Kind: SchemaDriftType, Expected: s.Type, Found: found})
+		return
+	}
+	if len(s.Enum) > 0 {
+		encoded, _ := json.Marshal(value)
+		if !slices.ContainsFunc(s.Enum, func(allowed json.RawMessage) bool { return string(allowed) == string(encoded) }) {
+			allowed := make([]string, len(s.Enum))
+			for i, value := range s.Enum {
+				allowed[i] = string(value)
+			}
+			*drift = append(*drift, SchemaDrift{Field: field, Kind: SchemaDriftEnum, Expected: strings.Join(allowed, ", "), Found: string(encoded)})
+		}
+	}
+
+	switch typed := value.(type) {
+	case string:
+		if !matchesFormat(s.Format, typed) {
+			*drift = append(*drift, SchemaDrift{Field: field, Kind: SchemaDriftFormat, Expected: s.Format, Found: typed})
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, present := typed[name]; !present {
+				*drift = append(*drift, SchemaDrift{Field: fieldPath(field, name), Kind: SchemaDriftMissing, Expected: s.Properties[name].flatten(schemas, 0).Type, Found: "absent"})
+			}
+		}
+		if len(s.Properties) == 0 {
+			return
+		}
+		for _, name := range slices.Sorted(maps.Keys(typed)) {
+			property, declared := s.Properties[name]
+			if !declared {
+				*drift = append(*drift, SchemaDrift{Field: fieldPath(field, name), Kind: SchemaDriftUnknown, Found: jsonType(typed[name])})
+				continue
+			}
+			property.validate(schemas, typed[name], fieldPath(field, name), drift)
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return
+		}
+		for _, item := range typed {
+			s.Items.validate(schemas, item, field+"[]", drift)
+		}
+	}
+}
+
+// flatten resolves the reference and the allOf members of the schema into a single schema.
+// An unknown reference, or one nested too deep, is left out and accepts any value.
+func (s *Schema) flatten(schemas map[string]*Schema, depth int) *Schema {
+	if s == nil || depth > 16 {
+		return &Schema{}
+	}
+	if s.Ref == "" && len(s.AllOf) == 0 {
+		if s.Type == "" && len(s.Properties) > 0 {
+			return &Schema{Type: "object", Nullable: s.Nullable, Properties: s.Properties, Required: s.Required}
+		}
+		return s
+	}
+	result := *s
+	result.Ref, result.AllOf = "", nil
+	members := slices.Clone(s.AllOf)
+	if referenced, found := schemas[strings.TrimPrefix(s.Ref, componentSchemaPrefix)]; found && s.Ref != "" {
+		members = append(members, referenced)
+	}
+	for _, member := range members {
+		member = member.flatten(schemas, depth+1)
+		result.Nullable = result.Nullable || member.Nullable
+		result.Type = cmp.Or(result.Type, member.Type)
+		result.Format = cmp.Or(result.Format, member.Format)
+		if result.Enum == nil {
+			result.Enum = member.Enum
+		}
+		if result.Items == nil {
+			result.Items = member.Items
+		}
+		if len(member.Properties) > 0 {
+			properties := maps.Clone(member.Properties)
+			maps.Copy(properties, result.Properties)
+			result.Properties = properties
+		}
+		result.Required = append(slices.Clone(result.Required), member.Required...)
+	}
+	if result.Type == "" && len(result.Properties) > 0 {
+		result.Type = "object"
+	}
+	return &result
+}
+
+// jsonType returns the OpenAPI type of a value decoded by a json.Decoder using UseNumber.
+func jsonType(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(typed.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// matchesFormat reports if a string matches a format of the schema, formats that are only descriptive, e.g. url, match any string.
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "uuid":
+		return len(value) == 36 && strings.Count(value, "-") == 4 && strings.Trim(strings.ToLower(value), "0123456789abcdef-") == ""
+	}
+	return true
+}
+
+func fieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
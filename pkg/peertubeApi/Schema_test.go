@@ -0,0 +1,54 @@
+package peertubeApi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := ComponentSchema("VideoListResponse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const video = `"id":1,"uuid":"9c9de5e8-0a1e-484a-b099-e80766180a6d","shortUUID":"2y84q2MQUMWPbiEcxNXMgC","name":"What is PeerTube?",` +
+		`"publishedAt":"2018-10-01T10:52:46.396Z","originallyPublishedAt":null,"duration":1419,"aspectRatio":1.778,` +
+		`"category":{"id":15,"label":"Science & Technology"},"privacy":{"id":1,"label":"Public"},` +
+		`"channel":{"id":2,"name":"chan","displayName":"Chan","avatars":[{"path":"/a.png","width":48}]},"likes":42`
+
+	tests := []struct {
+		name     string
+		response string
+		want     []SchemaDrift
+	}{
+		{"valid", `{"total":1,"data":[{` + video + `,"views":1337,"state":{"id":1,"label":"Published"},"scheduledUpdate":null}]}`, nil},
+		{"unset language", `{"total":1,"data":[{` + video + `,"views":1337,"language":{"id":null,"label":"Unknown"}}]}`,
+			[]SchemaDrift{{Field: "data[].language.id", Kind: SchemaDriftNull, Expected: "string", Found: "null"}}},
+		{"views sent as string", `{"total":1,"data":[{` + video + `,"views":"1337"}]}`,
+			[]SchemaDrift{{Field: "data[].views", Kind: SchemaDriftType, Expected: "integer", Found: "string"}}},
+		{"field of a newer version", `{"total":1,"data":[{` + video + `,"views":1337,"watchTime":12.5}]}`,
+			[]SchemaDrift{{Field: "data[].watchTime", Kind: SchemaDriftUnknown, Found: "number"}}},
+		{"unknown state and date", `{"total":1,"data":[{` + video + `,"views":1337,"state":{"id":12,"label":"New"},"updatedAt":"yesterday"}]}`,
+			[]SchemaDrift{
+				{Field: "data[].state.id", Kind: SchemaDriftEnum, Expected: "1, 2, 3, 4, 5, 6, 7, 8, 9", Found: "12"},
+				{Field: "data[].updatedAt", Kind: SchemaDriftFormat, Expected: "date-time", Found: "yesterday"},
+			}},
+		{"required field of a nested object", `{"total":1,"data":[{` + video + `,"views":1337,"scheduledUpdate":{"privacy":1}}]}`,
+			[]SchemaDrift{{Field: "data[].scheduledUpdate.updateAt", Kind: SchemaDriftMissing, Expected: "string", Found: "absent"}}},
+		{"no video list", `[]`, []SchemaDrift{{Field: "", Kind: SchemaDriftType, Expected: "object", Found: "array"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := json.NewDecoder(bytes.NewReader([]byte(tt.response)))
+			decoder.UseNumber()
+			var response interface{}
+			if err := decoder.Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(response, ""); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
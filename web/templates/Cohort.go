@@ -0,0 +1,39 @@
+package templates
+
+import "slices"
+
+// The counters compared on the cohort page, see CohortRequest.Metric.
+const (
+	CohortViews = "Views"
+	CohortLikes = "Likes"
+)
+
+// CohortDays lists the lengths of the comparisons after publication, in days.
+var CohortDays = []int{7, 30, 90}
+
+// CohortRequest selects the videos compared on the cohort page, by the days since their publication.
+type CohortRequest struct {
+	// Days is the number of days after publication that are compared, see CohortDays
+	Days int `form:"days" json:"days"`
+	// Metric can be Views or Likes
+	Metric string `form:"metric" json:"metric"`
+	// Channel limits the cohort to the videos of a channel, zero selects all channels
+	Channel int64 `form:"channel" json:"channel"`
+	// Videos limits the cohort to the selected videos, empty selects all videos of the channel
+	Videos []int64 `form:"videos" json:"videos"`
+}
+
+// Normalize sets unknown days and metrics to their defaults, the first 30 days of the views.
+func (request *CohortRequest) Normalize() {
+	if !slices.Contains(CohortDays, request.Days) {
+		request.Days = 30
+	}
+	if request.Metric != CohortLikes {
+		request.Metric = CohortViews
+	}
+}
+
+// Selected reports whether a video is part of the selection of the request.
+func (request CohortRequest) Selected(videoID int64) bool {
+	return slices.Contains(request.Videos, videoID)
+}
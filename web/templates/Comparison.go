@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"slices"
+	"time"
+)
+
+// The ranges a range is compared to, see FrontPageRequest.Compare.
+const (
+	// CompareNone does not compare the range.
+	CompareNone = "None"
+	// ComparePreviousPeriod compares to the range of the same length right before, a range starting on the first of a month to the months before.
+	ComparePreviousPeriod = "PreviousPeriod"
+	// ComparePreviousYear compares to the same range one year before.
+	ComparePreviousYear = "PreviousYear"
+)
+
+// CompareModes lists every range a range can be compared to.
+var CompareModes = []string{CompareNone, ComparePreviousPeriod, ComparePreviousYear}
+
+// ParseCompare normalizes the comparison of a range, unknown values do not compare.
+func ParseCompare(compare string) string {
+	if !slices.Contains(CompareModes, compare) {
+		return CompareNone
+	}
+	return compare
+}
+
+// ComparedDates returns the range the dates of the request are compared to, it is aligned to the calendar of the dates.
+// A range starting on the first of a month is compared to the same days of the months before, e.g. the first half of
+// October to the first half of September, a whole month to the whole previous month.
+// Other ranges are compared to the same number of days right before.
+func (fpr FrontPageRequest) ComparedDates() TwoDateForm {
+	start, end := fpr.Dates.StartDate, fpr.Dates.EndDate
+	switch {
+	case fpr.Compare == ComparePreviousYear:
+		return TwoDateForm{StartDate: addMonthsClamped(start, -12), EndDate: addMonthsClamped(end, -12)}
+	case fpr.Compare == ComparePreviousPeriod && start.Day() == 1:
+		months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month()) + 1
+		if end.AddDate(0, 0, 1).Day() == 1 {
+			// whole months are compared to the whole months before
+			return TwoDateForm{StartDate: start.AddDate(0, -months, 0), EndDate: start.AddDate(0, 0, -1)}
+		}
+		return TwoDateForm{StartDate: start.AddDate(0, -months, 0), EndDate: addMonthsClamped(end, -months)}
+	case fpr.Compare == ComparePreviousPeriod:
+		days := int(end.Sub(start).Hours()/24+0.5) + 1
+		return TwoDateForm{StartDate: start.AddDate(0, 0, -days), EndDate: start.AddDate(0, 0, -1)}
+	}
+	return TwoDateForm{}
+}
+
+// addMonthsClamped adds months to date, a day that does not exist in the resulting month is clamped to its last day.
+func addMonthsClamped(date time.Time, months int) time.Time {
+	firstOfMonth := time.Date(date.Year(), date.Month()+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(date.Day(), lastDay)-1)
+}
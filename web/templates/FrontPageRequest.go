@@ -1,18 +1,78 @@
 package templates
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
+
+// The modes of the stats, see FrontPageRequest.Mode.
+const (
+	// ModeCumulative shows the views and likes counters at the end of each period.
+	ModeCumulative = "Cumulative"
+	// ModeDelta shows the views and likes gained within each period.
+	ModeDelta = "Delta"
+)
 
 type FrontPageRequest struct {
-	// Timeframe can be Daily, Monthly or Yearly
+	// Timeframe can be Hourly, Daily, Weekly, Monthly, Quarterly, Yearly or Custom
 	Timeframe string `form:"timeframe" json:"timeframe"`
-	// Query the content of the search field
-	Query string      `form:"query" json:"query"`
-	Dates TwoDateForm `json:"dates" form:"dates"`
+	// IntervalDays is the length of a Custom timeframe in days
+	IntervalDays int `form:"interval_days" json:"interval_days"`
+	// Mode can be Cumulative or Delta
+	Mode string `form:"mode" json:"mode"`
+	// Rank is the metric videos are sorted by, see RankMetrics
+	Rank string `form:"rank" json:"rank"`
+	// RankGroup is the group shown in the leaderboard, see RankGroups
+	RankGroup string `form:"rank_group" json:"rank_group"`
+	// ForecastPeriods is the number of projected periods following the range, see MaximumForecastPeriods
+	ForecastPeriods int `form:"forecast" json:"forecast"`
+	// Compare is the range the dates are compared to, see CompareModes and ComparedDates
+	Compare string `form:"compare" json:"compare"`
+	// Query the content of the search field, the videos are searched by SearchVideos
+	Query string `form:"query" json:"query"`
+	// Filter limits the videos by their metadata
+	Filter VideoFilter `form:"filter" json:"filter"`
+	Dates  TwoDateForm `json:"dates" form:"dates"`
+}
+
+// Interval returns the timeframe in the form understood by ParseTimeframe, a Custom timeframe is returned as "Nd".
+func (fpr FrontPageRequest) Interval() string {
+	if fpr.Timeframe == TimeframeCustom {
+		if fpr.IntervalDays < 1 {
+			return strconv.Itoa(DefaultIntervalDays) + "d"
+		}
+		return strconv.Itoa(fpr.IntervalDays) + "d"
+	}
+	return fpr.Timeframe
 }
 
-func (fpr *FrontPageRequest) HandleZeroDate() {
+// HandleZeroDate normalizes the request, the dates are set to the start of their calendar day in the reporting time zone location.
+func (fpr *FrontPageRequest) HandleZeroDate(location *time.Location) {
 	// now never contains the time as we do not care about it, only the date.
-	now := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Now().In(location)
+	now := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, location)
+	// the dates of a form are parsed in UTC, they name a calendar day in the reporting time zone.
+	fpr.Dates.StartDate = inLocation(fpr.Dates.StartDate, location)
+	fpr.Dates.EndDate = inLocation(fpr.Dates.EndDate, location)
+
+	if fpr.Mode != ModeDelta {
+		fpr.Mode = ModeCumulative
+	}
+	fpr.Rank, fpr.RankGroup = ParseRanking(fpr.Rank, fpr.RankGroup)
+	fpr.ForecastPeriods = min(max(fpr.ForecastPeriods, 0), MaximumForecastPeriods)
+	fpr.Compare = ParseCompare(fpr.Compare)
+	fpr.Filter.Normalize(location)
+
+	// a custom interval may be given in the timeframe directly, e.g. 14d
+	timeframe, intervalDays := ParseTimeframe(fpr.Interval())
+	fpr.Timeframe = timeframe
+	if timeframe == TimeframeCustom {
+		fpr.IntervalDays = intervalDays
+	}
+	if timeframe == TimeframeHourly {
+		// forecasts are made of daily models
+		fpr.ForecastPeriods = 0
+	}
 
 	// If both dates are zero, set them to now
 	if fpr.Dates.StartDate.IsZero() && fpr.Dates.EndDate.IsZero() {
@@ -20,30 +80,42 @@ func (fpr *FrontPageRequest) HandleZeroDate() {
 		fpr.Dates.EndDate = now
 	}
 
-	switch fpr.Timeframe {
-	case "":
-		fallthrough
-	case "Daily":
-		// if no start date was specified, or the timeframe matches a previous calculation, reset it.
-		if fpr.Dates.StartDate.Equal(now) || fpr.Dates.StartDate.Equal(now.AddDate(0, -5, 0)) || fpr.Dates.StartDate.Equal(now.AddDate(-4, 0, 0)) {
-			fpr.Dates.StartDate = now.AddDate(0, 0, -6)
-			fpr.Dates.EndDate = now
-		}
-		// in case of a fallthrough assume daily
-		fpr.Timeframe = "Daily"
-
-	case "Monthly":
-		// Reset to 5 months ago if start date is now or date range is too short
-		if fpr.Dates.StartDate.Equal(now) || fpr.Dates.EndDate.Sub(fpr.Dates.StartDate).Hours() < ((24*30)*2) || fpr.Dates.StartDate.Equal(now.AddDate(-4, 0, 0)) {
-			fpr.Dates.StartDate = now.AddDate(0, -5, 0)
-			fpr.Dates.EndDate = now
-		}
+	// the default range of each timeframe, a start date that matches the default of another timeframe is reset as well.
+	defaultStarts := map[string]time.Time{
+		TimeframeHourly:    now.AddDate(0, 0, -2),
+		TimeframeDaily:     now.AddDate(0, 0, -6),
+		TimeframeWeekly:    now.AddDate(0, 0, -7*7),
+		TimeframeMonthly:   now.AddDate(0, -5, 0),
+		TimeframeQuarterly: now.AddDate(0, -3*3, 0),
+		TimeframeYearly:    now.AddDate(-4, 0, 0),
+		TimeframeCustom:    now.AddDate(0, 0, -5*max(1, fpr.IntervalDays)),
+	}
+	// minimumRange is the shortest range that shows at least two buckets.
+	minimumRange := map[string]time.Duration{
+		TimeframeHourly:    0,
+		TimeframeDaily:     0,
+		TimeframeWeekly:    2 * 7 * 24 * time.Hour,
+		TimeframeMonthly:   (24 * 30) * 2 * time.Hour,
+		TimeframeQuarterly: (24 * 30) * 3 * 2 * time.Hour,
+		TimeframeYearly:    ((24 * 30) * 12) * 2 * time.Hour,
+		TimeframeCustom:    time.Duration(2*max(1, fpr.IntervalDays)) * 24 * time.Hour,
+	}
 
-	case "Yearly":
-		// Reset to 4 years ago if start date is now or date range is too short
-		if fpr.Dates.StartDate.Equal(now) || fpr.Dates.EndDate.Sub(fpr.Dates.StartDate).Hours() < ((24*30)*12)*2 {
-			fpr.Dates.StartDate = now.AddDate(-4, 0, 0)
-			fpr.Dates.EndDate = now
-		}
+	reset := fpr.Dates.StartDate.Equal(now) || fpr.Dates.EndDate.Sub(fpr.Dates.StartDate) < minimumRange[timeframe]
+	reset = reset || timeframe == TimeframeHourly && fpr.Dates.EndDate.After(fpr.Dates.StartDate.AddDate(0, 0, MaximumHourlyDays))
+	for _, defaultStart := range defaultStarts {
+		reset = reset || fpr.Dates.StartDate.Equal(defaultStart)
+	}
+	if reset {
+		fpr.Dates.StartDate = defaultStarts[timeframe]
+		fpr.Dates.EndDate = now
+	}
+}
+
+// inLocation returns the start of the calendar day of date in location, the zero date stays zero.
+func inLocation(date time.Time, location *time.Location) time.Time {
+	if date.IsZero() {
+		return date
 	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, location)
 }
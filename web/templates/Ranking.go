@@ -0,0 +1,41 @@
+package templates
+
+import "slices"
+
+// The metrics a ranking is sorted by, see FrontPageRequest.Rank.
+const (
+	// RankByViews sorts by the views at the end of the range.
+	RankByViews = "Views"
+	// RankByViewsGained sorts by the views gained within the range.
+	RankByViewsGained = "ViewsGained"
+	// RankByLikesGained sorts by the likes gained within the range.
+	RankByLikesGained = "LikesGained"
+	// RankByGrowthRate sorts by the views gained relative to the views at the start of the range.
+	RankByGrowthRate = "GrowthRate"
+	// RankByLikeRatio sorts by the likes per view at the end of the range.
+	RankByLikeRatio = "LikeRatio"
+)
+
+// The groups a ranking is made of, see FrontPageRequest.RankGroup.
+const (
+	RankVideos     = "Videos"
+	RankChannels   = "Channels"
+	RankCategories = "Categories"
+)
+
+// RankMetrics lists every metric a ranking can be sorted by.
+var RankMetrics = []string{RankByViews, RankByViewsGained, RankByLikesGained, RankByGrowthRate, RankByLikeRatio}
+
+// RankGroups lists every group a ranking can be made of.
+var RankGroups = []string{RankVideos, RankChannels, RankCategories}
+
+// ParseRanking normalizes the metric and the group of a ranking, unknown values fall back to the views of videos.
+func ParseRanking(metric, group string) (string, string) {
+	if !slices.Contains(RankMetrics, metric) {
+		metric = RankByViews
+	}
+	if !slices.Contains(RankGroups, group) {
+		group = RankVideos
+	}
+	return metric, group
+}
@@ -0,0 +1,45 @@
+package templates
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The timeframes of the stats, a timeframe is the length of one bucket.
+// Besides these, a custom interval of N days is written as "Nd", e.g. "14d".
+const (
+	// TimeframeHourly is meant for ranges of a few days, see MaximumHourlyDays.
+	TimeframeHourly    = "Hourly"
+	TimeframeDaily     = "Daily"
+	TimeframeWeekly    = "Weekly"
+	TimeframeMonthly   = "Monthly"
+	TimeframeQuarterly = "Quarterly"
+	TimeframeYearly    = "Yearly"
+	// TimeframeCustom is used by forms, the length of the interval is sent separately, see FrontPageRequest.IntervalDays.
+	TimeframeCustom = "Custom"
+)
+
+// MaximumHourlyDays is the longest range shown in the Hourly timeframe, longer ranges are reset to the default range.
+const MaximumHourlyDays = 7
+
+// MaximumForecastPeriods is the largest number of projected periods following a range.
+const MaximumForecastPeriods = 12
+
+// DefaultIntervalDays is the length of a Custom timeframe if no length was requested.
+const DefaultIntervalDays = 14
+
+// ParseTimeframe normalizes a timeframe, intervalDays is set for custom intervals of N days.
+// Unknown timeframes fall back to Daily.
+func ParseTimeframe(timeframe string) (name string, intervalDays int) {
+	switch timeframe {
+	case TimeframeHourly, TimeframeDaily, TimeframeWeekly, TimeframeMonthly, TimeframeQuarterly, TimeframeYearly:
+		return timeframe, 0
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(timeframe, "d")); err == nil && strings.HasSuffix(timeframe, "d") && days > 0 {
+		if days == 1 {
+			return TimeframeDaily, 0
+		}
+		return TimeframeCustom, days
+	}
+	return TimeframeDaily, 0
+}
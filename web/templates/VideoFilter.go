@@ -0,0 +1,57 @@
+package templates
+
+import "time"
+
+// The live filters, see VideoFilter.Live. An empty filter selects every video.
+const (
+	// LiveOnly selects the live streams.
+	LiveOnly = "Live"
+	// LiveExcluded selects the videos that are no live streams.
+	LiveExcluded = "NotLive"
+)
+
+// VideoFilter limits the videos of the index page by their metadata, the zero value of a field does not limit them.
+type VideoFilter struct {
+	// PublishedFrom is the first calendar day of publication
+	PublishedFrom time.Time `form:"published_from" json:"published_from"`
+	// PublishedUntil is the last calendar day of publication
+	PublishedUntil time.Time `form:"published_until" json:"published_until"`
+	// MinDurationMinutes is the shortest duration in minutes
+	MinDurationMinutes int `form:"min_duration" json:"min_duration"`
+	// MaxDurationMinutes is the longest duration in minutes
+	MaxDurationMinutes int `form:"max_duration" json:"max_duration"`
+	// Category is the label of the category
+	Category string `form:"category" json:"category"`
+	// Privacy is the label of the privacy, e.g. Public or Unlisted
+	Privacy string `form:"privacy" json:"privacy"`
+	// Live can be Live or NotLive
+	Live string `form:"live" json:"live"`
+	// Channel is the id of the channel
+	Channel int64 `form:"channel" json:"channel"`
+}
+
+// Normalize sets the dates to the start of their calendar day in the reporting time zone location and swaps reversed ranges.
+// Negative durations and unknown live filters are reset.
+func (filter *VideoFilter) Normalize(location *time.Location) {
+	filter.PublishedFrom = inLocation(filter.PublishedFrom, location)
+	filter.PublishedUntil = inLocation(filter.PublishedUntil, location)
+	if !filter.PublishedFrom.IsZero() && !filter.PublishedUntil.IsZero() && filter.PublishedUntil.Before(filter.PublishedFrom) {
+		filter.PublishedFrom, filter.PublishedUntil = filter.PublishedUntil, filter.PublishedFrom
+	}
+	filter.MinDurationMinutes = max(filter.MinDurationMinutes, 0)
+	filter.MaxDurationMinutes = max(filter.MaxDurationMinutes, 0)
+	if filter.MaxDurationMinutes > 0 && filter.MaxDurationMinutes < filter.MinDurationMinutes {
+		filter.MinDurationMinutes, filter.MaxDurationMinutes = filter.MaxDurationMinutes, filter.MinDurationMinutes
+	}
+	if filter.Live != LiveOnly && filter.Live != LiveExcluded {
+		filter.Live = ""
+	}
+	if filter.Channel < 0 {
+		filter.Channel = 0
+	}
+}
+
+// Active reports whether the filter limits the videos.
+func (filter VideoFilter) Active() bool {
+	return filter != VideoFilter{}
+}
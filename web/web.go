@@ -11,11 +11,13 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sa-kemper/peertubestats/internal/LogHelp"
 	"github.com/sa-kemper/peertubestats/pkg/StatsIO"
+	"github.com/sa-kemper/peertubestats/pkg/peertubeApi"
 	"github.com/sa-kemper/peertubestats/web/templates"
 )
 
@@ -51,14 +53,32 @@ var TemplateFunctions = template.FuncMap{
 	},
 	"videoStats": func(videoID int64, request templates.FrontPageRequest) (stats []StatsIO.VideoStat) {
 		var err error
-		stats, err = StatsIO.ExportStats(videoID, request.Dates, request.Timeframe)
+		stats, err = StatsIO.ExportStatsForRequest(videoID, request)
 		LogHelp.LogOnError("Cannot retrieve stats", map[string]interface{}{"videoID": videoID, "request": request}, err)
 		return stats
 	},
+	"videoMetrics": func(video peertubeApi.VideoData, request templates.FrontPageRequest) StatsIO.EngagementMetrics {
+		metrics, err := StatsIO.RangeMetrics([]peertubeApi.VideoData{video}, request.Dates)
+		LogHelp.LogOnError("Cannot derive video metrics", map[string]interface{}{"videoID": video.ID, "request": request}, err)
+		return metrics
+	},
+	"bucketMetrics": func(video peertubeApi.VideoData, request templates.FrontPageRequest) []StatsIO.EngagementMetrics {
+		metrics, err := StatsIO.BucketMetrics(video, request.Dates, request.Interval())
+		LogHelp.LogOnError("Cannot derive bucket metrics", map[string]interface{}{"videoID": video.ID, "request": request}, err)
+		return metrics
+	},
+	"videoHistory": func(videoID int64) StatsIO.VideoHistory {
+		history, err := StatsIO.GetVideoHistory(videoID)
+		LogHelp.LogOnError("Cannot retrieve video history", map[string]interface{}{"videoID": videoID}, err)
+		return history
+	},
+	"videoFieldLabel":     StatsIO.VideoFieldLabel,
 	"VideoNameToFilePath": StatsIO.VideoNameToFilePath,
 	"formatDate": func(date time.Time) string {
-		return date.Format("2006-01-02")
+		return date.In(StatsIO.Database.ReportingLocation()).Format("2006-01-02")
 	},
+	"formatStatTime": StatsIO.FormatStatTime,
+	"lastReload":     StatsIO.LastReload,
 	"formatDuration": func(date time.Duration) string {
 		return date.String()
 	},
@@ -105,7 +125,11 @@ func buildParamsFromStruct(u *url.Values, input interface{}) {
 			continue
 		}
 		if timeValue, ok := fieldValue.Interface().(time.Time); ok {
-			u.Add(fieldName, timeValue.Format("2006-01-02"))
+			if timeValue.IsZero() {
+				// a zero date is unset, it is not bound again
+				continue
+			}
+			u.Add(fieldName, timeValue.In(StatsIO.Database.ReportingLocation()).Format("2006-01-02"))
 			continue
 		}
 		if filedKind == reflect.Struct || filedKind == reflect.Slice || filedKind == reflect.Array {
@@ -114,7 +138,12 @@ func buildParamsFromStruct(u *url.Values, input interface{}) {
 			}
 			continue
 		}
-		u.Add(fieldName, fieldValue.String())
+		switch filedKind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			u.Add(fieldName, strconv.FormatInt(fieldValue.Int(), 10))
+		default:
+			u.Add(fieldName, fieldValue.String())
+		}
 
 	}
 }